@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+)
+
+// listDevices 打印各厂商发现的设备，任一厂商发现失败时返回非0退出码
+func listDevices(out io.Writer, managers []vendorManager) int {
+	code := 0
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VENDOR\tID\tPHYSICAL\tMIG\tPROFILE\tHEALTHY\tPATH")
+	for _, m := range managers {
+		devices, err := m.manager.DiscoverGPUs()
+		if err != nil {
+			fmt.Fprintf(w, "%s\t-\t-\t-\t-\t-\terror: %v\n", m.vendor, err)
+			code = 1
+			continue
+		}
+		for _, d := range devices {
+			profile := "-"
+			if profiled, ok := d.(device.ProfiledDevice); ok && profiled.Profile() != "" {
+				profile = profiled.Profile()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%t\t%s\n", m.vendor, d.ID(), d.PhysicalID(), d.IsMIG(),
+				profile, m.manager.CheckHealth(d.ID()), d.GetPath())
+		}
+	}
+	w.Flush()
+	return code
+}
+
+// printMIGPlan 打印MIG配置将对各GPU执行的操作，不修改任何设备
+func printMIGPlan(out io.Writer, manager *device.NVIDIAManager) int {
+	plans, err := manager.PlanMIG()
+	if err != nil {
+		fmt.Fprintf(out, "failed to plan MIG configuration: %v\n", err)
+		return 1
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "GPU\tPROFILE\tMIG MODE\tDESTROY\tCREATE\tACTION")
+	for _, p := range plans {
+		mode := "disabled"
+		if p.MIGEnabled {
+			mode = "enabled"
+		}
+		action := "reconfigure"
+		destroy, create := strconv.Itoa(p.Existing), strconv.Itoa(p.Create)
+		if p.Skip {
+			action = "skip: " + p.Reason
+			destroy, create = "0", "0"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", p.GPU, p.Profile, mode, destroy, create, action)
+	}
+	w.Flush()
+	return 0
+}
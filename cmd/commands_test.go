@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+)
+
+// failingManager 发现设备总是失败
+type failingManager struct {
+	*device.SimulatorManager
+}
+
+func (failingManager) DiscoverGPUs() ([]device.GPUDevice, error) {
+	return nil, errors.New("nvidia-smi not found")
+}
+
+// list 每个设备一行，发现失败的厂商输出错误并返回非0退出码
+func TestListDevices(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "2")
+	t.Setenv("SIM_MIG_PER_GPU", "0")
+	t.Setenv("SIM_UNHEALTHY_IDS", "1")
+	t.Setenv("SIM_FAIL_RATE", "0")
+	sim := device.NewSimulatorManager()
+
+	tests := []struct {
+		name      string
+		managers  []vendorManager
+		wantCode  int
+		wantLines []string // 去除对齐空白后的各行
+	}{
+		{"healthy and unhealthy devices", []vendorManager{{"simulator", sim}}, 0, []string{
+			"VENDOR ID PHYSICAL MIG PROFILE HEALTHY PATH",
+			"simulator 0 0 false - true /dev/sim_gpu0",
+			"simulator 1 1 false - false /dev/sim_gpu1",
+		}},
+		{"discovery fails", []vendorManager{{"nvidia", failingManager{sim}}, {"simulator", sim}}, 1, []string{
+			"VENDOR ID PHYSICAL MIG PROFILE HEALTHY PATH",
+			"nvidia - - - - - error: nvidia-smi not found",
+			"simulator 0 0 false - true /dev/sim_gpu0",
+			"simulator 1 1 false - false /dev/sim_gpu1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if code := listDevices(&out, tt.managers); code != tt.wantCode {
+				t.Fatalf("listDevices() = %d, want %d", code, tt.wantCode)
+			}
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				lines = append(lines, strings.Join(strings.Fields(line), " "))
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.wantLines, "\n") {
+				t.Fatalf("listDevices() output:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(tt.wantLines, "\n"))
+			}
+		})
+	}
+}
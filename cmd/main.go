@@ -2,60 +2,223 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
 	"syscall"
-	"time"
 
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
 	"github.com/benyuereal/micro-device-plugin/pkg/device"
 	"github.com/benyuereal/micro-device-plugin/pkg/deviceplugin"
+	"github.com/benyuereal/micro-device-plugin/pkg/metrics"
+	"github.com/go-logr/logr"
 	"k8s.io/klog/v2"
 )
 
+// setupLogging LOG_FORMAT=json 时以JSON输出日志，结构化字段（vendor、device_id、pod_uid等）作为独立键
+func setupLogging() {
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "", "text":
+	case "json":
+		klog.SetLogger(logr.FromSlogHandler(slog.NewJSONHandler(os.Stderr, nil)))
+	default:
+		klog.Warningf("Unknown LOG_FORMAT %q, using text", format)
+	}
+}
+
+// applyLogVerbosity 按配置文件设置 klog 日志级别
+func applyLogVerbosity(cfg *config.Config) {
+	if cfg.LogVerbosity == nil {
+		return
+	}
+	if err := flag.Set("v", strconv.Itoa(*cfg.LogVerbosity)); err != nil {
+		klog.Warningf("Failed to set log verbosity: %v", err)
+	}
+}
+
+// reloadConfig 重新读取配置文件并应用到所有插件，读取失败时保留当前配置
+func reloadConfig(plugins []*deviceplugin.DevicePluginServer) {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		klog.Errorf("Failed to reload config, keeping current settings: %v", err)
+		return
+	}
+	applyLogVerbosity(cfg)
+	for _, srv := range plugins {
+		srv.Reload(cfg.Vendor(srv.Vendor()))
+	}
+}
+
+// resolveNodeName 优先使用 downward API 注入的 NODE_NAME，未设置时回退到主机名
+// （DaemonSet 使用 hostNetwork，主机名即节点名）；启用Kubernetes功能时两者均为空则报错
+func resolveNodeName(kubernetesEnabled bool) (string, error) {
+	if nodeName := os.Getenv("NODE_NAME"); nodeName != "" {
+		return nodeName, nil
+	}
+	hostname, err := os.Hostname()
+	if err == nil && hostname != "" {
+		klog.Warningf("NODE_NAME is not set, falling back to hostname %q as node name", hostname)
+		return hostname, nil
+	}
+	if kubernetesEnabled {
+		return "", fmt.Errorf("NODE_NAME is not set and hostname is unavailable: %v", err)
+	}
+	klog.Warningf("NODE_NAME is not set and hostname is unavailable: %v", err)
+	return "", nil
+}
+
+// drainAll 排空所有插件
+func drainAll(plugins []*deviceplugin.DevicePluginServer) {
+	for _, srv := range plugins {
+		srv.Drain()
+	}
+}
+
+// vendorManager 厂商及其设备管理器
+type vendorManager struct {
+	vendor  string
+	manager device.DeviceManager
+}
+
+// parseEnabledVendors 解析 ENABLED_VENDORS（逗号分隔），出现未知厂商时报错
+func parseEnabledVendors(value string) (map[string]bool, error) {
+	known := make(map[string]bool, len(device.Vendors))
+	for _, vendor := range device.Vendors {
+		known[vendor] = true
+	}
+	enabled := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		vendor := strings.ToLower(strings.TrimSpace(item))
+		if vendor == "" {
+			continue
+		}
+		if !known[vendor] {
+			return nil, fmt.Errorf("unknown vendor %q in ENABLED_VENDORS, expected one of %v", vendor, device.Vendors)
+		}
+		enabled[vendor] = true
+	}
+	return enabled, nil
+}
+
+// selectVendors 返回要启动的厂商：优先使用 ENABLED_VENDORS，
+// 未设置时只启动宿主机上存在管理工具的厂商
+func selectVendors(cfg *config.Config) (map[string]bool, error) {
+	if value := os.Getenv("ENABLED_VENDORS"); value != "" {
+		return parseEnabledVendors(value)
+	}
+	detected := device.DetectVendors(cfg)
+	klog.Infof("Detected device vendors: %v", detected)
+	selected := make(map[string]bool)
+	for _, vendor := range detected {
+		selected[vendor] = true
+	}
+	// 允许回退到模拟设备时 nvidia-smi 不存在也启动NVIDIA插件
+	if os.Getenv("ALLOW_SIMULATOR_FALLBACK") == "true" {
+		selected["nvidia"] = true
+	}
+	return selected, nil
+}
+
+// newManagers 按 SIMULATE、ENABLED_VENDORS 与配置创建设备管理器，配置中关闭的厂商不创建
+func newManagers(cfg *config.Config) ([]vendorManager, error) {
+	simulate := os.Getenv("SIMULATE")
+	klog.Infof("Running in simulation mode: %s", simulate)
+
+	// 添加模拟管理器
+	if simulate != "" {
+		return []vendorManager{{vendor: "simulator", manager: device.NewSimulatorManager()}}, nil
+	}
+
+	vendors, err := selectVendors(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 真实环境下的设备管理器
+	var managers []vendorManager
+	if vendors["nvidia"] && cfg.Vendor("nvidia").IsEnabled() {
+		managers = append(managers, vendorManager{"nvidia", device.NewNVIDIAManagerWithConfig(cfg.Vendor("nvidia"))})
+	}
+	if vendors["huawei"] && cfg.Vendor("huawei").IsEnabled() {
+		// 开启 HUAWEI_VNPU 后将已切分的vNPU作为独立设备上报
+		var huaweiManager device.DeviceManager = device.NewHuaweiManager()
+		if os.Getenv("HUAWEI_VNPU") == "true" {
+			huaweiManager = device.NewHuaweiVNPUManager()
+		}
+		managers = append(managers, vendorManager{"huawei", huaweiManager})
+	}
+	if vendors["amd"] && cfg.Vendor("amd").IsEnabled() {
+		managers = append(managers, vendorManager{"amd", device.NewAMDManager()})
+	}
+	if len(managers) == 0 {
+		klog.Warning("No device vendor enabled, no device plugin will be started")
+	}
+	return managers, nil
+}
+
+// 子命令：serve（默认）启动插件，list 列出设备，mig-plan 打印MIG切分计划
 func main() {
 	klog.InitFlags(nil)
 	defer klog.Flush()
+	setupLogging()
+
+	command := "serve"
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+	}
+
+	// CONFIG_FILE 中的厂商配置，环境变量优先
+	cfg, err := config.FromEnv()
+	if err != nil {
+		klog.Fatalf("Failed to load config: %v", err)
+	}
+	applyLogVerbosity(cfg)
+
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "list":
+		managers, err := newManagers(cfg)
+		if err != nil {
+			klog.Fatalf("Failed to create device managers: %v", err)
+		}
+		os.Exit(listDevices(os.Stdout, managers))
+	case "mig-plan":
+		os.Exit(printMIGPlan(os.Stdout, device.NewNVIDIAManagerWithConfig(cfg.Vendor("nvidia"))))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of: serve, list, mig-plan\n", command)
+		os.Exit(2)
+	}
+}
 
+// serve 启动所有厂商的设备插件，直到收到终止信号
+func serve(cfg *config.Config) {
 	// 获取环境变量设置
-	simulate := os.Getenv("SIMULATE")
 	cdiEnabled := os.Getenv("CDI_ENABLED") == "true"
 	cdiPrefix := os.Getenv("CDI_PREFIX")
-	nodeName := os.Getenv("NODE_NAME")
 	if cdiPrefix == "" {
 		cdiPrefix = "micro.device" // 默认值
 	}
-	klog.Infof("Running in simulation mode: %s", simulate)
-
-	// 初始化设备管理器
-	var managers []struct {
-		vendor  string
-		manager device.DeviceManager
+	// 集群内运行时按节点筛选Pod、记录节点事件都依赖节点名
+	nodeName, err := resolveNodeName(os.Getenv("KUBERNETES_SERVICE_HOST") != "" || os.Getenv("KUBECONFIG") != "")
+	if err != nil {
+		klog.Fatalf("Failed to determine node name: %v", err)
 	}
 
-	// 添加模拟管理器
-	if simulate != "" {
-		managers = append(managers, struct {
-			vendor  string
-			manager device.DeviceManager
-		}{
-			vendor:  "simulator",
-			manager: &device.NVIDIAManager{},
-		})
-	} else {
-		// 真实环境下的设备管理器
-		managers = append(managers, struct {
-			vendor  string
-			manager device.DeviceManager
-		}{"nvidia", device.NewNVIDIAManager()})
-		managers = append(managers, struct {
-			vendor  string
-			manager device.DeviceManager
-		}{"huawei", &device.HuaweiManager{}})
+	// 初始化设备管理器
+	managers, err := newManagers(cfg)
+	if err != nil {
+		klog.Fatalf("Failed to create device managers: %v", err)
 	}
 
 	var servers []*deviceplugin.DevicePluginServer
+	var plugins []*deviceplugin.DevicePluginServer // 所有插件，包括启动失败的，用于就绪检查
 	var wg sync.WaitGroup
 	var serverMutex sync.Mutex
 
@@ -63,11 +226,12 @@ func main() {
 
 	// 为每个供应商启动插件
 	for _, m := range managers {
+		srv := deviceplugin.NewWithConfig(m.vendor, m.manager, cdiEnabled, cdiPrefix, nodeName, cfg.Vendor(m.vendor))
+		plugins = append(plugins, srv)
 		wg.Add(1)
-		go func(vendor string, manager device.DeviceManager) {
+		go func(vendor string, srv *deviceplugin.DevicePluginServer) {
 			defer wg.Done()
 
-			srv := deviceplugin.New(vendor, manager, cdiEnabled, cdiPrefix, nodeName)
 			if err := srv.Start(ctx); err != nil {
 				klog.Errorf("Failed to start %s device plugin: %v", vendor, err)
 				return
@@ -78,12 +242,33 @@ func main() {
 			serverMutex.Unlock()
 
 			// 后台运行健康检查
-			go srv.HealthCheck(ctx, 30*time.Second)
-		}(m.vendor, m.manager)
+			go srv.HealthCheck(ctx)
+		}(m.vendor, srv)
 	}
 
 	// 健康检查路由
+	// 所有插件注册到kubelet之前返回503
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		for _, srv := range plugins {
+			if !srv.Ready() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	http.Handle("/metrics", metrics.Handler())
+	// 只读调试接口：设备与分配状态
+	http.Handle("/devices", deviceplugin.DevicesHandler(plugins))
+	http.Handle("/allocations", deviceplugin.AllocationsHandler(plugins))
+	http.Handle("/allocations/report", deviceplugin.AllocationReportHandler(plugins))
+	// 节点维护：POST /drain 停止提供设备，已分配的容器不受影响
+	http.HandleFunc("/drain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		drainAll(plugins)
 		w.WriteHeader(http.StatusOK)
 	})
 	go func() {
@@ -93,10 +278,22 @@ func main() {
 	}()
 	klog.Info("Health check server started on :8080")
 
-	// 等待终止信号
+	// 等待终止信号，SIGHUP 时重新加载配置，SIGUSR1 时排空
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	<-signalChan
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1)
+	for sig := range signalChan {
+		if sig == syscall.SIGHUP {
+			klog.Info("Received SIGHUP, reloading configuration")
+			reloadConfig(plugins)
+			continue
+		}
+		if sig == syscall.SIGUSR1 {
+			klog.Info("Received SIGUSR1, draining device plugins")
+			drainAll(plugins)
+			continue
+		}
+		break
+	}
 	klog.Info("Received termination signal, shutting down...")
 
 	// 关闭所有插件
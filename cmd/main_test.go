@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"github.com/benyuereal/micro-device-plugin/pkg/deviceplugin"
+	"k8s.io/klog/v2"
+)
+
+// LOG_FORMAT=json 时每条日志是一个JSON对象，结构化字段作为独立键
+func TestSetupLoggingJSON(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr := os.Stderr
+	os.Stderr = w
+	t.Setenv("LOG_FORMAT", "json")
+	setupLogging()
+	os.Stderr = stderr
+	t.Cleanup(klog.ClearLogger)
+
+	klog.InfoS("Device allocated", "vendor", "nvidia", "device_id", "0")
+	klog.Flush()
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(out, &entry); err != nil {
+		t.Fatalf("log output %q is not a JSON object: %v", out, err)
+	}
+	for key, want := range map[string]string{"msg": "Device allocated", "vendor": "nvidia", "device_id": "0"} {
+		if entry[key] != want {
+			t.Errorf("log entry %s = %v, want %q", key, entry[key], want)
+		}
+	}
+}
+
+// reloadingManager 记录 Reload 收到的配置
+type reloadingManager struct {
+	*device.SimulatorManager
+	reloaded []config.VendorConfig
+}
+
+func (m *reloadingManager) Reload(cfg config.VendorConfig) { m.reloaded = append(m.reloaded, cfg) }
+
+// SIGHUP 时重新读取配置文件，将各厂商的配置交给对应插件，读取失败时保留当前配置
+func TestReloadConfig(t *testing.T) {
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("DEVICE_PLUGIN_PATH", t.TempDir())
+	t.Setenv("GPU_TEMP_THRESHOLD", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	t.Setenv("CONFIG_FILE", path)
+	if flag.Lookup("v") == nil {
+		klog.InitFlags(nil)
+	}
+	verbosity := flag.Lookup("v").Value.String()
+	t.Cleanup(func() { flag.Set("v", verbosity) })
+
+	manager := &reloadingManager{SimulatorManager: device.NewSimulatorManager()}
+	plugins := []*deviceplugin.DevicePluginServer{deviceplugin.New("nvidia", manager, false, "", "")}
+
+	if err := os.WriteFile(path, []byte("logVerbosity: 4\nvendors:\n  nvidia:\n    health:\n      tempThreshold: 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(plugins)
+	if len(manager.reloaded) != 1 || *manager.reloaded[0].Health.TempThreshold != 80 {
+		t.Fatalf("Reload() received %+v, want tempThreshold 80", manager.reloaded)
+	}
+	if got := flag.Lookup("v").Value.String(); got != "4" {
+		t.Fatalf("log verbosity = %s, want 4", got)
+	}
+
+	if err := os.WriteFile(path, []byte("vendors: ["), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloadConfig(plugins)
+	if len(manager.reloaded) != 1 {
+		t.Fatalf("invalid config file was applied: %+v", manager.reloaded[1:])
+	}
+}
+
+// NODE_NAME 优先，未设置时回退到主机名
+func TestResolveNodeName(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		t.Skipf("hostname unavailable: %v", err)
+	}
+	tests := []struct {
+		name     string
+		nodeName string
+		want     string
+	}{
+		{"from env", "node-1", "node-1"},
+		{"hostname fallback", "", hostname},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NODE_NAME", tt.nodeName)
+			for _, enabled := range []bool{true, false} {
+				got, err := resolveNodeName(enabled)
+				if err != nil {
+					t.Fatalf("resolveNodeName(%v) error = %v", enabled, err)
+				}
+				if got != tt.want {
+					t.Fatalf("resolveNodeName(%v) = %q, want %q", enabled, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// ENABLED_VENDORS 优先于自动探测，未知厂商报错；未设置时只启动存在管理工具的厂商
+func TestSelectVendors(t *testing.T) {
+	dir := t.TempDir()
+	nvidiaSmi := filepath.Join(dir, "nvidia-smi")
+	if err := os.WriteFile(nvidiaSmi, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing")
+	tests := []struct {
+		name     string
+		enabled  string
+		fallback string
+		smiPath  string
+		want     map[string]bool
+		wantErr  bool
+	}{
+		{"explicit list", " NVIDIA, amd,", "", missing, map[string]bool{"nvidia": true, "amd": true}, false},
+		{"unknown vendor", "nvidia,intel", "", nvidiaSmi, nil, true},
+		{"auto-detect", "", "", nvidiaSmi, map[string]bool{"nvidia": true}, false},
+		{"nothing detected", "", "", missing, map[string]bool{}, false},
+		{"simulator fallback", "", "true", missing, map[string]bool{"nvidia": true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLED_VENDORS", tt.enabled)
+			t.Setenv("ALLOW_SIMULATOR_FALLBACK", tt.fallback)
+			t.Setenv("NVIDIA_SMI_PATH", tt.smiPath)
+			t.Setenv("NPU_SMI_PATH", missing)
+			t.Setenv("ROCM_SMI_PATH", missing)
+			got, err := selectVendors(&config.Config{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectVendors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("selectVendors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,82 +2,193 @@ package allocator
 
 import (
 	"errors"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
 	"k8s.io/klog/v2"
 )
 
 // Allocator 设备资源分配器接口
 type Allocator interface {
 	Allocate(ids []string, podUID string) error // 增加podUID参数
-	Deallocate(ids []string)
+	Deallocate(ids []string, podUID string)     // 每个ID释放一次该Pod持有的分配
+	ReleasePod(podUID string) []string          // 释放Pod持有的全部分配，返回涉及的设备
 	GetAllocatedDevices() []string
 	CleanupOrphanedDevices(map[string]bool)
-	GetPodUID(deviceID string) string // 修改为 string 参数
-	GetAllocationMap() map[string]string
+	GetPodUIDs(deviceID string) []string // 共享同一设备的所有Pod
+	GetDevicesByPod(podUID string) []string
+	GetAllocationMap() map[string][]string
 	IsAvailable(id string) bool // 新增方法
+	// PreviewAllocation 尽力而为地挑选最多size个可用设备，不修改分配状态
+	PreviewAllocation(candidates []string, size int) []string
+	GetAllocationTime(deviceID string) (time.Time, bool) // 设备分配时间
+	// Preferred 按分组（如物理GPU）及分配策略挑选设备，required 中的设备总是包含在内
+	// 设备不足时返回已挑选的部分和 ErrInsufficientDevices
+	Preferred(available, required []device.GPUDevice, size int, groupOf func(d device.GPUDevice) string) ([]string, error)
+	Checkpoint() error // 将分配状态持久化到磁盘
+	Restore() error    // 从磁盘恢复分配状态
 }
 
 // SimpleAllocator 简单的内存分配器实现
 type SimpleAllocator struct {
 	mu          sync.RWMutex
-	allocated   map[string]bool   // 已分配设备ID
-	deviceToPod map[string]string // 新增：设备到 Pod 的映射
+	allocated   map[string]int            // 设备ID的当前分配次数，未分配的设备不在其中
+	podShares   map[string]map[string]int // 设备ID到各Pod持有的分配次数，次数之和等于 allocated
+	allocatedAt map[string]time.Time      // 设备最近一次分配的时间
+	clock       clock.Clock
+	strategy    AllocationStrategy // Preferred 跨分组的挑选策略
+	capacity    map[string]int     // 物理设备可同时分配的设备数
+	physicalOf  map[string]string  // 设备ID到物理设备ID的映射
+	maxPerID    int                // 单个设备ID可同时分配的次数，默认1（独占）
+
+	checkpointPath string // 检查点文件路径，为空时不持久化
 }
 
+// NewSimpleAllocator 创建独占分配的内存分配器，偏好分配默认使用 FirstFit
 func NewSimpleAllocator() *SimpleAllocator {
 	return &SimpleAllocator{
-		allocated:   make(map[string]bool),
-		deviceToPod: make(map[string]string),
+		allocated:   make(map[string]int),
+		podShares:   make(map[string]map[string]int),
+		allocatedAt: make(map[string]time.Time),
+		clock:       clock.RealClock{},
+		strategy:    FirstFit{},
+		capacity:    make(map[string]int),
+		physicalOf:  make(map[string]string),
+		maxPerID:    1,
 	}
 }
 
+// SetClock 替换时间来源，用于测试
+func (a *SimpleAllocator) SetClock(c clock.Clock) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.clock = c
+}
+
 // Allocate 分配设备资源
 func (a *SimpleAllocator) Allocate(ids []string, podUID string) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	// 首先检查所有设备是否可用
+	// 首先检查所有设备是否可用，同一ID在请求中出现多次时按次数计算
+	want := make(map[string]int, len(ids))
 	for _, id := range ids {
-		if _, exists := a.allocated[id]; exists {
+		want[id]++
+		if a.allocated[id]+want[id] > a.maxPerID {
 			return ErrDeviceAlreadyAllocated
 		}
 	}
-
-	// 然后分配设备
-	for _, id := range ids {
-		a.allocated[id] = true
-		klog.Infof("Device allocated: %s", id)
+	if err := a.checkCapacityLocked(ids); err != nil {
+		return err
 	}
 
+	// 然后分配设备；共享分配时分配时间记录最近一次分配
+	now := clock.OrReal(a.clock).Now()
 	for _, id := range ids {
-		a.allocated[id] = true
-		a.deviceToPod[id] = podUID // 记录设备到 Pod 的映射
-		klog.Infof("Device allocated: %s to pod %s", id, podUID)
+		a.allocated[id]++
+		if a.podShares[id] == nil {
+			a.podShares[id] = make(map[string]int)
+		}
+		a.podShares[id][podUID]++
+		a.allocatedAt[id] = now
+		klog.Infof("Device allocated: %s to pod %s (%d/%d)", id, podUID, a.allocated[id], a.maxPerID)
 	}
+	a.saveCheckpoint()
 
 	return nil
 }
 
-// 新增方法：获取设备对应的 Pod UID
-func (a *SimpleAllocator) GetPodUID(deviceID string) string {
+// GetPodUIDs 返回共享该设备的所有 Pod UID，按UID排序，未分配时为空
+func (a *SimpleAllocator) GetPodUIDs(deviceID string) []string {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	return a.deviceToPod[deviceID]
+	return sortedPods(a.podShares[deviceID])
+}
+
+// GetDevicesByPod 返回指定 Pod 占用的设备，按ID排序
+func (a *SimpleAllocator) GetDevicesByPod(podUID string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var devices []string
+	for id, shares := range a.podShares {
+		if shares[podUID] > 0 {
+			devices = append(devices, id)
+		}
+	}
+	sort.Strings(devices)
+	return devices
 }
 
-// Deallocate 释放设备资源
-func (a *SimpleAllocator) Deallocate(ids []string) {
+// Deallocate 释放设备资源，每个ID释放一次该 Pod 持有的分配，不影响共享该设备的其他 Pod；
+// 次数归零时设备变为未分配
+func (a *SimpleAllocator) Deallocate(ids []string, podUID string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	changed := false
 	for _, id := range ids {
-		if _, exists := a.allocated[id]; exists {
-			delete(a.allocated, id)
-			delete(a.deviceToPod, id) // 清理映射关系
-			klog.Infof("Device deallocated: %s", id)
+		if a.releaseLocked(id, podUID, 1) {
+			changed = true
 		}
 	}
+	if changed {
+		a.saveCheckpoint()
+	}
+}
+
+// ReleasePod 释放 Pod 在所有设备上持有的分配，返回涉及的设备，按ID排序
+func (a *SimpleAllocator) ReleasePod(podUID string) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var released []string
+	for id, shares := range a.podShares {
+		if count := shares[podUID]; count > 0 {
+			a.releaseLocked(id, podUID, count)
+			released = append(released, id)
+		}
+	}
+	if len(released) > 0 {
+		a.saveCheckpoint()
+	}
+	sort.Strings(released)
+	return released
+}
+
+// releaseLocked 释放 Pod 在设备上的 n 次分配，Pod 未持有该设备时返回false，调用方需持有锁
+func (a *SimpleAllocator) releaseLocked(id, podUID string, n int) bool {
+	shares := a.podShares[id]
+	if shares[podUID] == 0 {
+		return false
+	}
+	shares[podUID] -= n
+	if shares[podUID] <= 0 {
+		delete(shares, podUID)
+	}
+	a.allocated[id] -= n
+	if a.allocated[id] > 0 {
+		klog.Infof("Device deallocated: %s from pod %s (%d/%d)", id, podUID, a.allocated[id], a.maxPerID)
+		return true
+	}
+	delete(a.allocated, id)
+	delete(a.podShares, id)
+	delete(a.allocatedAt, id)
+	klog.Infof("Device deallocated: %s from pod %s", id, podUID)
+	return true
+}
+
+// sortedPods 返回持有分配的 Pod UID，按UID排序
+func sortedPods(shares map[string]int) []string {
+	pods := make([]string, 0, len(shares))
+	for podUID := range shares {
+		pods = append(pods, podUID)
+	}
+	sort.Strings(pods)
+	return pods
 }
 
 // GetAllocatedDevices 获取所有已分配设备
@@ -91,37 +202,116 @@ func (a *SimpleAllocator) GetAllocatedDevices() []string {
 	}
 	return devices
 }
+
+// CleanupOrphanedDevices 清除不在发现结果中的设备的分配及其 Pod 映射
 func (a *SimpleAllocator) CleanupOrphanedDevices(discoveredIDs map[string]bool) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	changed := false
 	for id := range a.allocated {
 		if !discoveredIDs[id] {
 			delete(a.allocated, id)
+			delete(a.podShares, id)
+			delete(a.allocatedAt, id)
 			klog.Warningf("Cleaned orphaned device: %s", id)
+			changed = true
 		}
 	}
+	if changed {
+		a.saveCheckpoint()
+	}
 }
 
-// GetAllocationMap 返回设备分配状态的副本
-func (a *SimpleAllocator) GetAllocationMap() map[string]string {
+// GetAllocationMap 返回设备到共享该设备的 Pod UID（按UID排序）的映射副本
+func (a *SimpleAllocator) GetAllocationMap() map[string][]string {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
 
-	// 返回深拷贝防止并发修改
-	result := make(map[string]string)
-	for k, v := range a.deviceToPod {
-		result[k] = v
+	result := make(map[string][]string, len(a.podShares))
+	for id, shares := range a.podShares {
+		result[id] = sortedPods(shares)
 	}
 	return result
 }
 
-// IsAvailable 检查设备是否可用（未被分配）
+// GetAllocationTime 返回设备的分配时间，未分配时返回false
+func (a *SimpleAllocator) GetAllocationTime(deviceID string) (time.Time, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	allocatedAt, exists := a.allocatedAt[deviceID]
+	return allocatedAt, exists
+}
+
+// IsAvailable 检查设备是否还能再分配一次（分配次数未达上限）
 func (a *SimpleAllocator) IsAvailable(deviceID string) bool {
 	a.mu.RLock()
 	defer a.mu.RUnlock()
-	_, exists := a.allocated[deviceID]
-	return !exists // 如果存在表示已分配，不可用
+	return a.allocated[deviceID] < a.maxPerID
+}
+
+// PreviewAllocation 按候选顺序挑选最多size个未分配设备（尽力而为）
+// 返回切片长度即可满足的数量，供偏好分配等预览路径使用；
+// kubelet 的 Allocate 仍走严格的全有或全无路径
+func (a *SimpleAllocator) PreviewAllocation(candidates []string, size int) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	selected := make([]string, 0, size)
+	seen := make(map[string]bool)
+	for _, id := range candidates {
+		if len(selected) >= size {
+			break
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if a.allocated[id] < a.maxPerID {
+			selected = append(selected, id)
+		}
+	}
+	if len(selected) < size {
+		klog.V(4).Infof("Preview allocation partially satisfied: %d of %d devices", len(selected), size)
+	}
+	return selected
+}
+
+// Preferred 先选入 required 设备，其余从未分配的 available 中交给分配策略挑选
+func (a *SimpleAllocator) Preferred(available, required []device.GPUDevice, size int, groupOf func(d device.GPUDevice) string) ([]string, error) {
+	selected := make([]string, 0, size)
+	chosen := make(map[string]bool)
+	for _, d := range required {
+		if !chosen[d.ID()] {
+			chosen[d.ID()] = true
+			selected = append(selected, d.ID())
+		}
+	}
+	if len(selected) >= size {
+		return selected, nil
+	}
+
+	// 过滤掉必须包含的和已分配的设备
+	var candidates []device.GPUDevice
+	a.mu.RLock()
+	for _, d := range available {
+		if !chosen[d.ID()] && a.allocated[d.ID()] < a.maxPerID {
+			chosen[d.ID()] = true
+			candidates = append(candidates, d)
+		}
+	}
+	a.mu.RUnlock()
+
+	picked, err := a.getStrategy().Select(candidates, AllocRequest{
+		Size:     size - len(selected),
+		Required: required,
+		GroupOf:  groupOf,
+	})
+	selected = append(selected, picked...)
+	if err != nil {
+		klog.V(4).Infof("Preferred allocation partially satisfied: %d of %d devices", len(selected), size)
+	}
+	return selected, err
 }
 
 // 错误定义
@@ -0,0 +1,156 @@
+package allocator
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 两个 Pod 共享同一设备ID时各自持有一份分配，释放其中一个不影响另一个
+func TestSharedDevicePerPod(t *testing.T) {
+	a := NewSimpleAllocator()
+	a.SetMaxPerID(2)
+	for _, pod := range []string{"pod-a", "pod-b"} {
+		if err := a.Allocate([]string{"0"}, pod); err != nil {
+			t.Fatalf("Allocate(0, %s) error = %v", pod, err)
+		}
+	}
+
+	steps := []struct {
+		name          string
+		release       func()
+		wantPods      []string
+		wantByPodB    []string
+		wantAvailable bool
+	}{
+		{"both pods hold the device", func() {}, []string{"pod-a", "pod-b"}, []string{"0"}, false},
+		{"release pod-a", func() { a.ReleasePod("pod-a") }, []string{"pod-b"}, []string{"0"}, true},
+		// 重复释放已释放的 Pod（如回收器每轮都发现其不活跃）不能扣减 pod-b 的分配
+		{"release pod-a again", func() { a.ReleasePod("pod-a") }, []string{"pod-b"}, []string{"0"}, true},
+		{"deallocate for another pod", func() { a.Deallocate([]string{"0"}, "pod-c") }, []string{"pod-b"}, []string{"0"}, true},
+		{"over-commit rejected", func() {
+			// pod-b 仍持有一份，只剩一个空位
+			if err := a.Allocate([]string{"0", "0"}, "pod-c"); err == nil {
+				t.Fatal("Allocate() over-committed a device after repeated releases")
+			}
+		}, []string{"pod-b"}, []string{"0"}, true},
+		{"release pod-b", func() { a.Deallocate([]string{"0"}, "pod-b") }, []string{}, nil, true},
+	}
+	for _, step := range steps {
+		step.release()
+		if got := a.GetPodUIDs("0"); !reflect.DeepEqual(got, step.wantPods) {
+			t.Fatalf("%s: GetPodUIDs(0) = %v, want %v", step.name, got, step.wantPods)
+		}
+		if got := a.GetDevicesByPod("pod-b"); !reflect.DeepEqual(got, step.wantByPodB) {
+			t.Fatalf("%s: GetDevicesByPod(pod-b) = %v, want %v", step.name, got, step.wantByPodB)
+		}
+		if got := a.IsAvailable("0"); got != step.wantAvailable {
+			t.Fatalf("%s: IsAvailable(0) = %v, want %v", step.name, got, step.wantAvailable)
+		}
+	}
+}
+
+// 孤儿设备的分配与 Pod 映射一并清除
+func TestCleanupOrphanedDevices(t *testing.T) {
+	a := NewSimpleAllocator()
+	if err := a.Allocate([]string{"0", "1"}, "pod-a"); err != nil {
+		t.Fatal(err)
+	}
+	a.CleanupOrphanedDevices(map[string]bool{"0": true})
+
+	if got, want := a.GetAllocationMap(), map[string][]string{"0": {"pod-a"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetAllocationMap() = %v, want %v", got, want)
+	}
+	if got, want := a.GetDevicesByPod("pod-a"), []string{"0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetDevicesByPod(pod-a) = %v, want %v", got, want)
+	}
+	if _, ok := a.GetAllocationTime("1"); ok || !a.IsAvailable("1") {
+		t.Fatal("orphaned device 1 is still allocated")
+	}
+}
+
+func TestIsAvailable(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxPerID  int
+		allocated []string // pod-a 持有的设备，可重复
+		id        string
+		want      bool
+	}{
+		{"free device", 1, nil, "0", true},
+		{"exclusive device allocated", 1, []string{"0"}, "0", false},
+		{"other device allocated", 1, []string{"1"}, "0", true},
+		{"shared below limit", 3, []string{"0", "0"}, "0", true},
+		{"shared at limit", 3, []string{"0", "0", "0"}, "0", false},
+		{"unknown device", 2, nil, "missing", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSimpleAllocator()
+			a.SetMaxPerID(tt.maxPerID)
+			if len(tt.allocated) > 0 {
+				if err := a.Allocate(tt.allocated, "pod-a"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := a.IsAvailable(tt.id); got != tt.want {
+				t.Fatalf("IsAvailable(%s) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// 预览只挑选可用设备，数量不足时返回能满足的部分，且不修改分配状态
+func TestPreviewAllocation(t *testing.T) {
+	a := NewSimpleAllocator()
+	if err := a.Allocate([]string{"1"}, "pod-a"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		candidates []string
+		size       int
+		want       []string
+	}{
+		{"skips allocated", []string{"0", "1", "2", "3"}, 2, []string{"0", "2"}},
+		{"partial", []string{"1", "2"}, 2, []string{"2"}},
+		{"duplicates counted once", []string{"0", "0", "2"}, 3, []string{"0", "2"}},
+		{"nothing available", []string{"1"}, 1, []string{}},
+		{"zero size", []string{"0"}, 0, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.PreviewAllocation(tt.candidates, tt.size); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("PreviewAllocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := a.GetAllocatedDevices(); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("GetAllocatedDevices() = %v after previews, want [1]", got)
+	}
+}
+
+// GetDevicesByPod 只返回该 Pod 持有的设备并按ID排序
+func TestGetDevicesByPod(t *testing.T) {
+	a := NewSimpleAllocator()
+	a.SetMaxPerID(2)
+	for pod, ids := range map[string][]string{"pod-a": {"3", "0", "1"}, "pod-b": {"1", "2"}} {
+		if err := a.Allocate(ids, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a.Deallocate([]string{"0"}, "pod-a")
+
+	tests := []struct {
+		pod  string
+		want []string
+	}{
+		{"pod-a", []string{"1", "3"}},
+		{"pod-b", []string{"1", "2"}},
+		{"unknown", nil},
+	}
+	for _, tt := range tests {
+		if got := a.GetDevicesByPod(tt.pod); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetDevicesByPod(%s) = %v, want %v", tt.pod, got, tt.want)
+		}
+	}
+}
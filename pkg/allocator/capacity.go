@@ -0,0 +1,79 @@
+package allocator
+
+import (
+	"errors"
+
+	"k8s.io/klog/v2"
+)
+
+// ErrCapacityExceeded 分配会使物理GPU上占用的设备数超过其容量
+var ErrCapacityExceeded = errors.New("physical device capacity exceeded")
+
+// SetCapacity 设置物理设备（如GPU）可同时分配的设备数，n<=0 表示不限制
+func (a *SimpleAllocator) SetCapacity(physicalID string, n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 {
+		delete(a.capacity, physicalID)
+		return
+	}
+	a.capacity[physicalID] = n
+}
+
+// SetCapacities 用发现结果整体替换各物理设备的容量，不在其中的物理设备（如已消失的GPU）不再限制
+func (a *SimpleAllocator) SetCapacities(capacity map[string]int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.capacity = make(map[string]int, len(capacity))
+	for physicalID, n := range capacity {
+		if n > 0 {
+			a.capacity[physicalID] = n
+		}
+	}
+}
+
+// SetMaxPerID 设置单个设备ID可同时分配的次数（时间片共享或超卖场景），n<=0 时恢复为1（独占）
+func (a *SimpleAllocator) SetMaxPerID(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 {
+		n = 1
+	}
+	a.maxPerID = n
+}
+
+// SetPhysicalIDs 替换设备ID到所属物理设备的映射，由发现结果提供
+func (a *SimpleAllocator) SetPhysicalIDs(physicalOf map[string]string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.physicalOf = make(map[string]string, len(physicalOf))
+	for id, physicalID := range physicalOf {
+		a.physicalOf[id] = physicalID
+	}
+}
+
+// checkCapacityLocked 检查分配ids后各物理设备的占用数是否超出容量，调用方需持有锁
+func (a *SimpleAllocator) checkCapacityLocked(ids []string) error {
+	if len(a.capacity) == 0 {
+		return nil
+	}
+	inUse := make(map[string]int)
+	for id, count := range a.allocated {
+		if physicalID, ok := a.physicalOf[id]; ok {
+			inUse[physicalID] += count
+		}
+	}
+	for _, id := range ids {
+		physicalID, ok := a.physicalOf[id]
+		if !ok {
+			continue
+		}
+		inUse[physicalID]++
+		// 每个设备ID可共享 maxPerID 次，容量按设备数同比放大
+		if limit, ok := a.capacity[physicalID]; ok && inUse[physicalID] > limit*a.maxPerID {
+			klog.Warningf("Allocating %v would use %d devices on %s, capacity is %d", ids, inUse[physicalID], physicalID, limit)
+			return ErrCapacityExceeded
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package allocator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCapacity(t *testing.T) {
+	physicalOf := map[string]string{"mig-0": "gpu0", "mig-1": "gpu0", "mig-dup": "gpu0", "mig-2": "gpu1"}
+	tests := []struct {
+		name      string
+		capacity  map[string]int
+		maxPerID  int
+		allocated []string
+		request   []string
+		wantErr   error
+	}{
+		{"within capacity", map[string]int{"gpu0": 2}, 1, []string{"mig-0"}, []string{"mig-1"}, nil},
+		{"double-reported slice", map[string]int{"gpu0": 2}, 1, []string{"mig-0", "mig-1"}, []string{"mig-dup"}, ErrCapacityExceeded},
+		{"single request over capacity", map[string]int{"gpu0": 2}, 1, nil, []string{"mig-0", "mig-1", "mig-dup"}, ErrCapacityExceeded},
+		{"shared IDs scale capacity", map[string]int{"gpu0": 1}, 2, []string{"mig-0"}, []string{"mig-1"}, nil},
+		{"other GPU unaffected", map[string]int{"gpu0": 2}, 1, []string{"mig-0", "mig-1"}, []string{"mig-2"}, nil},
+		{"no capacity means unlimited", nil, 1, []string{"mig-0", "mig-1"}, []string{"mig-dup"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSimpleAllocator()
+			a.SetMaxPerID(tt.maxPerID)
+			a.SetPhysicalIDs(physicalOf)
+			a.SetCapacities(tt.capacity)
+			if len(tt.allocated) > 0 {
+				if err := a.Allocate(tt.allocated, "pod-a"); err != nil {
+					t.Fatalf("Allocate(%v) error = %v", tt.allocated, err)
+				}
+			}
+			err := a.Allocate(tt.request, "pod-b")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Allocate(%v) error = %v, want %v", tt.request, err, tt.wantErr)
+			}
+			if err != nil && len(a.GetPodUIDs(tt.request[0])) > 0 {
+				t.Fatalf("rejected allocation left %s allocated", tt.request[0])
+			}
+		})
+	}
+}
+
+// 每次同步整体替换容量，已消失的GPU不再保留旧的容量
+func TestSetCapacitiesReplaces(t *testing.T) {
+	a := NewSimpleAllocator()
+	a.SetPhysicalIDs(map[string]string{"a": "gpu0", "b": "gpu0"})
+	a.SetCapacities(map[string]int{"gpu0": 1, "gpu1": 1})
+	a.SetCapacities(map[string]int{"gpu1": 1})
+	if err := a.Allocate([]string{"a", "b"}, "pod"); err != nil {
+		t.Fatalf("Allocate() error = %v after gpu0 capacity was removed", err)
+	}
+}
@@ -0,0 +1,119 @@
+package allocator
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// checkpointEntry 单个设备的持久化分配记录
+type checkpointEntry struct {
+	PodUID      string         `json:"podUID"` // 仅一个Pod持有时填写，兼容旧格式
+	AllocatedAt time.Time      `json:"allocatedAt"`
+	Count       int            `json:"count,omitempty"` // 分配次数，旧格式缺省为1
+	Pods        map[string]int `json:"pods,omitempty"`  // 各Pod持有的分配次数，旧格式缺省为 PodUID 持有全部
+}
+
+// checkpointData 检查点文件内容
+type checkpointData struct {
+	Devices map[string]checkpointEntry `json:"devices"`
+}
+
+// SetCheckpointPath 设置检查点文件路径，设置后每次分配状态变化都会写入磁盘
+func (a *SimpleAllocator) SetCheckpointPath(path string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.checkpointPath = path
+}
+
+// Checkpoint 将当前分配状态写入检查点文件，未设置路径时不做任何事
+func (a *SimpleAllocator) Checkpoint() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.checkpointLocked()
+}
+
+// checkpointLocked 调用方需持有锁；先写临时文件再重命名，避免写到一半时重启留下损坏的文件
+func (a *SimpleAllocator) checkpointLocked() error {
+	if a.checkpointPath == "" {
+		return nil
+	}
+
+	data := checkpointData{Devices: make(map[string]checkpointEntry, len(a.allocated))}
+	for id, count := range a.allocated {
+		entry := checkpointEntry{AllocatedAt: a.allocatedAt[id], Count: count, Pods: a.podShares[id]}
+		if len(entry.Pods) == 1 {
+			entry.PodUID = sortedPods(entry.Pods)[0]
+		}
+		data.Devices[id] = entry
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.checkpointPath), 0755); err != nil {
+		return fmt.Errorf("failed to create checkpoint directory: %v", err)
+	}
+	tmp := a.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	if err := os.Rename(tmp, a.checkpointPath); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %v", err)
+	}
+	return nil
+}
+
+// saveCheckpoint 分配状态变化后写入检查点，失败只记录日志
+func (a *SimpleAllocator) saveCheckpoint() {
+	if err := a.checkpointLocked(); err != nil {
+		klog.Errorf("Failed to checkpoint allocations to %s: %v", a.checkpointPath, err)
+	}
+}
+
+// Restore 从检查点文件恢复分配状态，文件不存在时视为空
+func (a *SimpleAllocator) Restore() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.checkpointPath == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(a.checkpointPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+
+	var data checkpointData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("failed to decode checkpoint %s: %v", a.checkpointPath, err)
+	}
+	for id, entry := range data.Devices {
+		shares := make(map[string]int)
+		for podUID, count := range entry.Pods {
+			if count > 0 {
+				shares[podUID] = count
+			}
+		}
+		if len(shares) == 0 {
+			shares[entry.PodUID] = max(entry.Count, 1)
+		}
+		total := 0
+		for _, count := range shares {
+			total += count
+		}
+		a.allocated[id] = total
+		a.podShares[id] = shares
+		a.allocatedAt[id] = entry.AllocatedAt
+	}
+	klog.Infof("Restored %d device allocations from %s", len(data.Devices), a.checkpointPath)
+	return nil
+}
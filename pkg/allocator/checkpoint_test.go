@@ -0,0 +1,99 @@
+package allocator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxPerID int
+		allocs   map[string][]string // Pod UID 到分配的设备
+		release  []string
+	}{
+		{"empty", 1, nil, nil},
+		{"exclusive", 1, map[string][]string{"pod-a": {"0", "1"}, "pod-b": {"2"}}, nil},
+		{"after release", 1, map[string][]string{"pod-a": {"0", "1"}}, []string{"1"}},
+		{"shared device", 2, map[string][]string{"pod-a": {"0"}, "pod-b": {"0"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "allocations.json")
+			fakeClock := clock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			a := NewSimpleAllocator()
+			a.SetClock(fakeClock)
+			a.SetMaxPerID(tt.maxPerID)
+			a.SetCheckpointPath(path)
+			for _, pod := range []string{"pod-a", "pod-b"} {
+				if ids, ok := tt.allocs[pod]; ok {
+					if err := a.Allocate(ids, pod); err != nil {
+						t.Fatalf("Allocate(%v) error = %v", ids, err)
+					}
+					fakeClock.Step(time.Minute)
+				}
+			}
+			a.Deallocate(tt.release, "pod-a")
+			if err := a.Checkpoint(); err != nil {
+				t.Fatalf("Checkpoint() error = %v", err)
+			}
+
+			restored := NewSimpleAllocator()
+			restored.SetMaxPerID(tt.maxPerID)
+			restored.SetCheckpointPath(path)
+			if err := restored.Restore(); err != nil {
+				t.Fatalf("Restore() error = %v", err)
+			}
+			if got, want := restored.GetAllocationMap(), a.GetAllocationMap(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("restored allocation map = %v, want %v", got, want)
+			}
+			for _, id := range a.GetAllocatedDevices() {
+				want, _ := a.GetAllocationTime(id)
+				if got, _ := restored.GetAllocationTime(id); !got.Equal(want) {
+					t.Fatalf("restored allocation time of %s = %v, want %v", id, got, want)
+				}
+				if got, want := restored.IsAvailable(id), a.IsAvailable(id); got != want {
+					t.Fatalf("restored IsAvailable(%s) = %v, want %v", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string // 空表示不创建文件
+		wantErr bool
+		want    map[string][]string
+	}{
+		{"missing file", "", false, map[string][]string{}},
+		{"legacy entry without count", `{"devices":{"0":{"podUID":"pod-a","allocatedAt":"2024-01-01T00:00:00Z"}}}`, false, map[string][]string{"0": {"pod-a"}}},
+		{"shared entry", `{"devices":{"0":{"podUID":"","count":2,"pods":{"pod-a":1,"pod-b":1}}}}`, false, map[string][]string{"0": {"pod-a", "pod-b"}}},
+		{"corrupt file", `{"devices":`, true, map[string][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "allocations.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			a := NewSimpleAllocator()
+			a.SetCheckpointPath(path)
+			if err := a.Restore(); (err != nil) != tt.wantErr {
+				t.Fatalf("Restore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := a.GetAllocationMap(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("allocation map = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package allocator
+
+import (
+	"fmt"
+)
+
+// Policy 分配策略名称，对应一个内置的 AllocationStrategy
+type Policy string
+
+const (
+	// PolicyPack 尽量集中到少数分组，为整卡需求保留空闲GPU
+	PolicyPack Policy = "pack"
+	// PolicySpread 尽量分散到不同分组，让各Pod独占物理GPU以减少干扰
+	PolicySpread Policy = "spread"
+	// PolicyFirstFit 按kubelet给出的顺序依次挑选，不考虑分组
+	PolicyFirstFit Policy = "first-fit"
+)
+
+// ParsePolicy 解析策略名称，空字符串使用 pack
+func ParsePolicy(name string) (Policy, error) {
+	switch Policy(name) {
+	case "", PolicyPack:
+		return PolicyPack, nil
+	case PolicySpread, PolicyFirstFit:
+		return Policy(name), nil
+	default:
+		return "", fmt.Errorf("unknown allocation policy %q, expected %q, %q or %q",
+			name, PolicyPack, PolicySpread, PolicyFirstFit)
+	}
+}
+
+// SetPolicy 使用内置策略
+func (a *SimpleAllocator) SetPolicy(p Policy) {
+	a.SetStrategy(StrategyFor(p))
+}
+
+// SetStrategy 设置 Preferred 使用的分配策略，传入 nil 时恢复默认的 FirstFit
+func (a *SimpleAllocator) SetStrategy(s AllocationStrategy) {
+	if s == nil {
+		s = FirstFit{}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.strategy = s
+}
+
+func (a *SimpleAllocator) getStrategy() AllocationStrategy {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.strategy
+}
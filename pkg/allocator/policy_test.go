@@ -0,0 +1,53 @@
+package allocator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Policy
+		wantErr bool
+	}{
+		{"", PolicyPack, false},
+		{"pack", PolicyPack, false},
+		{"spread", PolicySpread, false},
+		{"first-fit", PolicyFirstFit, false},
+		{"Spread", "", true},
+		{"random", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParsePolicy(%q) = %q, %v, want %q, wantErr %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// 按策略在物理GPU之间集中或分散挑选设备
+func TestSetPolicy(t *testing.T) {
+	available := devicesOf("a0", "b0", "c0", "a1", "c1", "a2")
+	tests := []struct {
+		policy Policy
+		want   []string
+	}{
+		{PolicyPack, []string{"c0", "c1"}},
+		{PolicySpread, []string{"a0", "c0"}},
+		{PolicyFirstFit, []string{"a0", "b0"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			a := NewSimpleAllocator()
+			a.SetPolicy(tt.policy)
+			got, err := a.Preferred(available, nil, 2, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Preferred() with %s = %v, want %v", tt.policy, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package allocator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+)
+
+// ErrInsufficientDevices 空闲设备不足以满足请求
+var ErrInsufficientDevices = errors.New("insufficient available devices")
+
+// AllocRequest 一次偏好分配中交给策略的需求
+type AllocRequest struct {
+	Size     int                             // 还需挑选的设备数，不含 Required
+	Required []device.GPUDevice              // 已选入的必须包含的设备，策略据此判断其所在分组
+	GroupOf  func(d device.GPUDevice) string // 设备所属分组（如NUMA节点/物理GPU），为空时按物理GPU
+}
+
+// groupOf 返回设备所属的分组
+func (r AllocRequest) groupOf(d device.GPUDevice) string {
+	if r.GroupOf == nil {
+		return d.PhysicalID()
+	}
+	return r.GroupOf(d)
+}
+
+// AllocationStrategy 从空闲设备中挑选设备的策略
+// available 已排除 Required 和已分配的设备；设备不足时返回已挑选的部分和 ErrInsufficientDevices
+type AllocationStrategy interface {
+	Name() Policy
+	Select(available []device.GPUDevice, req AllocRequest) ([]string, error)
+}
+
+// checkSize 挑选数量不足时附带 ErrInsufficientDevices
+func checkSize(selected []string, req AllocRequest) ([]string, error) {
+	if len(selected) < req.Size {
+		return selected, fmt.Errorf("%w: %d of %d devices", ErrInsufficientDevices, len(selected), req.Size)
+	}
+	return selected, nil
+}
+
+// StrategyFor 返回策略名称对应的内置策略，未知名称使用 pack
+func StrategyFor(p Policy) AllocationStrategy {
+	switch p {
+	case PolicySpread:
+		return Spread{}
+	case PolicyFirstFit:
+		return FirstFit{}
+	default:
+		return BinPack{}
+	}
+}
+
+// FirstFit 按候选顺序挑选，不考虑分组
+type FirstFit struct{}
+
+func (FirstFit) Name() Policy { return PolicyFirstFit }
+
+func (FirstFit) Select(available []device.GPUDevice, req AllocRequest) ([]string, error) {
+	if len(available) > req.Size {
+		available = available[:req.Size]
+	}
+	selected := make([]string, len(available))
+	for i, d := range available {
+		selected[i] = d.ID()
+	}
+	return checkSize(selected, req)
+}
+
+// BinPack 装箱策略：优先选择已包含 required 设备的分组，
+// 其余按“能容纳剩余需求的最小分组”挑选以减少碎片，
+// 没有单个分组能容纳时从最大的分组开始，尽量少跨分组
+type BinPack struct{}
+
+func (BinPack) Name() Policy { return PolicyPack }
+
+func (BinPack) Select(available []device.GPUDevice, req AllocRequest) ([]string, error) {
+	keys, groups, requiredGroups := groupDevices(available, req)
+
+	var selected []string
+	for len(selected) < req.Size && len(keys) > 0 {
+		remaining := req.Size - len(selected)
+		best := pickGroup(keys, groups, requiredGroups, remaining)
+
+		for _, id := range groups[best] {
+			if len(selected) >= req.Size {
+				break
+			}
+			selected = append(selected, id)
+		}
+		keys = removeKey(keys, best)
+	}
+	return checkSize(selected, req)
+}
+
+// Spread 轮流从各分组各取一个设备，空闲设备最多的分组优先，
+// 已包含 required 设备的分组排在最后，避免与其共享物理GPU
+type Spread struct{}
+
+func (Spread) Name() Policy { return PolicySpread }
+
+func (Spread) Select(available []device.GPUDevice, req AllocRequest) ([]string, error) {
+	keys, groups, requiredGroups := groupDevices(available, req)
+	sort.SliceStable(keys, func(i, j int) bool {
+		if requiredGroups[keys[i]] != requiredGroups[keys[j]] {
+			return !requiredGroups[keys[i]]
+		}
+		return len(groups[keys[i]]) > len(groups[keys[j]])
+	})
+
+	var selected []string
+	for round := 0; len(selected) < req.Size; round++ {
+		picked := false
+		for _, key := range keys {
+			if len(selected) >= req.Size {
+				break
+			}
+			if round < len(groups[key]) {
+				selected = append(selected, groups[key][round])
+				picked = true
+			}
+		}
+		if !picked {
+			break
+		}
+	}
+	return checkSize(selected, req)
+}
+
+// groupDevices 按分组整理候选设备，分组名与组内设备均排序以保证结果稳定
+func groupDevices(available []device.GPUDevice, req AllocRequest) ([]string, map[string][]string, map[string]bool) {
+	groups := make(map[string][]string)
+	for _, d := range available {
+		key := req.groupOf(d)
+		groups[key] = append(groups[key], d.ID())
+	}
+	requiredGroups := make(map[string]bool)
+	for _, d := range req.Required {
+		requiredGroups[req.groupOf(d)] = true
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key, ids := range groups {
+		sort.Strings(ids)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, groups, requiredGroups
+}
+
+// pickGroup 选出下一个要使用的分组
+func pickGroup(keys []string, groups map[string][]string, requiredGroups map[string]bool, remaining int) string {
+	best := ""
+	for _, key := range keys {
+		if requiredGroups[key] {
+			return key
+		}
+		if best == "" {
+			best = key
+			continue
+		}
+		bestSize, size := len(groups[best]), len(groups[key])
+		bestFits, fits := bestSize >= remaining, size >= remaining
+		switch {
+		case fits && !bestFits:
+			best = key
+		case fits && bestFits && size < bestSize:
+			best = key
+		case !fits && !bestFits && size > bestSize:
+			best = key
+		}
+	}
+	return best
+}
+
+func removeKey(keys []string, key string) []string {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
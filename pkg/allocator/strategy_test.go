@@ -0,0 +1,113 @@
+package allocator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+)
+
+// fakeDevice 只提供ID与物理GPU的设备
+type fakeDevice struct {
+	id, physicalID string
+}
+
+func (d fakeDevice) ID() string                    { return d.id }
+func (d fakeDevice) IsHealthy() bool               { return true }
+func (d fakeDevice) GetVendor() string             { return "fake" }
+func (d fakeDevice) GetPath() string               { return "" }
+func (d fakeDevice) IsMIG() bool                   { return true }
+func (d fakeDevice) PhysicalID() string            { return d.physicalID }
+func (d fakeDevice) Attributes() map[string]string { return nil }
+
+// testDevices gpu0 上有 a0-a2，gpu1 上有 b0，gpu2 上有 c0-c1，按交错顺序排列
+var testDevices = map[string]device.GPUDevice{
+	"a0": fakeDevice{"a0", "gpu0"},
+	"a1": fakeDevice{"a1", "gpu0"},
+	"a2": fakeDevice{"a2", "gpu0"},
+	"b0": fakeDevice{"b0", "gpu1"},
+	"c0": fakeDevice{"c0", "gpu2"},
+	"c1": fakeDevice{"c1", "gpu2"},
+}
+
+func devicesOf(ids ...string) []device.GPUDevice {
+	devices := make([]device.GPUDevice, len(ids))
+	for i, id := range ids {
+		devices[i] = testDevices[id]
+	}
+	return devices
+}
+
+func TestStrategySelect(t *testing.T) {
+	available := devicesOf("a0", "b0", "c0", "a1", "c1", "a2")
+	tests := []struct {
+		name      string
+		strategy  AllocationStrategy
+		available []device.GPUDevice
+		required  []device.GPUDevice
+		size      int
+		want      []string
+		wantErr   error
+	}{
+		{"first-fit keeps candidate order", FirstFit{}, available, nil, 2, []string{"a0", "b0"}, nil},
+		{"first-fit insufficient", FirstFit{}, available, nil, 7, []string{"a0", "b0", "c0", "a1", "c1", "a2"}, ErrInsufficientDevices},
+		{"pack smallest fitting GPU", BinPack{}, available, nil, 2, []string{"c0", "c1"}, nil},
+		{"pack largest GPU first when none fits", BinPack{}, available, nil, 4, []string{"a0", "a1", "a2", "b0"}, nil},
+		{"pack next to required", BinPack{}, devicesOf("a0", "b0", "c0", "a1", "a2"), devicesOf("c1"), 1, []string{"c0"}, nil},
+		{"pack insufficient", BinPack{}, available, nil, 7, []string{"a0", "a1", "a2", "c0", "c1", "b0"}, ErrInsufficientDevices},
+		{"spread across GPUs", Spread{}, available, nil, 3, []string{"a0", "c0", "b0"}, nil},
+		{"spread away from required", Spread{}, devicesOf("a0", "b0", "c0", "a1", "a2"), devicesOf("c1"), 2, []string{"a0", "b0"}, nil},
+		{"spread insufficient", Spread{}, devicesOf("a0", "b0"), nil, 3, []string{"a0", "b0"}, ErrInsufficientDevices},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Select(tt.available, AllocRequest{Size: tt.size, Required: tt.required})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Select() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferred(t *testing.T) {
+	available := devicesOf("a0", "b0", "c0", "a1", "c1", "a2")
+	tests := []struct {
+		name      string
+		strategy  AllocationStrategy // nil 表示默认策略
+		allocated []string
+		required  []device.GPUDevice
+		size      int
+		want      []string
+		wantErr   error
+	}{
+		{"defaults to first-fit", nil, nil, nil, 2, []string{"a0", "b0"}, nil},
+		{"skips allocated devices", nil, []string{"a0"}, nil, 2, []string{"b0", "c0"}, nil},
+		{"required first", BinPack{}, nil, devicesOf("c1"), 2, []string{"c1", "c0"}, nil},
+		{"required alone satisfies", nil, nil, devicesOf("a2"), 1, []string{"a2"}, nil},
+		{"insufficient", nil, []string{"a0", "a1", "a2"}, nil, 4, []string{"b0", "c0", "c1"}, ErrInsufficientDevices},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewSimpleAllocator()
+			if tt.strategy != nil {
+				a.SetStrategy(tt.strategy)
+			}
+			if len(tt.allocated) > 0 {
+				if err := a.Allocate(tt.allocated, "pod-a"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := a.Preferred(available, tt.required, tt.size, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Preferred() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Preferred() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
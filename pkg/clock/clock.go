@@ -0,0 +1,60 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时间来源接口，替代直接调用 time.Now() 以便测试中精确控制时间
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+}
+
+// RealClock 使用系统时间
+type RealClock struct{}
+
+func (RealClock) Now() time.Time                  { return time.Now() }
+func (RealClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// FakeClock 手动推进的时钟，用于确定性测试
+type FakeClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+func (c *FakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+// Step 将时钟向前推进 d
+func (c *FakeClock) Step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetTime 将时钟设置为指定时间
+func (c *FakeClock) SetTime(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// OrReal 未注入时钟时退化为系统时间
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return RealClock{}
+	}
+	return c
+}
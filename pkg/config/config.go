@@ -0,0 +1,183 @@
+// Package config 加载插件配置文件（CONFIG_FILE），按厂商分节。
+// 配置文件支持YAML或JSON，环境变量优先于文件中的值，均未设置时使用各组件的默认值。
+//
+// 示例:
+//
+//	logVerbosity: 2
+//	vendors:
+//	  nvidia:
+//	    resourceName: nvidia.com/microgpu
+//	    smiPath: /host-driver/nvidia-smi
+//	    cacheTTL: 5s
+//	    health:
+//	      tempThreshold: 90
+//	    mig:
+//	      enabled: true
+//	      profile: 3g.20gb
+//	      instanceCount: 2
+//	  amd:
+//	    enabled: false
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Config 配置文件内容，键为厂商名（nvidia、huawei、amd、simulator）
+type Config struct {
+	LogVerbosity *int                    `json:"logVerbosity,omitempty"` // klog 日志级别，对应 -v
+	Vendors      map[string]VendorConfig `json:"vendors,omitempty"`
+}
+
+// VendorConfig 单个厂商的配置，零值字段表示未设置
+type VendorConfig struct {
+	Enabled      *bool        `json:"enabled,omitempty"`      // false 时不启动该厂商的插件
+	ResourceName string       `json:"resourceName,omitempty"` // 整卡资源名，对应 RESOURCE_NAME_<VENDOR>
+	SmiPath      string       `json:"smiPath,omitempty"`      // nvidia-smi 路径，对应 NVIDIA_SMI_PATH，仅NVIDIA使用
+	CacheTTL     *Duration    `json:"cacheTTL,omitempty"`     // 发现结果缓存时间，对应 DISCOVERY_CACHE_TTL
+	MIG          MIGConfig    `json:"mig,omitempty"`
+	Health       HealthConfig `json:"health,omitempty"`
+}
+
+// HealthConfig 健康检查阈值，仅NVIDIA使用
+type HealthConfig struct {
+	ECCThreshold  *uint64 `json:"eccThreshold,omitempty"`  // 对应 ECC_UNCORRECTED_THRESHOLD
+	TempThreshold *uint64 `json:"tempThreshold,omitempty"` // 对应 GPU_TEMP_THRESHOLD，0表示不检查
+}
+
+// MIGConfig MIG切分配置，仅NVIDIA使用
+type MIGConfig struct {
+	Enabled        *bool  `json:"enabled,omitempty"`        // 对应 ENABLE_MIG
+	Profile        string `json:"profile,omitempty"`        // 对应 MIG_PROFILE
+	InstanceCount  int    `json:"instanceCount,omitempty"`  // 对应 MIG_INSTANCE_COUNT，0表示自动计算
+	SkipConfigured *bool  `json:"skipConfigured,omitempty"` // 对应 SKIP_CONFIGURED
+}
+
+// Duration 以 "30s"、"1m" 等字符串表示的时长
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	value, err := strconv.Unquote(string(data))
+	if err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %s", data)
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if parsed < 0 {
+		return fmt.Errorf("duration must not be negative: %s", value)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+// Load 读取配置文件，未知字段视为错误以便尽早发现拼写错误
+func Load(path string) (*Config, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	return Parse(raw)
+}
+
+// Parse 解析YAML或JSON格式的配置
+func Parse(raw []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(raw, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %v", err)
+	}
+	return cfg, nil
+}
+
+// FromEnv 加载 CONFIG_FILE 指定的配置文件，未设置时返回空配置
+func FromEnv() (*Config, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return &Config{}, nil
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("Loaded config file %s", path)
+	return cfg, nil
+}
+
+// Vendor 返回厂商配置，并以环境变量覆盖文件中的值
+func (c *Config) Vendor(vendor string) VendorConfig {
+	var vc VendorConfig
+	if c != nil {
+		vc = c.Vendors[vendor]
+	}
+
+	if value := os.Getenv("RESOURCE_NAME_" + strings.ToUpper(vendor)); value != "" {
+		vc.ResourceName = value
+	}
+	if value := os.Getenv("NVIDIA_SMI_PATH"); value != "" && vendor == "nvidia" {
+		vc.SmiPath = value
+	}
+	if value := os.Getenv("DISCOVERY_CACHE_TTL"); value != "" {
+		if ttl, err := time.ParseDuration(value); err == nil && ttl >= 0 {
+			vc.CacheTTL = &Duration{ttl}
+		} else {
+			klog.Warningf("Invalid DISCOVERY_CACHE_TTL %q, ignoring", value)
+		}
+	}
+
+	if value := os.Getenv("ENABLE_MIG"); value != "" {
+		enabled := value == "true"
+		vc.MIG.Enabled = &enabled
+	}
+	if value := os.Getenv("MIG_PROFILE"); value != "" {
+		vc.MIG.Profile = value
+	}
+	if value := os.Getenv("MIG_INSTANCE_COUNT"); value != "" {
+		if count, err := strconv.Atoi(value); err == nil {
+			vc.MIG.InstanceCount = count
+		}
+	}
+	if value := os.Getenv("SKIP_CONFIGURED"); value != "" {
+		skip := value == "true"
+		vc.MIG.SkipConfigured = &skip
+	}
+	if threshold, ok := uint64Env("ECC_UNCORRECTED_THRESHOLD"); ok {
+		vc.Health.ECCThreshold = &threshold
+	}
+	if threshold, ok := uint64Env("GPU_TEMP_THRESHOLD"); ok {
+		vc.Health.TempThreshold = &threshold
+	}
+	return vc
+}
+
+// uint64Env 解析无符号整数环境变量，未设置或无效时返回false
+func uint64Env(key string) (uint64, bool) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, false
+	}
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		klog.Warningf("Invalid %s %q, ignoring", key, value)
+		return 0, false
+	}
+	return parsed, true
+}
+
+// IsEnabled 未显式关闭的厂商视为启用
+func (vc VendorConfig) IsEnabled() bool {
+	return vc.Enabled == nil || *vc.Enabled
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+logVerbosity: 2
+vendors:
+  nvidia:
+    resourceName: example.com/gpu
+    cacheTTL: 5s
+    health:
+      tempThreshold: 85
+    mig:
+      profile: 1g.10gb
+  amd:
+    enabled: false
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"yaml", testConfig, false},
+		{"json", `{"vendors": {"huawei": {"cacheTTL": "1m"}}}`, false},
+		{"empty", "", false},
+		{"unknown field", "vendors:\n  nvidia:\n    resourceNmae: example.com/gpu\n", true},
+		{"numeric duration", "vendors:\n  nvidia:\n    cacheTTL: 5\n", true},
+		{"negative duration", "vendors:\n  nvidia:\n    cacheTTL: -5s\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.raw)); (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 环境变量优先于配置文件，均未设置的字段保持零值
+func TestVendor(t *testing.T) {
+	for _, key := range []string{"RESOURCE_NAME_NVIDIA", "NVIDIA_SMI_PATH", "DISCOVERY_CACHE_TTL", "ENABLE_MIG",
+		"MIG_PROFILE", "MIG_INSTANCE_COUNT", "SKIP_CONFIGURED", "ECC_UNCORRECTED_THRESHOLD", "GPU_TEMP_THRESHOLD"} {
+		t.Setenv(key, "")
+	}
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(testConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	cfg, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogVerbosity == nil || *cfg.LogVerbosity != 2 {
+		t.Fatalf("LogVerbosity = %v, want 2", cfg.LogVerbosity)
+	}
+
+	nvidia := cfg.Vendor("nvidia")
+	if nvidia.ResourceName != "example.com/gpu" || nvidia.CacheTTL.Duration != 5*time.Second || nvidia.MIG.Profile != "1g.10gb" {
+		t.Fatalf("Vendor(nvidia) = %+v, want the values from the file", nvidia)
+	}
+	if nvidia.Health.TempThreshold == nil || *nvidia.Health.TempThreshold != 85 || nvidia.Health.ECCThreshold != nil {
+		t.Fatalf("Vendor(nvidia).Health = %+v, want only tempThreshold 85", nvidia.Health)
+	}
+
+	t.Setenv("RESOURCE_NAME_NVIDIA", "nvidia.com/gpu")
+	t.Setenv("GPU_TEMP_THRESHOLD", "95")
+	t.Setenv("DISCOVERY_CACHE_TTL", "later")
+	nvidia = cfg.Vendor("nvidia")
+	if nvidia.ResourceName != "nvidia.com/gpu" || *nvidia.Health.TempThreshold != 95 {
+		t.Fatalf("Vendor(nvidia) = %+v, want environment overrides", nvidia)
+	}
+	if nvidia.CacheTTL.Duration != 5*time.Second {
+		t.Fatalf("invalid DISCOVERY_CACHE_TTL replaced cacheTTL with %v", nvidia.CacheTTL)
+	}
+
+	if cfg.Vendor("amd").IsEnabled() || !cfg.Vendor("huawei").IsEnabled() {
+		t.Fatal("IsEnabled() should only be false for vendors disabled in the file")
+	}
+}
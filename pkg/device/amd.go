@@ -0,0 +1,203 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// amdKFDPath ROCm 计算接口设备，所有AMD GPU共用
+const amdKFDPath = "/dev/kfd"
+
+type AMDDevice struct {
+	id          string // rocm-smi 的卡序号
+	productName string
+	healthy     bool
+}
+
+func (d *AMDDevice) ID() string         { return d.id }
+func (d *AMDDevice) IsHealthy() bool    { return d.healthy }
+func (d *AMDDevice) GetVendor() string  { return "amd" }
+func (d *AMDDevice) GetPath() string    { return "/dev/dri/card" + d.id }
+func (d *AMDDevice) IsMIG() bool        { return false }
+func (d *AMDDevice) PhysicalID() string { return d.id }
+
+func (d *AMDDevice) ControlPaths() []string { return []string{amdKFDPath} }
+
+func (d *AMDDevice) Attributes() map[string]string {
+	return map[string]string{}
+}
+
+type AMDManager struct {
+	lastDiscovery time.Time
+	devices       []GPUDevice
+	discoverySync sync.Mutex
+	clock         clock.Clock
+	cacheTTL      time.Duration // 发现结果缓存时间，0表示禁用缓存
+}
+
+func NewAMDManager() *AMDManager {
+	return &AMDManager{
+		clock:    clock.RealClock{},
+		cacheTTL: discoveryCacheTTL(),
+	}
+}
+
+// SetClock 替换时间来源，用于测试
+func (m *AMDManager) SetClock(c clock.Clock) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.clock = c
+}
+
+// SetCacheTTL 设置发现结果缓存时间，0表示禁用缓存
+func (m *AMDManager) SetCacheTTL(ttl time.Duration) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.cacheTTL = ttl
+}
+
+// InvalidateCache 使发现缓存失效，下次 DiscoverGPUs 重新查询
+func (m *AMDManager) InvalidateCache() {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.devices = nil
+	m.lastDiscovery = time.Time{}
+}
+
+// Reload 在线应用发现缓存时间
+func (m *AMDManager) Reload(cfg config.VendorConfig) {
+	if cfg.CacheTTL != nil {
+		m.SetCacheTTL(cfg.CacheTTL.Duration)
+	}
+}
+
+func (m *AMDManager) WatchHealth(ctx context.Context, changed chan<- string) {
+	PollHealth(ctx, m, healthPollInterval(), changed)
+}
+
+// 获取rocm-smi路径
+func getRocmSmiPath() string {
+	if customPath := os.Getenv("ROCM_SMI_PATH"); customPath != "" {
+		klog.V(4).Infof("Using custom ROCM-SMI path: %s", customPath)
+		return customPath
+	}
+	return "/opt/rocm/bin/rocm-smi"
+}
+
+func runRocmSmiCommand(args ...string) ([]byte, error) {
+	cmd := exec.Command(getRocmSmiPath(), args...)
+	cmd.Env = append(os.Environ(),
+		"LD_LIBRARY_PATH=/opt/rocm/lib",
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	)
+	klog.V(4).Infof("Executing ROCM-SMI command: %v", cmd.Args)
+	return cmd.Output()
+}
+
+func (m *AMDManager) DiscoverGPUs() ([]GPUDevice, error) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+
+	if m.cacheTTL > 0 && clock.OrReal(m.clock).Since(m.lastDiscovery) < m.cacheTTL && m.devices != nil {
+		klog.V(4).Infof("Using cached AMD devices (last discovery: %s)", m.lastDiscovery)
+		return m.devices, nil
+	}
+
+	klog.Info("Discovering AMD devices")
+
+	out, err := runRocmSmiCommand("--showid", "--showproductname", "--json")
+	if err != nil {
+		return nil, fmt.Errorf("rocm-smi failed: %v", err)
+	}
+	cards, err := parseRocmSmiCards(out)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]GPUDevice, 0, len(cards))
+	for _, card := range cards {
+		devices = append(devices, &AMDDevice{id: card.id, productName: card.productName, healthy: true})
+		klog.Infof("AMD Device: ID=%s, Product=%s", card.id, card.productName)
+	}
+	klog.Infof("Discovered %d AMD devices", len(devices))
+
+	m.devices = devices
+	m.lastDiscovery = clock.OrReal(m.clock).Now()
+	return devices, nil
+}
+
+// GetDevice 从最近一次发现的结果中查找，尚未发现时执行一次发现
+func (m *AMDManager) GetDevice(id string) (GPUDevice, bool) {
+	m.discoverySync.Lock()
+	cached := m.devices
+	m.discoverySync.Unlock()
+	return findDevice(cachedOrDiscover(cached, m), id)
+}
+
+// CheckHealth 能查询到设备利用率即视为健康
+func (m *AMDManager) CheckHealth(deviceID string) bool {
+	out, err := runRocmSmiCommand("-d", deviceID, "--showuse", "--json")
+	if err != nil {
+		klog.Warningf("rocm-smi health query for device %s failed: %v", deviceID, err)
+		return false
+	}
+	var stats map[string]map[string]string
+	if err := json.Unmarshal(out, &stats); err != nil {
+		klog.Warningf("Failed to parse rocm-smi output for device %s: %v", deviceID, err)
+		return false
+	}
+	if _, ok := stats["card"+deviceID]; !ok {
+		klog.Warningf("AMD device %s missing from rocm-smi output", deviceID)
+		return false
+	}
+	return true
+}
+
+// rocmCard rocm-smi 输出中的一张卡
+type rocmCard struct {
+	id          string
+	productName string
+}
+
+// parseRocmSmiCards 解析 rocm-smi --json 输出，键为 "card0"、"card1"...
+// 其他键（如 "system"）忽略，结果按卡序号排序
+func parseRocmSmiCards(out []byte) ([]rocmCard, error) {
+	var raw map[string]map[string]string
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse rocm-smi output: %v", err)
+	}
+
+	var cards []rocmCard
+	for key, fields := range raw {
+		index, ok := strings.CutPrefix(key, "card")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.Atoi(index); err != nil {
+			continue
+		}
+		name := fields["Card series"]
+		if name == "" {
+			name = fields["Card model"]
+		}
+		cards = append(cards, rocmCard{id: index, productName: name})
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		a, _ := strconv.Atoi(cards[i].id)
+		b, _ := strconv.Atoi(cards[j].id)
+		return a < b
+	})
+	return cards, nil
+}
@@ -0,0 +1,36 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRocmSmiCards(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []rocmCard
+		wantErr bool
+	}{
+		{"cards sorted numerically", `{
+			"card10": {"Card series": "Instinct MI210", "Card model": "0x0740"},
+			"card2": {"Card model": "0x740c"},
+			"system": {"Driver version": "6.2.4"}
+		}`, []rocmCard{{id: "2", productName: "0x740c"}, {id: "10", productName: "Instinct MI210"}}, false},
+		{"non-numeric card key ignored", `{"cardX": {"Card series": "bogus"}, "card0": {}}`, []rocmCard{{id: "0"}}, false},
+		{"no cards", `{}`, nil, false},
+		{"empty", "", nil, true},
+		{"malformed", "ERROR: GPU[0] : Not supported", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRocmSmiCards([]byte(tt.output))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRocmSmiCards() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseRocmSmiCards() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
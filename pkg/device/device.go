@@ -1,5 +1,15 @@
 package device
 
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+	"k8s.io/klog/v2"
+)
+
 // GPUDevice 表示GPU设备的接口
 type GPUDevice interface {
 	ID() string
@@ -8,28 +18,184 @@ type GPUDevice interface {
 	GetPath() string
 	IsMIG() bool        // 新增：是否为MIG设备
 	PhysicalID() string // 新增：物理GPU ID
+	// Attributes 设备属性（显存、MIG配置等），供日志、监控与调度参考
+	Attributes() map[string]string
 }
 
+// 设备属性键
+const (
+	AttrMemoryMB     = "memory_mb"
+	AttrMIGProfile   = "mig_profile"
+	AttrDegradations = "degradations"
+	AttrNUMANode     = "numa_node"
+	AttrLastXID      = "last_xid"
+	AttrReplicas     = "replicas"        // 时间片共享的副本数
+	AttrMemoryLimit  = "memory_limit_mb" // 时间片副本的显存配额(MB)
+	AttrRDMADevice   = "rdma_device"     // GPUDirect RDMA 关联的网卡
+	AttrProductName  = "product_name"    // GPU型号，如 NVIDIA H100 80GB HBM3
+)
+
 // DeviceManager 设备管理器接口
 type DeviceManager interface {
 	DiscoverGPUs() ([]GPUDevice, error)
+	// GetDevice 按ID查找最近一次发现的设备，尚未发现过时才执行发现
+	GetDevice(id string) (GPUDevice, bool)
 	CheckHealth(deviceID string) bool
+	InvalidateCache() // 使缓存失效，下次 DiscoverGPUs 强制重新查询
+	// WatchHealth 将健康状态变化的设备ID写入 changed，阻塞直到ctx结束
+	// 支持事件的后端可立即推送，其余通过 PollHealth 轮询实现
+	WatchHealth(ctx context.Context, changed chan<- string)
+}
+
+// Watcher 可选接口：设备集合或状态变化时推送最新设备列表，ctx 结束后关闭通道
+// 未实现的管理器由插件定时轮询 DiscoverGPUs
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan []GPUDevice, error)
+}
+
+// Reloader 可选接口：SIGHUP 时应用可在线修改的配置，cfg 中已合并环境变量
+type Reloader interface {
+	Reload(cfg config.VendorConfig)
+}
+
+// ProfiledDevice 可选接口：切分设备（如MIG）的配置类型，无法确定时返回空
+type ProfiledDevice interface {
+	Profile() string
+}
+
+// NUMAAwareDevice 可选接口：设备所在的NUMA节点，未知时返回-1
+type NUMAAwareDevice interface {
+	NUMANode() int
+}
+
+// DegradationReporter 可选接口：设备仍可用但部分能力降级（如NVLink断开）
+// 降级设备继续以Healthy上报，仅通过降级维度告知调度与运维
+type DegradationReporter interface {
+	Degradations() []string
+}
+
+// ControlDeviceProvider 可选接口：除设备节点外容器还需挂载的控制设备（如 /dev/nvidiactl）
+type ControlDeviceProvider interface {
+	ControlPaths() []string
+}
+
+// RDMADeviceProvider 可选接口：与设备一同分配的RDMA网卡（GPUDirect RDMA），没有时返回空
+type RDMADeviceProvider interface {
+	RDMADevice() (name string, paths []string)
+}
+
+// PartialDiscoveryReporter 可选接口：最近一次发现中查询失败而被跳过的物理设备
+// 这些设备上的已有分配不能当作孤儿清理，其Pod可能仍在运行
+type PartialDiscoveryReporter interface {
+	FailedPhysicalIDs() []string
+}
+
+// ProductNamer 可选接口：设备型号名称，MIG设备为所属物理GPU的型号
+type ProductNamer interface {
+	ProductName() string
+}
+
+// CapacityReporter 可选接口：设备所在物理设备最多可同时存在的同类设备数，
+// 如MIG profile的最大实例数或时间片副本数，由硬件和配置决定而非本次发现的设备数；无法确定时返回0
+type CapacityReporter interface {
+	PhysicalCapacity() int
+}
+
+// VisibleDeviceProvider 可选接口：容器运行时识别的设备标识（如GPU/MIG UUID），可能与设备ID不同
+type VisibleDeviceProvider interface {
+	VisibleDeviceID() string
+}
+
+// 降级维度
+const (
+	DegradationNVLink  = "nvlink"
+	DegradationECC     = "ecc"
+	DegradationThermal = "thermal"
+)
+
+// 默认的设备发现缓存时间
+const defaultDiscoveryCacheTTL = 5 * time.Minute
+
+// discoveryCacheTTL 读取 DISCOVERY_CACHE_TTL，0 表示禁用缓存
+func discoveryCacheTTL() time.Duration {
+	value := os.Getenv("DISCOVERY_CACHE_TTL")
+	if value == "" {
+		return defaultDiscoveryCacheTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		klog.Warningf("Invalid DISCOVERY_CACHE_TTL %q, using default %v", value, defaultDiscoveryCacheTTL)
+		return defaultDiscoveryCacheTTL
+	}
+	return ttl
+}
+
+// uint64FromEnv 解析无符号整数环境变量，无效时使用默认值
+func uint64FromEnv(key string, def uint64) uint64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		klog.Warningf("Invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
 }
 
 type SimulatorDevice struct {
-	id      string
-	healthy bool
+	id       string
+	healthy  bool
+	parentID string // 模拟MIG设备所属的GPU，整卡为空
+	profile  string
 }
 
 func (d *SimulatorDevice) IsMIG() bool {
-	return false
+	return d.parentID != ""
 }
 
 func (d *SimulatorDevice) PhysicalID() string {
+	if d.parentID != "" {
+		return d.parentID
+	}
 	return d.id
 }
 
+func (d *SimulatorDevice) Profile() string { return d.profile }
+
+func (d *SimulatorDevice) Attributes() map[string]string {
+	attrs := map[string]string{}
+	if d.profile != "" {
+		attrs[AttrMIGProfile] = d.profile
+	}
+	return attrs
+}
+
 func (d *SimulatorDevice) ID() string        { return d.id }
 func (d *SimulatorDevice) IsHealthy() bool   { return d.healthy }
 func (d *SimulatorDevice) GetVendor() string { return "simulator" }
-func (d *SimulatorDevice) GetPath() string   { return "/dev/sim_gpu" + d.id }
+func (d *SimulatorDevice) GetPath() string   { return "/dev/sim_gpu" + d.PhysicalID() }
+
+// findDevice 在设备列表中按ID查找
+func findDevice(devices []GPUDevice, id string) (GPUDevice, bool) {
+	for _, d := range devices {
+		if d.ID() == id {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// cachedOrDiscover 返回缓存的发现结果，缓存为空时重新发现，发现失败返回 nil
+func cachedOrDiscover(cached []GPUDevice, m DeviceManager) []GPUDevice {
+	if cached != nil {
+		return cached
+	}
+	devices, err := m.DiscoverGPUs()
+	if err != nil {
+		klog.V(4).Infof("Failed to discover devices for lookup: %v", err)
+		return nil
+	}
+	return devices
+}
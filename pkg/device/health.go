@@ -0,0 +1,133 @@
+package device
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// 默认的健康检查轮询间隔
+const defaultHealthPollInterval = 30 * time.Second
+
+// 默认的健康检查退避上限
+const defaultHealthBackoffMax = 5 * time.Minute
+
+// 等待下一次健康检查，测试时可替换
+var healthAfter = time.After
+
+// healthBackoffMax 读取 HEALTH_BACKOFF_MAX，连续失败时轮询间隔最多放大到该值
+func healthBackoffMax() time.Duration {
+	value := os.Getenv("HEALTH_BACKOFF_MAX")
+	if value == "" {
+		return defaultHealthBackoffMax
+	}
+	limit, err := time.ParseDuration(value)
+	if err != nil || limit <= 0 {
+		klog.Warningf("Invalid HEALTH_BACKOFF_MAX %q, using default %v", value, defaultHealthBackoffMax)
+		return defaultHealthBackoffMax
+	}
+	return limit
+}
+
+// healthBackoff 连续失败 failures 次后的轮询间隔：每次失败翻倍，不超过 limit，也不小于 interval
+func healthBackoff(interval, limit time.Duration, failures int) time.Duration {
+	next := interval
+	for i := 0; i < failures && next < limit; i++ {
+		next *= 2
+	}
+	if next > limit {
+		next = limit
+	}
+	if next < interval {
+		next = interval
+	}
+	return next
+}
+
+// healthPollInterval 读取 HEALTH_CHECK_INTERVAL
+func healthPollInterval() time.Duration {
+	value := os.Getenv("HEALTH_CHECK_INTERVAL")
+	if value == "" {
+		return defaultHealthPollInterval
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		klog.Warningf("Invalid HEALTH_CHECK_INTERVAL %q, using default %v", value, defaultHealthPollInterval)
+		return defaultHealthPollInterval
+	}
+	return interval
+}
+
+// PollHealth 定期重新发现设备并逐个检查健康状态，将状态变化的设备ID写入 changed
+// 供没有事件源的管理器实现 WatchHealth，阻塞直到ctx结束
+func PollHealth(ctx context.Context, m DeviceManager, interval time.Duration, changed chan<- string) {
+	// 驱动卡死时每次调用都会失败或超时，连续失败时拉长间隔，避免反复启动 nvidia-smi
+	backoffMax := healthBackoffMax()
+	failures := 0
+	// 上次检查的结果：部分后端的设备对象不保存检查结果，IsHealthy 始终是发现时的值
+	lastHealth := make(map[string]bool)
+	next := interval
+
+	for {
+		select {
+		case <-healthAfter(next):
+			devices, err := m.DiscoverGPUs()
+			if err != nil {
+				failures++
+				next = healthBackoff(interval, backoffMax, failures)
+				klog.Errorf("Failed to discover devices during health check (%d consecutive failures), next check in %v: %v",
+					failures, next, err)
+				continue
+			}
+
+			var ids []string
+			unhealthy := 0
+			seen := make(map[string]bool, len(devices))
+			for _, d := range devices {
+				currentHealth, ok := lastHealth[d.ID()]
+				if !ok {
+					currentHealth = d.IsHealthy()
+				}
+				actualHealth := m.CheckHealth(d.ID())
+				seen[d.ID()] = actualHealth
+				if !actualHealth {
+					unhealthy++
+				}
+
+				if currentHealth != actualHealth {
+					klog.Warningf("Device %s health status changed from %v to %v", d.ID(), currentHealth, actualHealth)
+					ids = append(ids, d.ID())
+				}
+			}
+
+			// 所有设备都检查失败时同样视为驱动故障
+			if len(devices) > 0 && unhealthy == len(devices) {
+				failures++
+				klog.Warningf("All %d devices failed health check (%d consecutive failures), backing off", len(devices), failures)
+			} else {
+				if failures > 0 {
+					klog.Infof("Health check recovered after %d consecutive failures", failures)
+				}
+				failures = 0
+			}
+			lastHealth = seen
+			next = healthBackoff(interval, backoffMax, failures)
+
+			// 状态变化时使发现缓存失效，确保 ListAndWatch 重新发现设备
+			if len(ids) > 0 {
+				m.InvalidateCache()
+			}
+			for _, id := range ids {
+				select {
+				case changed <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+)
+
+// scriptedManager 每次发现都返回新的设备对象（IsHealthy 始终为true），第i次 CheckHealth 返回 health[i]，用完后保持最后的状态并 cancel
+type scriptedManager struct {
+	mu            sync.Mutex
+	health        []bool
+	checks        int
+	invalidations int // InvalidateCache 的调用次数
+	cancel        context.CancelFunc
+}
+
+func (m *scriptedManager) DiscoverGPUs() ([]GPUDevice, error) {
+	return []GPUDevice{&SimulatorDevice{id: "0", healthy: true}}, nil
+}
+func (m *scriptedManager) GetDevice(id string) (GPUDevice, bool)      { return nil, false }
+func (m *scriptedManager) WatchHealth(context.Context, chan<- string) {}
+
+func (m *scriptedManager) InvalidateCache() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invalidations++
+}
+
+func (m *scriptedManager) CheckHealth(string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.checks >= len(m.health) {
+		m.cancel()
+		return m.health[len(m.health)-1]
+	}
+	m.checks++
+	return m.health[m.checks-1]
+}
+
+// 设备对象不保存检查结果时，同一状态只报告一次变化；每次变化都使发现缓存失效
+func TestPollHealthReportsEachChangeOnce(t *testing.T) {
+	tests := []struct {
+		name   string
+		health []bool
+		want   int
+	}{
+		{"stays healthy", []bool{true, true, true}, 0},
+		{"stays unhealthy", []bool{false, false, false, false}, 1},
+		{"flaps", []bool{false, true, true, false}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			m := &scriptedManager{health: tt.health, cancel: cancel}
+			changed := make(chan string, len(tt.health))
+			done := make(chan struct{})
+			go func() {
+				PollHealth(ctx, m, time.Millisecond, changed)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("PollHealth did not return")
+			}
+			if got := len(changed); got != tt.want {
+				t.Fatalf("PollHealth reported %d changes, want %d", got, tt.want)
+			}
+			if m.invalidations != tt.want {
+				t.Fatalf("InvalidateCache called %d times, want %d", m.invalidations, tt.want)
+			}
+		})
+	}
+}
+
+// pollStep 一轮健康检查的结果：发现失败，或设备的检查结果
+type pollStep struct {
+	discoverErr bool
+	healthy     bool
+}
+
+// backoffManager 按 steps 逐轮返回结果并记录每次发现的时间，用完后 cancel
+type backoffManager struct {
+	clock  *clock.FakeClock
+	steps  []pollStep
+	round  int
+	times  []time.Duration
+	start  time.Time
+	cancel context.CancelFunc
+}
+
+func (m *backoffManager) DiscoverGPUs() ([]GPUDevice, error) {
+	if m.round >= len(m.steps) {
+		m.cancel()
+		return nil, errors.New("done")
+	}
+	m.times = append(m.times, m.clock.Since(m.start))
+	m.round++
+	if m.round == len(m.steps) {
+		m.cancel()
+	}
+	if m.steps[m.round-1].discoverErr {
+		return nil, errors.New("nvidia-smi timed out")
+	}
+	return []GPUDevice{&SimulatorDevice{id: "0", healthy: true}}, nil
+}
+func (m *backoffManager) CheckHealth(string) bool                    { return m.steps[m.round-1].healthy }
+func (m *backoffManager) GetDevice(string) (GPUDevice, bool)         { return nil, false }
+func (m *backoffManager) InvalidateCache()                           {}
+func (m *backoffManager) WatchHealth(context.Context, chan<- string) {}
+
+// 连续失败时间隔翻倍直到 HEALTH_BACKOFF_MAX，恢复后回到基准间隔；所有设备都不健康同样计为失败
+func TestPollHealthBackoff(t *testing.T) {
+	t.Setenv("HEALTH_BACKOFF_MAX", "5s")
+	fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+	orig := healthAfter
+	healthAfter = func(d time.Duration) <-chan time.Time {
+		fakeClock.Step(d)
+		ch := make(chan time.Time, 1)
+		ch <- fakeClock.Now()
+		return ch
+	}
+	t.Cleanup(func() { healthAfter = orig })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &backoffManager{
+		clock: fakeClock,
+		start: fakeClock.Now(),
+		steps: []pollStep{
+			{discoverErr: true}, {discoverErr: true}, {discoverErr: true}, {discoverErr: true},
+			{healthy: true}, {healthy: false}, {healthy: true}, {healthy: true},
+		},
+		cancel: cancel,
+	}
+	PollHealth(ctx, m, time.Second, make(chan string, len(m.steps)))
+
+	// 间隔依次为 1s, 2s, 4s, 5s(上限), 5s, 1s(恢复), 2s(全部不健康), 1s
+	want := []time.Duration{1, 3, 7, 12, 17, 18, 20, 21}
+	for i := range want {
+		want[i] *= time.Second
+	}
+	if !reflect.DeepEqual(m.times, want) {
+		t.Fatalf("discovery times = %v, want %v", m.times, want)
+	}
+}
+
+// HEALTH_BACKOFF_MAX 无效时使用默认上限，上限小于基准间隔时按基准间隔轮询
+func TestHealthBackoffLimits(t *testing.T) {
+	for _, value := range []string{"", "soon", "0", "-1m"} {
+		t.Setenv("HEALTH_BACKOFF_MAX", value)
+		if got := healthBackoffMax(); got != defaultHealthBackoffMax {
+			t.Fatalf("healthBackoffMax() with %q = %v, want %v", value, got, defaultHealthBackoffMax)
+		}
+	}
+	t.Setenv("HEALTH_BACKOFF_MAX", "90s")
+	if got := healthBackoffMax(); got != 90*time.Second {
+		t.Fatalf("healthBackoffMax() = %v, want 90s", got)
+	}
+
+	tests := []struct {
+		interval, limit time.Duration
+		failures        int
+		want            time.Duration
+	}{
+		{30 * time.Second, 5 * time.Minute, 0, 30 * time.Second},
+		{30 * time.Second, 5 * time.Minute, 3, 4 * time.Minute},
+		{30 * time.Second, 5 * time.Minute, 100, 5 * time.Minute},
+		{30 * time.Second, 10 * time.Second, 2, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := healthBackoff(tt.interval, tt.limit, tt.failures); got != tt.want {
+			t.Fatalf("healthBackoff(%v, %v, %d) = %v, want %v", tt.interval, tt.limit, tt.failures, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,16 @@
 package device
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
 	"k8s.io/klog/v2"
 )
 
@@ -20,15 +27,76 @@ func (d *HuaweiDevice) PhysicalID() string {
 	return d.id
 }
 
+func (d *HuaweiDevice) Attributes() map[string]string {
+	return map[string]string{}
+}
+
 func (d *HuaweiDevice) ID() string        { return d.id }
 func (d *HuaweiDevice) IsHealthy() bool   { return d.healthy }
 func (d *HuaweiDevice) GetVendor() string { return "huawei" }
 func (d *HuaweiDevice) GetPath() string   { return "/dev/davinci" + d.id }
 
+// 昇腾容器还需挂载的管理设备
+var huaweiControlPaths = []string{"/dev/davinci_manager", "/dev/devmm_svm", "/dev/hisi_hdc"}
+
+func (d *HuaweiDevice) ControlPaths() []string { return huaweiControlPaths }
+
 type HuaweiManager struct {
 	lastDiscovery time.Time
 	devices       []GPUDevice
 	discoverySync sync.Mutex
+	clock         clock.Clock
+	cacheTTL      time.Duration // 发现结果缓存时间，0表示禁用缓存
+	healthCommand []string      // 自定义健康检查命令，为空时使用内置探测
+}
+
+// 自定义健康检查命令的超时时间
+const huaweiHealthCommandTimeout = 10 * time.Second
+
+func NewHuaweiManager() *HuaweiManager {
+	m := &HuaweiManager{
+		clock:    clock.RealClock{},
+		cacheTTL: discoveryCacheTTL(),
+	}
+	// 旧版昇腾固件可能需要自定义健康检查命令，"{id}" 会被替换为设备ID，缺省时追加在末尾
+	if command := strings.TrimSpace(os.Getenv("HUAWEI_HEALTH_COMMAND")); command != "" {
+		m.healthCommand = strings.Fields(command)
+		klog.Infof("Using custom Huawei health command: %v", m.healthCommand)
+	}
+	return m
+}
+
+// SetClock 替换时间来源，用于测试
+func (m *HuaweiManager) SetClock(c clock.Clock) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.clock = c
+}
+
+// SetCacheTTL 设置发现结果缓存时间，0表示禁用缓存
+func (m *HuaweiManager) SetCacheTTL(ttl time.Duration) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.cacheTTL = ttl
+}
+
+// InvalidateCache 使发现缓存失效，下次 DiscoverGPUs 重新查询
+func (m *HuaweiManager) InvalidateCache() {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.devices = nil
+	m.lastDiscovery = time.Time{}
+}
+
+// Reload 在线应用发现缓存时间
+func (m *HuaweiManager) Reload(cfg config.VendorConfig) {
+	if cfg.CacheTTL != nil {
+		m.SetCacheTTL(cfg.CacheTTL.Duration)
+	}
+}
+
+func (m *HuaweiManager) WatchHealth(ctx context.Context, changed chan<- string) {
+	PollHealth(ctx, m, healthPollInterval(), changed)
 }
 
 func (m *HuaweiManager) DiscoverGPUs() ([]GPUDevice, error) {
@@ -36,18 +104,30 @@ func (m *HuaweiManager) DiscoverGPUs() ([]GPUDevice, error) {
 	defer m.discoverySync.Unlock()
 
 	// 如果最近已经发现过设备，则使用缓存
-	if time.Since(m.lastDiscovery) < 5*time.Minute && m.devices != nil {
+	if m.cacheTTL > 0 && clock.OrReal(m.clock).Since(m.lastDiscovery) < m.cacheTTL && m.devices != nil {
 		klog.V(4).Infof("Using cached Huawei devices (last discovery: %s)", m.lastDiscovery)
 		return m.devices, nil
 	}
 
 	klog.Info("Discovering Huawei devices")
 
-	// 实际生产环境中应使用华为NPU SDK调用
-	// 这里为模拟实现
-	devices := []GPUDevice{
-		&HuaweiDevice{id: "0", healthy: true},
-		&HuaweiDevice{id: "1", healthy: true},
+	var devices []GPUDevice
+	if npuSmiAvailable() {
+		out, err := runNpuSmiCommand("info")
+		if err != nil {
+			return nil, fmt.Errorf("npu-smi info failed: %v, output: %s", err, strings.TrimSpace(string(out)))
+		}
+		for _, npu := range parseNpuSmiInfo(string(out)) {
+			devices = append(devices, &HuaweiDevice{id: npu.id, healthy: npuHealthy(npu.health)})
+			klog.V(4).Infof("Found Huawei NPU %s (%s), health: %s", npu.id, npu.name, npu.health)
+		}
+	} else {
+		// 未安装npu-smi（如CI环境）时使用模拟设备
+		klog.Warningf("npu-smi not found at %s, using mock Huawei devices", getNpuSmiPath())
+		devices = []GPUDevice{
+			&HuaweiDevice{id: "0", healthy: true},
+			&HuaweiDevice{id: "1", healthy: true},
+		}
 	}
 
 	klog.Infof("Discovered %d Huawei devices", len(devices))
@@ -56,14 +136,73 @@ func (m *HuaweiManager) DiscoverGPUs() ([]GPUDevice, error) {
 	}
 
 	m.devices = devices
-	m.lastDiscovery = time.Now()
+	m.lastDiscovery = clock.OrReal(m.clock).Now()
 	return devices, nil
 }
 
+// GetDevice 从最近一次发现的结果中查找，尚未发现时执行一次发现
+func (m *HuaweiManager) GetDevice(id string) (GPUDevice, bool) {
+	m.discoverySync.Lock()
+	cached := m.devices
+	m.discoverySync.Unlock()
+	return findDevice(cachedOrDiscover(cached, m), id)
+}
+
 func (m *HuaweiManager) CheckHealth(deviceID string) bool {
-	// 实际生产环境中应使用华为NPU SDK的健康检查
-	// 这里总是返回true作为模拟
-	healthy := true
-	klog.V(5).Infof("Checking health of Huawei device %s: %v", deviceID, healthy)
+	if len(m.healthCommand) > 0 {
+		return m.runHealthCommand(deviceID)
+	}
+
+	// 模拟设备总是健康
+	if !npuSmiAvailable() {
+		return true
+	}
+
+	out, err := runNpuSmiCommand("info", "-t", "health", "-i", deviceID)
+	if err != nil {
+		klog.Warningf("npu-smi health query for device %s failed: %v, output: %s", deviceID, err, strings.TrimSpace(string(out)))
+		return false
+	}
+	health, ok := parseNpuHealthStatus(string(out))
+	if !ok {
+		klog.Warningf("Failed to parse npu-smi health output for device %s: %s", deviceID, strings.TrimSpace(string(out)))
+		return false
+	}
+	healthy := npuHealthy(health)
+	klog.V(5).InfoS("Checked device health", "vendor", "huawei", "device_id", deviceID, "health", health)
 	return healthy
 }
+
+// runHealthCommand 执行自定义健康检查命令
+// 退出码非0或输出包含 "unhealthy" 时判定为不健康
+func (m *HuaweiManager) runHealthCommand(deviceID string) bool {
+	args := make([]string, 0, len(m.healthCommand)+1)
+	substituted := false
+	for _, arg := range m.healthCommand {
+		if strings.Contains(arg, "{id}") {
+			arg = strings.ReplaceAll(arg, "{id}", deviceID)
+			substituted = true
+		}
+		args = append(args, arg)
+	}
+	if !substituted {
+		args = append(args, deviceID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), huaweiHealthCommandTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	output := strings.TrimSpace(string(out))
+	if err != nil {
+		klog.Warningf("Huawei health command for device %s failed: %v, output: %s", deviceID, err, output)
+		return false
+	}
+	if strings.Contains(strings.ToLower(output), "unhealthy") {
+		klog.Warningf("Huawei health command reported device %s unhealthy: %s", deviceID, output)
+		return false
+	}
+
+	klog.V(5).Infof("Huawei health command reported device %s healthy", deviceID)
+	return true
+}
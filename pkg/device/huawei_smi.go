@@ -0,0 +1,103 @@
+package device
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// 获取npu-smi路径
+func getNpuSmiPath() string {
+	if customPath := os.Getenv("NPU_SMI_PATH"); customPath != "" {
+		klog.V(4).Infof("Using custom NPU-SMI path: %s", customPath)
+		return customPath
+	}
+	return "/usr/local/Ascend/driver/tools/npu-smi"
+}
+
+// npuSmiAvailable 判断npu-smi是否存在，不存在时（如CI环境）使用模拟设备
+func npuSmiAvailable() bool {
+	_, err := os.Stat(getNpuSmiPath())
+	return err == nil
+}
+
+// 确保命令使用昇腾驱动的库路径
+func runNpuSmiCommand(args ...string) ([]byte, error) {
+	cmd := exec.Command(getNpuSmiPath(), args...)
+	cmd.Env = append(os.Environ(),
+		"LD_LIBRARY_PATH=/usr/local/Ascend/driver/lib64:/usr/local/Ascend/driver/lib64/common:/usr/local/Ascend/driver/lib64/driver",
+		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+	)
+	klog.V(4).Infof("Executing NPU-SMI command: %v", cmd.Args)
+	return cmd.CombinedOutput()
+}
+
+// npuInfo npu-smi info 中的一块NPU
+type npuInfo struct {
+	id     string
+	name   string
+	health string
+}
+
+// parseNpuSmiInfo 解析 npu-smi info 的表格输出，设备行示例:
+//
+//	| 0     910B3               | OK            | 93.6        40                0    / 0             |
+//
+// 紧随其后的Chip行第一列只有数字，进程表位于 "Process id" 表头之后，均跳过
+func parseNpuSmiInfo(output string) []npuInfo {
+	var npus []npuInfo
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Contains(line, "Process id") {
+			break
+		}
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		if len(cells) < 2 {
+			continue
+		}
+		fields := strings.Fields(cells[0])
+		if len(fields) < 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[0]); err != nil {
+			continue
+		}
+		// Chip行和进程行的第二列同样为数字
+		if _, err := strconv.Atoi(fields[1]); err == nil {
+			continue
+		}
+		npus = append(npus, npuInfo{
+			id:     fields[0],
+			name:   fields[1],
+			health: strings.TrimSpace(cells[1]),
+		})
+	}
+	return npus
+}
+
+// npuHealthy 将npu-smi的健康状态映射为是否健康，Warning 仍可调度
+func npuHealthy(health string) bool {
+	switch strings.ToLower(health) {
+	case "ok", "warning":
+		return true
+	default:
+		return false
+	}
+}
+
+// parseNpuHealthStatus 解析 npu-smi info -t health 输出中的 "Health Status : OK"
+func parseNpuHealthStatus(output string) (string, bool) {
+	for _, line := range strings.Split(output, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found && strings.TrimSpace(key) == "Health Status" {
+			return strings.TrimSpace(value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+const npuSmiInfoFixture = `+------------------------------------------------------------------------------------------------+
+| npu-smi 23.0.rc2                 Version: 23.0.rc2                                             |
++---------------------------+---------------+----------------------------------------------------+
+| NPU   Name                | Health        | Power(W)    Temp(C)           Hugepages-Usage(page)|
+| Chip                      | Bus-Id        | AICore(%)   Memory-Usage(MB)  HBM-Usage(MB)        |
++===========================+===============+====================================================+
+| 0     910B3               | OK            | 93.6        40                0    / 0             |
+| 0                         | 0000:C1:00.0  | 0           0    / 0          3161 / 65536         |
++===========================+===============+====================================================+
+| 1     910B3               | Critical      | 90.1        41                0    / 0             |
+| 0                         | 0000:C2:00.0  | 0           0    / 0          3161 / 65536         |
++===========================+===============+====================================================+
++---------------------------+---------------+----------------------------------------------------+
+| NPU     Chip              | Process id    | Process name             | Process memory(MB)      |
++===========================+===============+====================================================+
+| 0       0                 | 1234          | python                   | 100                     |
++===========================+===============+====================================================+
+`
+
+func TestParseNpuSmiInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []npuInfo
+	}{
+		{"devices and chips", npuSmiInfoFixture, []npuInfo{
+			{id: "0", name: "910B3", health: "OK"},
+			{id: "1", name: "910B3", health: "Critical"},
+		}},
+		{"empty", "", nil},
+		{"malformed", "npu-smi: command not found\n| not | a | table |\n|", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseNpuSmiInfo(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseNpuSmiInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNpuHealthStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		wantStatus  string
+		wantFound   bool
+		wantHealthy bool
+	}{
+		{"ok", "        Health Status                  : OK\n", "OK", true, true},
+		{"warning is schedulable", "Health Status : Warning", "Warning", true, true},
+		{"critical", "Chip Count : 1\nHealth Status : Critical\n", "Critical", true, false},
+		{"empty", "", "", false, false},
+		{"malformed", "Health Status OK", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, found := parseNpuHealthStatus(tt.output)
+			if status != tt.wantStatus || found != tt.wantFound {
+				t.Fatalf("parseNpuHealthStatus() = (%q, %v), want (%q, %v)", status, found, tt.wantStatus, tt.wantFound)
+			}
+			if got := npuHealthy(status); got != tt.wantHealthy {
+				t.Fatalf("npuHealthy(%q) = %v, want %v", status, got, tt.wantHealthy)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+)
+
+// 自定义健康检查命令：退出码非0或输出含 unhealthy 视为不健康，{id} 缺省时设备ID追加在末尾
+func TestHuaweiHealthCommand(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "check-npu")
+	content := `#!/bin/sh
+for arg in "$@"; do id="${arg#--device=}"; done
+case "$id" in
+0) echo "device 0: OK" ;;
+1) echo "device 1: UNHEALTHY" ;;
+*) echo "no such device" >&2; exit 2 ;;
+esac
+`
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		id      string
+		want    bool
+	}{
+		{"id appended", script, "0", true},
+		{"id substituted", script + " --device={id}", "0", true},
+		{"unhealthy output", script + " --device={id}", "1", false},
+		{"non-zero exit", script, "7", false},
+		{"missing command", filepath.Join(t.TempDir(), "absent"), "0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("HUAWEI_HEALTH_COMMAND", tt.command)
+			if got := NewHuaweiManager().CheckHealth(tt.id); got != tt.want {
+				t.Fatalf("CheckHealth(%s) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeNpuSmi 安装输出 npuSmiInfoFixture 的 npu-smi，返回读取 info 调用次数的函数
+func fakeNpuSmi(t *testing.T) func() int {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "npu-smi")
+	content := "#!/bin/sh\necho x >> \"" + filepath.Join(dir, "calls") + "\"\ncat <<'OUT'\n" + npuSmiInfoFixture + "OUT\n"
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NPU_SMI_PATH", path)
+	return func() int {
+		raw, err := os.ReadFile(filepath.Join(dir, "calls"))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return strings.Count(string(raw), "x")
+	}
+}
+
+// 缓存时间内复用发现结果，0表示每次都重新发现
+func TestHuaweiDiscoveryCacheTTL(t *testing.T) {
+	tests := []struct {
+		name  string
+		ttl   string
+		steps []time.Duration // 每次发现前推进的时间
+		want  []int           // 每次发现后 npu-smi 的累计调用次数
+	}{
+		{"default five minutes", "", []time.Duration{0, 4 * time.Minute, 2 * time.Minute}, []int{1, 1, 2}},
+		{"configured", "30s", []time.Duration{0, 20 * time.Second, 11 * time.Second}, []int{1, 1, 2}},
+		{"disabled", "0", []time.Duration{0, 0, 0}, []int{1, 2, 3}},
+		{"invalid falls back to default", "-1s", []time.Duration{0, time.Minute}, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := fakeNpuSmi(t)
+			t.Setenv("DISCOVERY_CACHE_TTL", tt.ttl)
+			m := NewHuaweiManager()
+			fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+			m.SetClock(fakeClock)
+			for i, step := range tt.steps {
+				fakeClock.Step(step)
+				devices, err := m.DiscoverGPUs()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(devices) != 2 || !devices[0].IsHealthy() || devices[1].IsHealthy() {
+					t.Fatalf("discovery %d: unexpected devices %v", i, devices)
+				}
+				if got := calls(); got != tt.want[i] {
+					t.Fatalf("discovery %d: npu-smi called %d times, want %d", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// InvalidateCache 后下一次发现不使用缓存
+func TestHuaweiInvalidateCache(t *testing.T) {
+	calls := fakeNpuSmi(t)
+	t.Setenv("DISCOVERY_CACHE_TTL", "1h")
+	m := NewHuaweiManager()
+	for i, invalidate := range []bool{false, false, true, false} {
+		if invalidate {
+			m.InvalidateCache()
+		}
+		if _, err := m.DiscoverGPUs(); err != nil {
+			t.Fatal(err)
+		}
+		want := 1
+		if i >= 2 {
+			want = 2
+		}
+		if got := calls(); got != want {
+			t.Fatalf("discovery %d: npu-smi called %d times, want %d", i, got, want)
+		}
+	}
+}
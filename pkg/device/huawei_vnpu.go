@@ -0,0 +1,154 @@
+package device
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// HuaweiVNPUDevice 昇腾虚拟NPU（vNPU）实例，与MIG类似由物理NPU切分而来
+type HuaweiVNPUDevice struct {
+	id       string // vNPU ID
+	parentID string // 物理NPU ID
+	profile  string // 切分模板，如 vir04
+	healthy  bool
+}
+
+func (d *HuaweiVNPUDevice) ID() string        { return d.id }
+func (d *HuaweiVNPUDevice) IsHealthy() bool   { return d.healthy }
+func (d *HuaweiVNPUDevice) GetVendor() string { return "huawei" }
+func (d *HuaweiVNPUDevice) GetPath() string   { return "/dev/vdavinci" + d.id }
+
+// IsMIG vNPU 与MIG同属虚拟切分实例，沿用同一套资源划分逻辑
+func (d *HuaweiVNPUDevice) IsMIG() bool        { return true }
+func (d *HuaweiVNPUDevice) PhysicalID() string { return d.parentID }
+func (d *HuaweiVNPUDevice) Profile() string    { return d.profile }
+
+func (d *HuaweiVNPUDevice) ControlPaths() []string { return huaweiControlPaths }
+
+func (d *HuaweiVNPUDevice) Attributes() map[string]string {
+	attrs := map[string]string{}
+	if d.profile != "" {
+		attrs[AttrMIGProfile] = d.profile
+	}
+	return attrs
+}
+
+// HuaweiVNPUManager 发现物理NPU上的vNPU实例并作为独立设备上报
+// 未切分的NPU仍以整卡上报
+type HuaweiVNPUManager struct {
+	*HuaweiManager
+
+	mu      sync.RWMutex
+	parents map[string]string // vNPU ID 到物理NPU ID 的映射
+	devices []GPUDevice       // 最近一次发现的设备，含vNPU与未切分的整卡
+}
+
+func NewHuaweiVNPUManager() *HuaweiVNPUManager {
+	return &HuaweiVNPUManager{
+		HuaweiManager: NewHuaweiManager(),
+		parents:       make(map[string]string),
+	}
+}
+
+func (m *HuaweiVNPUManager) DiscoverGPUs() ([]GPUDevice, error) {
+	physical, err := m.HuaweiManager.DiscoverGPUs()
+	if err != nil {
+		return nil, err
+	}
+	// 模拟环境下没有vNPU
+	if !npuSmiAvailable() {
+		return physical, nil
+	}
+
+	parents := make(map[string]string)
+	var devices []GPUDevice
+	for _, npu := range physical {
+		// 暂只查询每块NPU的0号芯片
+		out, err := runNpuSmiCommand("info", "-t", "info-vnpu", "-i", npu.ID(), "-c", "0")
+		if err != nil {
+			klog.Warningf("Failed to query vNPUs on NPU %s: %v, output: %s", npu.ID(), err, strings.TrimSpace(string(out)))
+			devices = append(devices, npu)
+			continue
+		}
+
+		vnpus := parseVNPUInfo(string(out))
+		if len(vnpus) == 0 {
+			devices = append(devices, npu)
+			continue
+		}
+		for _, v := range vnpus {
+			parents[v.id] = npu.ID()
+			devices = append(devices, &HuaweiVNPUDevice{
+				id:       v.id,
+				parentID: npu.ID(),
+				profile:  v.profile,
+				healthy:  npu.IsHealthy(),
+			})
+		}
+		klog.Infof("Found %d vNPUs on Huawei NPU %s", len(vnpus), npu.ID())
+	}
+
+	m.mu.Lock()
+	m.parents = parents
+	m.devices = devices
+	m.mu.Unlock()
+	return devices, nil
+}
+
+func (m *HuaweiVNPUManager) WatchHealth(ctx context.Context, changed chan<- string) {
+	PollHealth(ctx, m, healthPollInterval(), changed)
+}
+
+// GetDevice 查找vNPU或整卡，不能使用内嵌管理器的实现（其中只有物理NPU）
+func (m *HuaweiVNPUManager) GetDevice(id string) (GPUDevice, bool) {
+	m.mu.RLock()
+	cached := m.devices
+	m.mu.RUnlock()
+	return findDevice(cachedOrDiscover(cached, m), id)
+}
+
+// CheckHealth vNPU 的健康状态取决于所属物理NPU
+func (m *HuaweiVNPUManager) CheckHealth(deviceID string) bool {
+	m.mu.RLock()
+	parentID, ok := m.parents[deviceID]
+	m.mu.RUnlock()
+	if ok {
+		deviceID = parentID
+	}
+	return m.HuaweiManager.CheckHealth(deviceID)
+}
+
+// vnpuInfo npu-smi info -t info-vnpu 中的一个vNPU实例
+type vnpuInfo struct {
+	id      string
+	profile string
+}
+
+// parseVNPUInfo 解析vNPU列表，实例行示例:
+//
+//	|  100      |  0             |  000000000000  |  0       |  vir04               |
+//
+// 依次为 Vnpu ID、Vgroup ID、Container ID、Status、Template Name
+func parseVNPUInfo(output string) []vnpuInfo {
+	var vnpus []vnpuInfo
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		if len(cells) != 5 {
+			continue
+		}
+		id := strings.TrimSpace(cells[0])
+		if _, err := strconv.Atoi(id); err != nil {
+			continue
+		}
+		vnpus = append(vnpus, vnpuInfo{id: id, profile: strings.TrimSpace(cells[4])})
+	}
+	return vnpus
+}
@@ -0,0 +1,43 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+const vnpuInfoFixture = `+-------------------------------------------------------------------------------+
+| NPU resource static info as follow:                                            |
+| Format:Free/Total                 NA: Currently, query is not supported.       |
+| AICORE    Memory    AICPU    VPC    VENC    VDEC    JPEGD    JPEGE    PNGD     |
+|            GB                                                                  |
+|===============================================================================|
+| 14/20     26/32      6/7      8/9    2/3     8/10    14/16    4/4     NA/NA    |
++-------------------------------------------------------------------------------+
+| Total number of vnpu: 2                                                        |
++-------------------------------------------------------------------------------+
+|  Vnpu ID  |  Vgroup ID     |  Container ID  |  Status  |  Template Name        |
++-------------------------------------------------------------------------------+
+|  100      |  0             |  000000000000  |  0       |  vir04                |
+|  101      |  1             |  000000000000  |  0       |  vir02                |
++-------------------------------------------------------------------------------+
+`
+
+func TestParseVNPUInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []vnpuInfo
+	}{
+		{"instances", vnpuInfoFixture, []vnpuInfo{{id: "100", profile: "vir04"}, {id: "101", profile: "vir02"}}},
+		{"no instances", "| Total number of vnpu: 0 |\n", nil},
+		{"empty", "", nil},
+		{"malformed", "|  abc  |  0  |  0  |  0  |  vir04  |\n|  102  |  vir08  |\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseVNPUInfo(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseVNPUInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
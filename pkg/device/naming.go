@@ -0,0 +1,97 @@
+package device
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// DeviceNamer 将规范设备ID渲染为友好名称（用于日志、事件、注解）
+// kubelet 始终使用规范ID，友好名称仅用于展示
+type DeviceNamer struct {
+	rules []nameRule
+
+	mu      sync.RWMutex
+	reverse map[string]string // 友好名称到规范ID的映射
+}
+
+type nameRule struct {
+	pattern  *regexp.Regexp
+	template string
+}
+
+// NewDeviceNamer 解析命名规则，格式: "正则=模板;正则=模板"
+// 模板支持正则分组引用，例如 `^(\d+)-GI(\d+)-CI\d+$=a100-gpu$1-slice$2`
+func NewDeviceNamer(spec string) (*DeviceNamer, error) {
+	n := &DeviceNamer{reverse: make(map[string]string)}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		// 模板中不含'='，按最后一个'='切分以允许正则中出现'='
+		sep := strings.LastIndex(entry, "=")
+		if sep <= 0 || sep == len(entry)-1 {
+			return nil, fmt.Errorf("invalid device name rule %q", entry)
+		}
+		pattern, err := regexp.Compile(entry[:sep])
+		if err != nil {
+			return nil, fmt.Errorf("invalid device name pattern %q: %v", entry[:sep], err)
+		}
+		n.rules = append(n.rules, nameRule{pattern: pattern, template: entry[sep+1:]})
+	}
+	return n, nil
+}
+
+// NewDeviceNamerFromEnv 从 DEVICE_NAME_MAP 环境变量加载命名规则
+// 规则无效时记录错误并退化为直接使用规范ID
+func NewDeviceNamerFromEnv() *DeviceNamer {
+	spec := os.Getenv("DEVICE_NAME_MAP")
+	n, err := NewDeviceNamer(spec)
+	if err != nil {
+		klog.Errorf("Ignoring DEVICE_NAME_MAP: %v", err)
+		n, _ = NewDeviceNamer("")
+	}
+	return n
+}
+
+// Name 返回设备的友好名称，无匹配规则时返回规范ID
+func (n *DeviceNamer) Name(id string) string {
+	if n == nil {
+		return id
+	}
+	for _, rule := range n.rules {
+		match := rule.pattern.FindStringSubmatchIndex(id)
+		if match == nil {
+			continue
+		}
+		name := string(rule.pattern.ExpandString(nil, rule.template, id, match))
+
+		n.mu.Lock()
+		if existing, ok := n.reverse[name]; ok && existing != id {
+			klog.Warningf("Device name %q is shared by %s and %s", name, existing, id)
+		}
+		n.reverse[name] = id
+		n.mu.Unlock()
+		return name
+	}
+	return id
+}
+
+// CanonicalID 将友好名称还原为规范ID，名称未知时原样返回并报告false
+func (n *DeviceNamer) CanonicalID(name string) (string, bool) {
+	if n == nil {
+		return name, false
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if id, ok := n.reverse[name]; ok {
+		return id, true
+	}
+	return name, false
+}
@@ -0,0 +1,42 @@
+package device
+
+import "testing"
+
+func TestDeviceNamer(t *testing.T) {
+	n, err := NewDeviceNamer(`^(\d+)-GI(\d+)-CI\d+$=a100-gpu$1-slice$2; ^(\d+)$=gpu$1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id       string
+		wantName string
+	}{
+		{"0-GI3-CI0", "a100-gpu0-slice3"},
+		{"1-GI7-CI0", "a100-gpu1-slice7"},
+		{"2", "gpu2"},
+		{"GPU-abc", "GPU-abc"}, // 无匹配规则
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			name := n.Name(tt.id)
+			if name != tt.wantName {
+				t.Fatalf("Name(%s) = %q, want %q", tt.id, name, tt.wantName)
+			}
+			id, ok := n.CanonicalID(name)
+			if id != tt.id || ok != (name != tt.id) {
+				t.Fatalf("CanonicalID(%q) = %q, %v, want %q, %v", name, id, ok, tt.id, name != tt.id)
+			}
+		})
+	}
+	if id, ok := n.CanonicalID("gpu9"); ok || id != "gpu9" {
+		t.Fatalf("CanonicalID of a name never rendered = %q, %v, want unchanged and false", id, ok)
+	}
+}
+
+func TestNewDeviceNamerInvalid(t *testing.T) {
+	for _, spec := range []string{"no-separator", "^a=", "=b", "(=b"} {
+		if _, err := NewDeviceNamer(spec); err == nil {
+			t.Fatalf("NewDeviceNamer(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -1,31 +1,71 @@
 package device
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+	"github.com/benyuereal/micro-device-plugin/pkg/metrics"
+	"golang.org/x/sync/semaphore"
 	"k8s.io/klog/v2"
 )
 
 type NVIDIADevice struct {
 	id          string
-	deviceIndex string // 系统设备索引
-	physicalID  string // 物理GPU ID
-	migEnabled  bool   // 是否为MIG设备
-	profile     string // MIG配置类型
-	healthy     bool
+	uuid        string   // GPU或MIG UUID，NVIDIA容器运行时以此识别设备
+	deviceIndex string   // 系统设备索引
+	physicalID  string   // 物理GPU ID
+	migEnabled  bool     // 是否为MIG设备
+	profile     string   // MIG配置类型
+	memoryMB    uint64   // 显存大小(MB)，MIG设备为实例显存
+	pciBusID    string   // PCI总线地址，MIG设备继承物理GPU
+	numaNode    int      // NUMA节点，-1表示未知
+	replicas    int      // 时间片共享的副本数，0或1表示独占
+	memoryLimit uint64   // 时间片副本的显存配额(MB)，0表示不限制
+	rdma        *rdmaNIC // GPUDirect RDMA 关联的网卡，未开启或没有网卡时为nil
+	productName string   // GPU型号，MIG设备继承物理GPU
+
+	mu           sync.RWMutex
+	healthy      bool     // 最近一次健康检查结果，由 CheckHealth 更新
+	degradations []string // 降级维度，设备仍健康可用
+	lastXID      int      // 最近一次XID错误码，0表示无
 }
 
-func (d *NVIDIADevice) ID() string        { return d.id }
-func (d *NVIDIADevice) IsHealthy() bool   { return d.healthy }
+func (d *NVIDIADevice) ID() string { return d.id }
+
+// VisibleDeviceID 返回写入 NVIDIA_VISIBLE_DEVICES 的UUID
+func (d *NVIDIADevice) VisibleDeviceID() string {
+	if d.uuid != "" {
+		return d.uuid
+	}
+	return d.id
+}
 func (d *NVIDIADevice) GetVendor() string { return "nvidia" }
 
+// IsHealthy 返回最近一次健康检查的结果，尚未检查时为发现时的初始值
+func (d *NVIDIADevice) IsHealthy() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.healthy
+}
+
+func (d *NVIDIADevice) setHealthy(healthy bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.healthy = healthy
+}
+
 // device/nvidia.go
 func (d *NVIDIADevice) GetPath() string {
 	if d.migEnabled {
@@ -35,13 +75,108 @@ func (d *NVIDIADevice) GetPath() string {
 	return "/dev/nvidia" + d.physicalID
 }
 func (d *NVIDIADevice) IsMIG() bool { return d.migEnabled }
+
+// RDMADevice 返回 GPUDirect RDMA 关联的网卡名及其设备节点
+func (d *NVIDIADevice) RDMADevice() (string, []string) {
+	if d.rdma == nil {
+		return "", nil
+	}
+	return d.rdma.name, d.rdma.paths
+}
+
+// ControlPaths MIG设备还需要驱动控制设备
+func (d *NVIDIADevice) ControlPaths() []string {
+	if !d.migEnabled {
+		return nil
+	}
+	return []string{"/dev/nvidiactl", "/dev/nvidia-uvm"}
+}
+
 func (d *NVIDIADevice) PhysicalID() string { // 对于MIG设备返回物理GPU索引（如"0"）
 	if d.migEnabled {
 		return d.physicalID
 	}
 	return d.deviceIndex
 }
-func (d *NVIDIADevice) Profile() string { return d.profile }
+
+// PhysicalCapacity MIG设备按架构表中该profile的最大实例数，整卡为时间片副本数
+func (d *NVIDIADevice) PhysicalCapacity() int {
+	if !d.migEnabled {
+		if d.replicas > 1 {
+			return d.replicas
+		}
+		return 1
+	}
+	arch := detectMIGArch(d.productName)
+	if arch == nil {
+		return 0
+	}
+	n, _ := arch.maxInstances(d.profile, 0)
+	return n
+}
+
+func (d *NVIDIADevice) Profile() string     { return d.profile }
+func (d *NVIDIADevice) NUMANode() int       { return d.numaNode }
+func (d *NVIDIADevice) ProductName() string { return d.productName }
+
+// Attributes 返回设备显存、MIG配置与降级维度
+func (d *NVIDIADevice) Attributes() map[string]string {
+	attrs := make(map[string]string)
+	if d.memoryMB > 0 {
+		attrs[AttrMemoryMB] = strconv.FormatUint(d.memoryMB, 10)
+	}
+	if d.migEnabled && d.profile != "" {
+		attrs[AttrMIGProfile] = d.profile
+	}
+	if d.numaNode >= 0 {
+		attrs[AttrNUMANode] = strconv.Itoa(d.numaNode)
+	}
+	if d.replicas > 1 {
+		attrs[AttrReplicas] = strconv.Itoa(d.replicas)
+	}
+	if d.memoryLimit > 0 {
+		attrs[AttrMemoryLimit] = strconv.FormatUint(d.memoryLimit, 10)
+	}
+	if d.rdma != nil {
+		attrs[AttrRDMADevice] = d.rdma.name
+	}
+	if d.productName != "" {
+		attrs[AttrProductName] = d.productName
+	}
+	if xid := d.LastXID(); xid != 0 {
+		attrs[AttrLastXID] = strconv.Itoa(xid)
+	}
+	if degradations := d.Degradations(); len(degradations) > 0 {
+		attrs[AttrDegradations] = strings.Join(degradations, ",")
+	}
+	return attrs
+}
+
+// LastXID 返回最近一次观测到的XID错误码，0表示无
+func (d *NVIDIADevice) LastXID() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.lastXID
+}
+
+func (d *NVIDIADevice) setLastXID(xid int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastXID = xid
+}
+
+// Degradations 返回最近一次健康检查发现的降级维度
+func (d *NVIDIADevice) Degradations() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return append([]string(nil), d.degradations...)
+}
+
+func (d *NVIDIADevice) setDegradations(degradations []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.degradations = degradations
+}
 
 type NVIDIAManager struct {
 	lastDiscovery time.Time
@@ -49,137 +184,460 @@ type NVIDIAManager struct {
 	deviceMap     map[string]*NVIDIADevice // 设备ID到设备对象的映射
 	discoverySync sync.Mutex
 	migManager    *MIGManager
+	backend       nvidiaBackend // GPU查询后端（nvidia-smi 或 NVML）
+	clock         clock.Clock
+	cacheTTL      time.Duration // 发现结果缓存时间，0表示禁用缓存
+	failedGPUs    []string      // 最近一次发现中查询失败而被跳过的物理GPU序号
+
+	linkMu         sync.Mutex
+	maxActiveLinks map[string]int // 物理GPU曾观测到的最大活跃NVLink数
+
+	fatalXIDs    map[int]bool // 视为致命的XID错误码
+	xidMu        sync.Mutex
+	xidEvents    map[string]int // PCI地址到最近XID的映射
+	xidScannedAt time.Time
+
+	eccThreshold atomic.Uint64 // 不可纠正ECC错误达到该值时判定不健康，可通过 Reload 修改
+	eccMu        sync.Mutex
+	eccCounts    map[string]uint64 // 物理GPU上次观测到的不可纠正ECC错误数
+
+	tempThreshold atomic.Uint64 // GPU温度超过该值(°C)时判定不健康，0表示不检查
+
+	healthMu  sync.Mutex
+	gpuHealth map[string]gpuHealthResult // 物理GPU最近一次的健康检查结果，MIG切片与时间片副本共用
+
+	discoveryConcurrency int  // 并行查询MIG设备的GPU数
+	timeSliceCount       int  // 未切分MIG的整卡按时间片共享上报的副本数，不大于1时独占
+	gpuDirect            bool // 为设备关联拓扑最近的RDMA网卡（GPUDirect RDMA）
+
+	profiles *profileTable // MIG profile 名称与ID映射，与MIG管理器共享
+
+	fallback *SimulatorManager // nvidia-smi 不存在且允许回退时使用模拟设备
 }
 
-// 初始化MIG管理器
+// 初始化MIG管理器，配置仅来自环境变量
 func NewNVIDIAManager() *NVIDIAManager {
-	return &NVIDIAManager{
-		migManager: NewMIGManager(),
-		deviceMap:  make(map[string]*NVIDIADevice),
+	return NewNVIDIAManagerWithConfig((&config.Config{}).Vendor("nvidia"))
+}
+
+// NewNVIDIAManagerWithConfig 按厂商配置创建，cfg 中已合并环境变量
+func NewNVIDIAManagerWithConfig(cfg config.VendorConfig) *NVIDIAManager {
+	if cfg.SmiPath != "" {
+		configuredSmiPath = cfg.SmiPath
+	}
+	cacheTTL := defaultDiscoveryCacheTTL
+	if cfg.CacheTTL != nil {
+		cacheTTL = cfg.CacheTTL.Duration
+	}
+	migManager := NewMIGManagerWithConfig(cfg.MIG)
+	m := &NVIDIAManager{
+		migManager:     migManager,
+		profiles:       migManager.profiles,
+		backend:        newNVIDIABackend(),
+		clock:          clock.RealClock{},
+		cacheTTL:       cacheTTL,
+		deviceMap:      make(map[string]*NVIDIADevice),
+		maxActiveLinks: make(map[string]int),
+		fatalXIDs:      fatalXIDSet(),
+		eccCounts:      make(map[string]uint64),
+		gpuHealth:      make(map[string]gpuHealthResult),
+
+		discoveryConcurrency: int(uint64FromEnv("DISCOVERY_CONCURRENCY", defaultDiscoveryConcurrency)),
+		timeSliceCount:       int(uint64FromEnv("NVIDIA_TIME_SLICE_COUNT", 1)),
+		gpuDirect:            os.Getenv("ENABLE_GPUDIRECT") == "true",
+		fallback:             simulatorFallback(),
+	}
+	m.eccThreshold.Store(defaultECCUncorrectedThreshold)
+	m.tempThreshold.Store(defaultGPUTempThreshold)
+	m.applyHealthConfig(cfg.Health)
+	return m
+}
+
+// applyHealthConfig 应用已设置的健康检查阈值
+func (m *NVIDIAManager) applyHealthConfig(cfg config.HealthConfig) {
+	if cfg.ECCThreshold != nil {
+		m.eccThreshold.Store(*cfg.ECCThreshold)
+	}
+	if cfg.TempThreshold != nil {
+		m.tempThreshold.Store(*cfg.TempThreshold)
+	}
+}
+
+// Reload 在线应用缓存时间、健康阈值和下次MIG配置使用的profile
+// smi路径等影响已运行进程的配置需重启生效
+func (m *NVIDIAManager) Reload(cfg config.VendorConfig) {
+	if cfg.CacheTTL != nil {
+		m.SetCacheTTL(cfg.CacheTTL.Duration)
+	}
+	m.applyHealthConfig(cfg.Health)
+	if m.migManager != nil {
+		m.migManager.Reload(cfg.MIG)
+	}
+	if cfg.SmiPath != "" && cfg.SmiPath != NvidiaSmiPath() {
+		klog.Warningf("nvidia-smi path changed to %s, restart required to take effect", cfg.SmiPath)
+	}
+	klog.Infof("NVIDIA configuration reloaded: eccThreshold=%d tempThreshold=%d",
+		m.eccThreshold.Load(), m.tempThreshold.Load())
+}
+
+// simulatorFallback 无GPU节点或开发环境下找不到nvidia-smi时，按 ALLOW_SIMULATOR_FALLBACK 决定是否使用模拟设备
+func simulatorFallback() *SimulatorManager {
+	if nvidiaSmiAvailable() || os.Getenv("ALLOW_SIMULATOR_FALLBACK") != "true" {
+		return nil
+	}
+	klog.Warningf("nvidia-smi not found at %s, NVIDIA plugin is running in SIMULATION mode with fake devices", NvidiaSmiPath())
+	return NewSimulatorManager()
+}
+
+// getBackend 未初始化时使用 nvidia-smi 后端
+func (m *NVIDIAManager) getBackend() nvidiaBackend {
+	if m.backend == nil {
+		return smiBackend{}
+	}
+	return m.backend
+}
+
+// SetClock 替换时间来源，用于测试
+func (m *NVIDIAManager) SetClock(c clock.Clock) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.clock = c
+}
+
+// SetCacheTTL 设置发现结果缓存时间，0表示禁用缓存
+func (m *NVIDIAManager) SetCacheTTL(ttl time.Duration) {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.cacheTTL = ttl
+}
+
+// InvalidateCache 使发现缓存失效，下次 DiscoverGPUs 重新查询 nvidia-smi
+func (m *NVIDIAManager) InvalidateCache() {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	m.devices = nil
+	m.lastDiscovery = time.Time{}
+	m.profiles.invalidate()
+	m.healthMu.Lock()
+	m.gpuHealth = make(map[string]gpuHealthResult)
+	m.healthMu.Unlock()
+	klog.V(4).Info("NVIDIA discovery cache invalidated")
+}
+
+// WatchHealth 后端支持事件（NVML）时立即推送受影响的设备，同时保留轮询
+func (m *NVIDIAManager) WatchHealth(ctx context.Context, changed chan<- string) {
+	if source, ok := m.getBackend().(healthEventSource); ok && m.fallback == nil {
+		go func() {
+			err := source.WatchEvents(ctx, func(gpuIndex string) {
+				ids := m.devicesOnGPU(gpuIndex)
+				m.InvalidateCache()
+				for _, id := range ids {
+					select {
+					case changed <- id:
+					case <-ctx.Done():
+						return
+					}
+				}
+			})
+			if err != nil {
+				klog.Errorf("NVIDIA health events unavailable, relying on polling: %v", err)
+			}
+		}()
 	}
+	PollHealth(ctx, m, healthPollInterval(), changed)
 }
 
-// 获取nvidia-smi的路径
-func getNvidiaSmiPath() string {
+// devicesOnGPU 返回位于指定物理GPU上的设备ID（整卡或其MIG设备）
+func (m *NVIDIAManager) devicesOnGPU(gpuIndex string) []string {
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	var ids []string
+	for id, d := range m.deviceMap {
+		if d.physicalID == gpuIndex {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// configuredSmiPath 配置文件中的nvidia-smi路径，在创建管理器时设置
+var configuredSmiPath string
+
+// NvidiaSmiPath 获取nvidia-smi的路径，NVIDIA_SMI_PATH 优先于配置文件
+func NvidiaSmiPath() string {
 	if customPath := os.Getenv("NVIDIA_SMI_PATH"); customPath != "" {
 		klog.V(4).Infof("Using custom NVIDIA-SMI path: %s", customPath)
 		return customPath
 	}
+	if configuredSmiPath != "" {
+		return configuredSmiPath
+	}
 	return "/host-driver/nvidia-smi"
 }
 
+// nvidiaSmiAvailable 判断nvidia-smi是否存在
+func nvidiaSmiAvailable() bool {
+	_, err := os.Stat(NvidiaSmiPath())
+	return err == nil
+}
+
+// 默认允许同时运行的nvidia-smi进程数
+const defaultSmiMaxConcurrent = 4
+
+// smiSemaphore 全局限制nvidia-smi并发进程数，保护资源受限的节点
+var smiSemaphore = semaphore.NewWeighted(getSmiMaxConcurrent())
+
+// 获取nvidia-smi并发上限
+func getSmiMaxConcurrent() int64 {
+	if limitStr := os.Getenv("NVIDIA_SMI_MAX_CONCURRENT"); limitStr != "" {
+		if limit, err := strconv.ParseInt(limitStr, 10, 64); err == nil && limit > 0 {
+			return limit
+		}
+		klog.Warningf("Invalid NVIDIA_SMI_MAX_CONCURRENT %q, using default %d", limitStr, defaultSmiMaxConcurrent)
+	}
+	return defaultSmiMaxConcurrent
+}
+
+// 默认的nvidia-smi超时时间
+const defaultSmiTimeout = 10 * time.Second
+
+// smiTimeout 单次nvidia-smi调用（含排队等待）的超时时间，驱动卡死时避免无限阻塞
+var smiTimeout = getSmiTimeout()
+
+// errNvidiaSmiTimeout nvidia-smi 超时，通常意味着驱动已无响应
+var errNvidiaSmiTimeout = errors.New("nvidia-smi timed out")
+
+// 获取nvidia-smi超时时间
+func getSmiTimeout() time.Duration {
+	if value := os.Getenv("NVIDIA_SMI_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+			return timeout
+		}
+		klog.Warningf("Invalid NVIDIA_SMI_TIMEOUT %q, using default %v", value, defaultSmiTimeout)
+	}
+	return defaultSmiTimeout
+}
+
 // 确保命令使用正确的库路径
-func runNvidiaSmiCommand(args ...string) ([]byte, error) {
-	cmd := exec.Command(getNvidiaSmiPath(), args...)
+func runNvidiaSmiCommand(ctx context.Context, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, smiTimeout)
+	defer cancel()
+
+	// 达到并发上限时阻塞等待，直到ctx结束
+	if err := smiSemaphore.Acquire(ctx, 1); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			metrics.NvidiaSmiFailures.Inc()
+			return nil, fmt.Errorf("%w waiting for a free slot after %v", errNvidiaSmiTimeout, smiTimeout)
+		}
+		return nil, fmt.Errorf("waiting for nvidia-smi slot: %v", err)
+	}
+	defer smiSemaphore.Release(1)
+
+	cmd := exec.CommandContext(ctx, NvidiaSmiPath(), args...)
 	cmd.Env = append(os.Environ(),
 		"LD_LIBRARY_PATH=/usr/lib/x86_64-linux-gnu:/host-lib",
 		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
 	)
 	klog.Infof("Executing NVIDIA-SMI command: %v", cmd.Args)
-	return cmd.CombinedOutput()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		metrics.NvidiaSmiFailures.Inc()
+		if ctx.Err() == context.DeadlineExceeded {
+			return out, fmt.Errorf("%w after %v: %v", errNvidiaSmiTimeout, smiTimeout, cmd.Args)
+		}
+	}
+	return out, err
 }
 
 func (m *NVIDIAManager) DiscoverGPUs() ([]GPUDevice, error) {
+	if m.fallback != nil {
+		return m.fallback.DiscoverGPUs()
+	}
 	m.discoverySync.Lock()
 	defer m.discoverySync.Unlock()
 
 	// 使用缓存机制
-	if time.Since(m.lastDiscovery) < 5*time.Minute && m.devices != nil {
+	if m.cacheTTL > 0 && clock.OrReal(m.clock).Since(m.lastDiscovery) < m.cacheTTL && m.devices != nil {
 		klog.V(4).Infof("Using cached NVIDIA devices (last discovery: %s)", m.lastDiscovery)
 		return m.devices, nil
 	}
 
 	klog.Info("Discovering NVIDIA devices")
-
-	// 重置设备映射
-	m.deviceMap = make(map[string]*NVIDIADevice)
-	var devices []GPUDevice
+	ctx := context.Background() // 每条nvidia-smi命令单独受 NVIDIA_SMI_TIMEOUT 限制
 
 	// 步骤1: 获取所有GPU设备列表
-	out, err := runNvidiaSmiCommand("--query-gpu=index,uuid,memory.total,mig.mode.current", "--format=csv,noheader")
+	gpus, err := m.getBackend().ListGPUs(ctx)
 	if err != nil {
 		klog.Errorf("Failed to discover NVIDIA GPUs: %v", err)
 		return nil, err
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		fields := strings.Split(line, ",")
-		if len(fields) < 4 {
+	// 列表查询成功后才重置设备映射，保留上一轮的设备以延续健康检查结果
+	previous := m.deviceMap
+	m.deviceMap = make(map[string]*NVIDIADevice)
+	var devices []GPUDevice
+
+	// 并行查询各GPU上的MIG设备，结果按GPU顺序组装以保持设备列表稳定
+	migEnabled := m.migEnabled()
+	migResults := m.listMIGDevices(ctx, gpus, migEnabled)
+
+	// 单块GPU查询失败时跳过该GPU，其余设备照常上报
+	var gpuErrs []error
+	var failed []string
+	for i, gpu := range gpus {
+		if gpu.err != nil {
+			klog.Errorf("Failed to query NVIDIA GPU %s: %v", gpu.index, gpu.err)
+			gpuErrs = append(gpuErrs, fmt.Errorf("GPU %s: %v", gpu.index, gpu.err))
+			failed = append(failed, gpu.index)
 			continue
 		}
-
-		gpuIndex := strings.TrimSpace(fields[0])
-		gpuUUID := strings.TrimSpace(fields[1])
-		migMode := strings.TrimSpace(fields[3])
+		numaNode := readNUMANode(gpu.pciBusID)
 
 		// 步骤2: 检查MIG模式
-		if migMode == "Enabled" && os.Getenv("ENABLE_MIG") == "true" {
+		if gpu.migEnabled && migEnabled {
 
 			// 获取MIG设备
-			migDevices, err := m.discoverMIGDevices(gpuIndex)
-			if err != nil {
-				klog.Errorf("Failed to discover MIG devices for GPU %s: %v", gpuIndex, err)
+			if err := migResults[i].err; err != nil {
+				klog.Errorf("Failed to discover MIG devices for GPU %s: %v", gpu.index, err)
+				gpuErrs = append(gpuErrs, fmt.Errorf("GPU %s: %v", gpu.index, err))
+				failed = append(failed, gpu.index)
 				continue
 			}
+			migDevices := m.discoverMIGDevices(gpu, numaNode, migResults[i].infos)
 			devices = append(devices, migDevices...)
 		} else {
 			// 普通GPU设备
 			device := &NVIDIADevice{
-				id:          gpuUUID,
-				deviceIndex: gpuIndex,
-				physicalID:  gpuIndex,
+				id:          gpu.uuid,
+				uuid:        gpu.uuid,
+				deviceIndex: gpu.index,
+				physicalID:  gpu.index,
 				migEnabled:  false,
+				memoryMB:    gpu.memoryMB,
+				pciBusID:    gpu.pciBusID,
+				numaNode:    numaNode,
+				productName: gpu.name,
 				healthy:     true,
 			}
-			devices = append(devices, device)
-			m.deviceMap[gpuUUID] = device
+			// 开启时间片共享时每块GPU上报多个副本，分配时映射回同一UUID
+			for _, replica := range timeSliceReplicas(device, m.timeSliceCount) {
+				devices = append(devices, replica)
+				m.deviceMap[replica.id] = replica
+			}
+		}
+	}
+
+	m.failedGPUs = failed
+	// 所有GPU均失败时才视为发现失败，避免把空列表当作节点上没有设备
+	if len(devices) == 0 && len(gpuErrs) > 0 {
+		m.deviceMap = previous
+		return nil, fmt.Errorf("failed to enumerate any NVIDIA device: %w", errors.Join(gpuErrs...))
+	}
+	if len(gpuErrs) > 0 {
+		klog.Warningf("Skipped %d of %d NVIDIA GPUs that failed discovery", len(gpuErrs), len(gpus))
+	}
+
+	if m.gpuDirect {
+		m.attachRDMA(devices)
+	}
+	// 重新发现不代表设备已恢复，沿用上次检查结果，避免健康轮询反复报告同一变化
+	for id, d := range m.deviceMap {
+		if old, ok := previous[id]; ok {
+			d.setHealthy(old.IsHealthy())
 		}
 	}
 
 	klog.Infof("Discovered %d NVIDIA devices", len(devices))
 	for _, d := range devices {
 		nvDevice := d.(*NVIDIADevice)
-		klog.Infof("NVIDIA Device: ID=%s, Index=%s, MIG=%v, Profile=%s",
-			nvDevice.ID(), nvDevice.deviceIndex, nvDevice.IsMIG(), nvDevice.Profile())
+		klog.Infof("NVIDIA Device: ID=%s, Index=%s, Product=%s, MIG=%v, Profile=%s",
+			nvDevice.ID(), nvDevice.deviceIndex, nvDevice.productName, nvDevice.IsMIG(), nvDevice.Profile())
 	}
 
 	m.devices = devices
-	m.lastDiscovery = time.Now()
+	m.lastDiscovery = clock.OrReal(m.clock).Now()
 	return devices, nil
 }
 
-// 发现MIG设备
-func (m *NVIDIAManager) discoverMIGDevices(gpuIndex string) ([]GPUDevice, error) {
-	var devices []GPUDevice
+// FailedPhysicalIDs 返回最近一次发现中查询失败的物理GPU序号
+func (m *NVIDIAManager) FailedPhysicalIDs() []string {
+	if m.fallback != nil {
+		return nil
+	}
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	return append([]string(nil), m.failedGPUs...)
+}
 
-	// 查询GPU实例（GPU Instances）
-	out, err := runNvidiaSmiCommand("mig", "-lgi", "-i", gpuIndex)
-	output := strings.TrimSpace(string(out))
+// parseMemoryMB 解析 memory.total 字段，如 "40960 MiB"
+func parseMemoryMB(field string) uint64 {
+	parts := strings.Fields(field)
+	if len(parts) == 0 {
+		return 0
+	}
+	memoryMB, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		klog.V(4).Infof("Failed to parse GPU memory %q: %v", field, err)
+		return 0
+	}
+	return memoryMB
+}
+
+// sysfs中PCI设备目录，测试时可替换
+var sysfsPCIDevicesPath = "/sys/bus/pci/devices"
+
+// sysfsBusID 将 nvidia-smi 的总线地址 "00000000:3B:00.0" 转换为 sysfs 使用的 "0000:3b:00.0"
+func sysfsBusID(pciBusID string) string {
+	busID := strings.ToLower(pciBusID)
+	if parts := strings.SplitN(busID, ":", 2); len(parts) == 2 && len(parts[0]) > 4 {
+		busID = parts[0][len(parts[0])-4:] + ":" + parts[1]
+	}
+	return busID
+}
 
-	// 处理无GPU实例的情况
-	if strings.Contains(output, "No GPU instances found") {
-		klog.Infof("No MIG GPU instances found on GPU %s", gpuIndex)
-		return devices, nil
+// readNUMANode 通过sysfs解析GPU所在NUMA节点，未知时返回-1
+func readNUMANode(pciBusID string) int {
+	busID := sysfsBusID(pciBusID)
+	if busID == "" {
+		return -1
 	}
 
+	data, err := os.ReadFile(filepath.Join(sysfsPCIDevicesPath, busID, "numa_node"))
 	if err != nil {
-		klog.Errorf("Failed to query GPU instances for GPU %s: %v", gpuIndex, err)
-		return nil, err
+		klog.V(4).Infof("Failed to read NUMA node for PCI device %s: %v", busID, err)
+		return -1
 	}
+	numaNode, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || numaNode < 0 {
+		return -1
+	}
+	return numaNode
+}
 
-	uuids, err := m.getMIGDeviceUUIDs(gpuIndex)
+// 发现MIG设备
+// MIG设备继承物理GPU的PCI地址与NUMA节点
+func (m *NVIDIAManager) discoverMIGDevices(gpu nvidiaGPU, numaNode int, migInfos []migDeviceInfo) []GPUDevice {
+	var devices []GPUDevice
 
-	for index, uuid := range uuids {
+	for index, info := range migInfos {
 		// 创建设备ID: GPUIndex-GI-CI
+		uuid := info.uuid
+		if info.profile == "" {
+			klog.Warningf("Unable to determine MIG profile for device %s on GPU %s", uuid, gpu.index)
+		}
 
 		klog.Infof("Device ID: %s", uuid)
 		device := &NVIDIADevice{
 			id:          uuid,
+			uuid:        info.uuid,
 			deviceIndex: string(rune(index)), // 使用GPU实例ID作为设备索引
-			physicalID:  gpuIndex,
+			physicalID:  gpu.index,
 			migEnabled:  true,
-			profile:     "3g.20gb",
+			profile:     info.profile,
+			memoryMB:    profileMemoryMB(info.profile),
+			pciBusID:    gpu.pciBusID,
+			numaNode:    numaNode,
+			productName: gpu.name,
 			healthy:     true,
 		}
 		klog.Infof("device: %v", device)
@@ -189,142 +647,385 @@ func (m *NVIDIAManager) discoverMIGDevices(gpuIndex string) ([]GPUDevice, error)
 		klog.Infof("Found device: %v", device)
 	}
 
-	return devices, nil
+	return devices
 }
 
-// 获取指定GPU上的MIG设备UUID
-func (m *NVIDIAManager) getMIGDeviceUUIDs(gpuIndex string) ([]string, error) {
-	// 使用nvidia-smi -L命令获取所有GPU信息
-	out, err := runNvidiaSmiCommand("-L")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get MIG UUIDs: %v", err)
-	}
+// 默认并行查询MIG设备的GPU数
+const defaultDiscoveryConcurrency = 4
 
-	output := strings.TrimSpace(string(out))
-	lines := strings.Split(output, "\n")
+// migListResult 单块GPU的MIG查询结果
+type migListResult struct {
+	infos []migDeviceInfo
+	err   error
+}
 
-	var uuids []string
-	currentGPU := ""
+// listMIGDevices 以有限并发查询启用MIG的GPU上的MIG设备，结果与 gpus 一一对应
+func (m *NVIDIAManager) listMIGDevices(ctx context.Context, gpus []nvidiaGPU, migEnabled bool) []migListResult {
+	results := make([]migListResult, len(gpus))
+	if !migEnabled {
+		return results
+	}
 
-	for _, line := range lines {
-		// 匹配GPU行
-		if strings.HasPrefix(line, "GPU "+gpuIndex+":") {
-			currentGPU = gpuIndex
+	concurrency := m.discoveryConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultDiscoveryConcurrency
+	}
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, gpu := range gpus {
+		if !gpu.migEnabled {
 			continue
 		}
-
-		// 匹配MIG设备行
-		if currentGPU == gpuIndex && strings.Contains(line, "MIG") && strings.Contains(line, "UUID") {
-			parts := strings.Split(line, "UUID:")
-			if len(parts) >= 2 {
-				uuid := strings.TrimSpace(parts[1])
-				// 移除末尾的括号
-				uuid = strings.TrimSuffix(uuid, ")")
-				uuids = append(uuids, uuid)
-			}
-		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, gpu nvidiaGPU) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			infos, err := m.getBackend().ListMIG(ctx, gpu.index)
+			results[i] = migListResult{infos: infos, err: err}
+		}(i, gpu)
 	}
-
-	klog.Infof("Found %d MIG UUIDs for GPU %s: %v", len(uuids), gpuIndex, uuids)
-	return uuids, nil
+	wg.Wait()
+	return results
 }
 
+// getProfileName 通过缓存的profile表查询名称
 func (m *NVIDIAManager) getProfileName(profileID string) (string, error) {
-	// 查询所有可用profile
-	out, err := runNvidiaSmiCommand("mig", "-lgip")
+	id, err := strconv.Atoi(profileID)
 	if err != nil {
-		return "", err
+		return "unknown", fmt.Errorf("invalid profile ID %q: %v", profileID, err)
 	}
+	return m.profiles.Name(context.Background(), id)
+}
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, profileID) {
-			// 示例行: "   19     4     4      0       1      0     0     0     0     1     0     0      0      0     0     0     0     0     0     0     0     0     0     0     0     0     0     0     0     0     0     0  1g.10gb"
-			fields := strings.Fields(line)
-			if len(fields) > 0 {
-				// 最后一个字段是profile名称
-				return fields[len(fields)-1], nil
-			}
+// GetDevice 从设备映射中查找，映射为空（尚未发现）时执行一次发现
+func (m *NVIDIAManager) GetDevice(id string) (GPUDevice, bool) {
+	if m.fallback != nil {
+		return m.fallback.GetDevice(id)
+	}
+	m.discoverySync.Lock()
+	empty := len(m.deviceMap) == 0
+	m.discoverySync.Unlock()
+	if empty {
+		if _, err := m.DiscoverGPUs(); err != nil {
+			klog.V(4).Infof("Failed to discover NVIDIA devices for lookup: %v", err)
+			return nil, false
 		}
 	}
-	return "unknown", fmt.Errorf("profile not found for ID %s", profileID)
+	m.discoverySync.Lock()
+	defer m.discoverySync.Unlock()
+	d, ok := m.deviceMap[id]
+	if !ok {
+		return nil, false
+	}
+	return d, true
 }
 
 // 健康检查
 func (m *NVIDIAManager) CheckHealth(deviceID string) bool {
-	klog.V(5).Infof("Checking health of NVIDIA device %s", deviceID)
+	if m.fallback != nil {
+		return m.fallback.CheckHealth(deviceID)
+	}
+	klog.V(5).InfoS("Checking device health", "vendor", "nvidia", "device_id", deviceID)
+	ctx := context.Background() // 每条nvidia-smi命令单独受 NVIDIA_SMI_TIMEOUT 限制
 
-	// 从设备映射中获取设备
+	// 从设备映射中获取设备，映射可能正被并发的发现替换
+	m.discoverySync.Lock()
 	device, exists := m.deviceMap[deviceID]
+	m.discoverySync.Unlock()
 	if !exists {
-		klog.Warningf("Device %s not found in device map", deviceID)
+		klog.InfoS("Device not found in device map, marking unhealthy", "vendor", "nvidia", "device_id", deviceID)
 		return false
 	}
+	healthy := m.checkDeviceHealth(ctx, device)
+	device.setHealthy(healthy)
+	return healthy
+}
 
-	// 对于MIG设备，检查其物理GPU的健康
-	targetID := deviceID
+// 物理GPU健康检查结果的缓存时间，同一轮检查中同一GPU上的MIG切片与时间片副本只查询一次
+const gpuHealthCacheTTL = 5 * time.Second
+
+// gpuHealthResult 物理GPU的健康检查结果
+type gpuHealthResult struct {
+	healthy      bool
+	responded    bool     // GPU是否响应了查询，未响应时不更新XID
+	xid          int      // 最近一次XID错误码
+	degradations []string // 降级维度，仅在健康时检查
+	checkedAt    time.Time
+}
+
+// checkDeviceHealth 按设备所在物理GPU的检查结果更新设备的XID与降级维度
+func (m *NVIDIAManager) checkDeviceHealth(ctx context.Context, device *NVIDIADevice) bool {
+	// 对于MIG设备，检查其物理GPU的健康；时间片副本检查其所属GPU
+	targetID := device.VisibleDeviceID()
 	if device.IsMIG() {
 		targetID = device.PhysicalID()
 	}
 
-	// 使用更通用的健康检查方式
-	out, err := runNvidiaSmiCommand("-i", targetID, "--query-gpu=utilization.gpu", "--format=csv,noheader")
-	if err != nil {
-		klog.Errorf("Failed to check health for NVIDIA device %s: %v", targetID, err)
+	result := m.physicalGPUHealth(ctx, targetID, device.pciBusID)
+	if result.responded {
+		device.setLastXID(result.xid)
+	}
+	if !result.healthy {
 		return false
 	}
+	klog.V(4).InfoS("Device is healthy", "vendor", "nvidia", "device_id", device.ID(), "gpu", targetID)
+	device.setDegradations(result.degradations)
+	return true
+}
+
+// physicalGPUHealth 返回物理GPU的健康检查结果，gpuHealthCacheTTL 内复用上次的结果
+func (m *NVIDIAManager) physicalGPUHealth(ctx context.Context, gpuID, pciBusID string) gpuHealthResult {
+	now := clock.OrReal(m.clock).Now()
+	m.healthMu.Lock()
+	cached, ok := m.gpuHealth[gpuID]
+	m.healthMu.Unlock()
+	if ok && now.Sub(cached.checkedAt) < gpuHealthCacheTTL {
+		return cached
+	}
+
+	result := m.checkGPUHealth(ctx, gpuID, pciBusID)
+	result.checkedAt = now
+	m.healthMu.Lock()
+	if m.gpuHealth == nil {
+		m.gpuHealth = make(map[string]gpuHealthResult)
+	}
+	m.gpuHealth[gpuID] = result
+	m.healthMu.Unlock()
+	return result
+}
 
+// checkGPUHealth 检查物理GPU的可用性、XID、ECC与温度，健康时继续检查降级维度
+func (m *NVIDIAManager) checkGPUHealth(ctx context.Context, gpuID, pciBusID string) gpuHealthResult {
 	// 如果能够获取到GPU利用率数据，则认为设备健康
-	utilization := strings.TrimSpace(string(out))
-	if utilization != "" {
-		klog.V(4).Infof("NVIDIA device %s is healthy (utilization: %s%%)", targetID, utilization)
+	utilization, err := m.getBackend().Utilization(ctx, gpuID)
+	if errors.Is(err, errNvidiaSmiTimeout) {
+		klog.ErrorS(err, "GPU is not responding, marking unhealthy", "vendor", "nvidia", "gpu", gpuID)
+		return gpuHealthResult{}
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to check device health", "vendor", "nvidia", "gpu", gpuID)
+		return gpuHealthResult{}
+	}
+
+	// GPU仍可响应但可能已发生致命XID错误
+	result := gpuHealthResult{responded: true, xid: m.recentXID(pciBusID)}
+	if result.xid != 0 {
+		if m.fatalXIDs[result.xid] {
+			klog.ErrorS(nil, "Fatal XID, marking GPU unhealthy", "vendor", "nvidia", "gpu", gpuID, "xid", result.xid)
+			return result
+		}
+		klog.InfoS("Non-fatal XID reported", "vendor", "nvidia", "gpu", gpuID, "xid", result.xid)
+	}
+	if !m.checkECC(ctx, gpuID) || !m.checkTemperature(ctx, gpuID) {
+		return result
+	}
+	result.healthy = true
+	klog.V(4).InfoS("GPU is healthy", "vendor", "nvidia", "gpu", gpuID, "utilization", utilization)
+
+	// 设备可用，继续检查降级维度（不影响健康状态）
+	result.degradations = m.detectDegradations(ctx, gpuID)
+	if len(result.degradations) > 0 {
+		klog.InfoS("GPU is degraded", "vendor", "nvidia", "gpu", gpuID, "degradations", result.degradations)
+	}
+	return result
+}
+
+// 默认的不可纠正ECC错误阈值
+const defaultECCUncorrectedThreshold = 1
+
+// checkECC 检查物理GPU累计不可纠正ECC错误，达到阈值时返回false
+func (m *NVIDIAManager) checkECC(ctx context.Context, gpuID string) bool {
+	threshold := m.eccThreshold.Load()
+	if threshold == 0 {
 		return true
 	}
+	count, supported, err := m.getBackend().UncorrectedECCErrors(ctx, gpuID)
+	if err != nil {
+		klog.V(4).Infof("Failed to query ECC errors for GPU %s: %v", gpuID, err)
+		return true // 查询失败不影响健康判断
+	}
+	if !supported {
+		return true
+	}
+
+	m.eccMu.Lock()
+	last, seen := m.eccCounts[gpuID]
+	m.eccCounts[gpuID] = count
+	m.eccMu.Unlock()
+	if seen && count > last {
+		klog.Warningf("GPU %s uncorrected ECC errors increased by %d (total %d)", gpuID, count-last, count)
+	}
 
-	return false
+	if count >= threshold {
+		klog.Errorf("GPU %s has %d uncorrected ECC errors (threshold %d), marking unhealthy", gpuID, count, threshold)
+		return false
+	}
+	return true
+}
+
+// 默认的GPU温度阈值(°C)
+const defaultGPUTempThreshold = 90
+
+// checkTemperature 检查物理GPU温度，超过阈值时返回false（恰好等于阈值仍视为健康）
+func (m *NVIDIAManager) checkTemperature(ctx context.Context, gpuID string) bool {
+	threshold := m.tempThreshold.Load()
+	if threshold == 0 {
+		return true
+	}
+	temperature, err := m.getBackend().Temperature(ctx, gpuID)
+	if err != nil {
+		klog.V(4).Infof("Failed to query temperature for GPU %s: %v", gpuID, err)
+		return true // 查询失败不影响健康判断
+	}
+	klog.V(4).Infof("GPU %s temperature: %d°C (threshold %d°C)", gpuID, temperature, threshold)
+
+	if uint64(temperature) > threshold {
+		klog.Errorf("GPU %s temperature %d°C exceeds threshold %d°C, marking unhealthy", gpuID, temperature, threshold)
+		return false
+	}
+	return true
+}
+
+// detectDegradations 通过后端检查NVLink、可纠正ECC与温控降频，返回降级维度
+func (m *NVIDIAManager) detectDegradations(ctx context.Context, gpuID string) []string {
+	status, err := m.getBackend().DegradationStatus(ctx, gpuID)
+	if err != nil {
+		klog.V(4).Infof("Failed to query degradation status for GPU %s: %v", gpuID, err)
+	}
+
+	var degradations []string
+	if status.activeLinks >= 0 && m.nvlinkDegraded(gpuID, status.activeLinks) {
+		degradations = append(degradations, DegradationNVLink)
+	}
+	if status.correctedECC > 0 {
+		degradations = append(degradations, DegradationECC)
+	}
+	if status.thermalSlowdown {
+		degradations = append(degradations, DegradationThermal)
+	}
+	return degradations
+}
+
+// nvlinkDegraded 活跃链路数低于历史最大值即视为NVLink降级
+// 未配置NVLink桥接的GPU所有链路始终为inactive，不会被误判
+func (m *NVIDIAManager) nvlinkDegraded(gpuIndex string, active int) bool {
+	m.linkMu.Lock()
+	defer m.linkMu.Unlock()
+
+	if active > m.maxActiveLinks[gpuIndex] {
+		m.maxActiveLinks[gpuIndex] = active
+	}
+	return active < m.maxActiveLinks[gpuIndex]
+}
+
+// countActiveNVLinks 统计 nvlink -s 输出中的活跃链路
+// 示例行: "	 Link 0: 25 GB/s" 或 "	 Link 1: <inactive>"
+func countActiveNVLinks(output string) int {
+	active := 0
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "Link ") {
+			continue
+		}
+		if !strings.Contains(line, "<inactive>") {
+			active++
+		}
+	}
+	return active
+}
+
+// SetInUseChecker 设置判断物理GPU上是否有已分配设备的回调，重新切分前据此避免销毁使用中的实例
+func (m *NVIDIAManager) SetInUseChecker(inUse func(gpuIndex string) bool) {
+	if m.migManager == nil {
+		return
+	}
+	m.migManager.mu.Lock()
+	defer m.migManager.mu.Unlock()
+	m.migManager.inUse = inUse
+}
+
+// migEnabled 是否上报MIG设备，未初始化MIG管理器时沿用 ENABLE_MIG
+func (m *NVIDIAManager) migEnabled() bool {
+	if m.migManager == nil {
+		return os.Getenv("ENABLE_MIG") == "true"
+	}
+	return m.migManager.enabled
 }
 
 // MIG管理功能
 func (m *NVIDIAManager) ConfigureMIG() {
+	if m.fallback != nil {
+		klog.Info("Skipping MIG configuration in simulation mode")
+		return
+	}
 	klog.Info("Configuring MIG devices")
 	m.migManager.Configure()
 }
 
 // MIG管理器
 type MIGManager struct {
+	mu             sync.Mutex // 串行化 Configure 与 Reload
 	enabled        bool
-	profile        string
+	profileSpec    string            // 原始 MIG_PROFILE 配置
+	profile        string            // 默认profile
+	gpuProfiles    map[string]string // 按GPU序号单独配置的profile
+	autoProfile    bool              // 未配置默认profile，按GPU架构选择
 	skipConfigured bool
-	instanceCount  int    // 每个GPU上要创建的实例数
+	instanceCount  int  // 每个GPU上要创建的实例数
+	createRetries  int  // 创建实例数量不足时的重试次数
+	forceReconfig  bool // 物理GPU上仍有分配时是否强制重新切分
+	create         bool // 是否实际切分GPU，关闭时只输出切分计划
+	inUse          func(gpuIndex string) bool
 	gpuMemory      uint64 // GPU显存大小(MB)
+	profiles       *profileTable
 }
 
 func NewMIGManager() *MIGManager {
-	enabled := os.Getenv("ENABLE_MIG") == "true"
-	profile := os.Getenv("MIG_PROFILE")
-	if profile == "" {
-		profile = "3g.20gb" // 默认20GB切分策略
+	return NewMIGManagerWithConfig((&config.Config{}).Vendor("nvidia").MIG)
+}
+
+// Reload 更新下次 Configure 使用的profile和实例数，已创建的MIG设备不受影响
+func (m *MIGManager) Reload(cfg config.MIGConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cfg.Profile != "" && cfg.Profile != m.profileSpec {
+		klog.Infof("MIG profile changed from %s to %s, applies on next reconfigure", m.profileSpec, cfg.Profile)
+		m.profileSpec = cfg.Profile
+		m.profile, m.gpuProfiles = parseMIGProfiles(cfg.Profile)
+		m.autoProfile = !hasDefaultMIGProfile(cfg.Profile)
 	}
+	m.instanceCount = cfg.InstanceCount
+	if cfg.Enabled != nil && *cfg.Enabled != m.enabled {
+		klog.Warningf("Changing MIG enabled to %v requires a restart", *cfg.Enabled)
+	}
+}
 
-	skipConfigured := os.Getenv("SKIP_CONFIGURED") == "true"
+// 默认的MIG实例创建重试次数
+const defaultMIGCreateRetries = 2
 
-	// 读取实例数量配置
-	instanceCount := 0 // 0表示自动计算
-	if countStr := os.Getenv("MIG_INSTANCE_COUNT"); countStr != "" {
-		if count, err := strconv.Atoi(countStr); err == nil {
-			instanceCount = count
-		}
-	}
+// NewMIGManagerWithConfig 按MIG配置创建，未设置的字段使用默认值
+func NewMIGManagerWithConfig(cfg config.MIGConfig) *MIGManager {
+	profile, gpuProfiles := parseMIGProfiles(cfg.Profile)
 
 	return &MIGManager{
-		enabled:        enabled,
+		enabled:        cfg.Enabled != nil && *cfg.Enabled,
+		profileSpec:    cfg.Profile,
 		profile:        profile,
-		skipConfigured: skipConfigured,
-		instanceCount:  instanceCount,
+		gpuProfiles:    gpuProfiles,
+		autoProfile:    !hasDefaultMIGProfile(cfg.Profile),
+		skipConfigured: cfg.SkipConfigured != nil && *cfg.SkipConfigured,
+		instanceCount:  cfg.InstanceCount, // 0表示自动计算
+		createRetries:  int(uint64FromEnv("MIG_CREATE_RETRIES", defaultMIGCreateRetries)),
+		forceReconfig:  os.Getenv("MIG_FORCE_RECONFIG") == "true",
+		create:         os.Getenv("MIG_CREATE") == "true",
+		profiles:       newProfileTable(),
 	}
 }
 
 func (m *MIGManager) Configure() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	klog.Info("MIG configuration is in process ")
 
@@ -333,7 +1034,7 @@ func (m *MIGManager) Configure() {
 		return
 	}
 
-	klog.Infof("Starting MIG configuration with profile: %s", m.profile)
+	klog.Infof("Starting MIG configuration with profile: %s, per-GPU profiles: %v", m.profile, m.gpuProfiles)
 
 	// 检查设备是否支持MIG
 	if supported, err := m.isMigSupported(); err != nil {
@@ -344,16 +1045,37 @@ func (m *MIGManager) Configure() {
 		return
 	}
 
-	// 2. 创建MIG设备 fixme 先不要创建设备
-	//if err := m.createMIGDevices(); err != nil {
-	//	klog.Errorf("Failed to create MIG devices: %v", err)
-	//}
+	// 切分会销毁现有实例，需 MIG_CREATE=true 显式开启，否则只记录计划
+	if !m.create {
+		m.logPlan()
+		return
+	}
+	if err := m.createMIGDevices(); err != nil {
+		klog.Errorf("Failed to create MIG devices: %v", err)
+	}
+}
+
+// logPlan 输出切分计划而不修改GPU，调用方需持有锁
+func (m *MIGManager) logPlan() {
+	plans, err := m.plan()
+	if err != nil {
+		klog.Errorf("Failed to plan MIG configuration: %v", err)
+		return
+	}
+	for _, p := range plans {
+		if p.Skip {
+			klog.Infof("MIG plan for GPU %s: skip (%s)", p.GPU, p.Reason)
+			continue
+		}
+		klog.Infof("MIG plan for GPU %s: destroy %d and create %d instance(s) of %s, set MIG_CREATE=true to apply",
+			p.GPU, p.Existing, p.Create, p.Profile)
+	}
 }
 
 // 检查设备是否支持MIG
 func (m *MIGManager) isMigSupported() (bool, error) {
 	// 检查MIG支持状态
-	out, err := runNvidiaSmiCommand("mig", "-lgip")
+	out, err := runNvidiaSmiCommand(context.Background(), "mig", "-lgip")
 	output := strings.TrimSpace(string(out))
 
 	// 先检查特定不支持信息
@@ -385,7 +1107,7 @@ func (m *MIGManager) isMigSupported() (bool, error) {
 }
 
 func (m *MIGManager) enableMIGMode() error {
-	out, err := runNvidiaSmiCommand("--enable-mig")
+	out, err := runNvidiaSmiCommand(context.Background(), "--enable-mig")
 	if err != nil {
 		return err
 	}
@@ -395,7 +1117,7 @@ func (m *MIGManager) enableMIGMode() error {
 
 // 获取GPU显存大小
 func (m *MIGManager) getGPUMemory(gpuIndex string) (uint64, error) {
-	out, err := runNvidiaSmiCommand("-i", gpuIndex, "--query-gpu=memory.total", "--format=csv,noheader,nounits")
+	out, err := runNvidiaSmiCommand(context.Background(), "-i", gpuIndex, "--query-gpu=memory.total", "--format=csv,noheader,nounits")
 	if err != nil {
 		return 0, err
 	}
@@ -409,14 +1131,29 @@ func (m *MIGManager) getGPUMemory(gpuIndex string) (uint64, error) {
 	return memoryMB, nil
 }
 
-// 从profile中提取显存需求 (GB)
-func (m *MIGManager) getProfileMemoryReq() uint64 {
-	parts := strings.Split(m.profile, ".")
+// profileFor 返回GPU使用的profile，未单独配置时使用默认profile
+func (m *MIGManager) profileFor(gpuIndex string) string {
+	if profile, ok := m.gpuProfiles[gpuIndex]; ok {
+		return profile
+	}
+	return m.profile
+}
+
+// profileMemoryMB 从profile名称中解析实例显存(MB)，无法解析时返回0
+// 支持 3g.20gb、1c.3g.20gb（计算实例）、1g.10gb+me / 1g.24gb+gfx（附加能力）及带 "MIG " 前缀的写法，
+// 显存总是最后一段，计算实例共享所属GPU实例的显存
+func profileMemoryMB(profile string) uint64 {
+	name := strings.ToLower(strings.TrimSpace(profile))
+	name = strings.TrimPrefix(name, "mig ")
+	if i := strings.IndexAny(name, "+-"); i >= 0 {
+		name = name[:i]
+	}
+	parts := strings.Split(name, ".")
 	if len(parts) < 2 {
 		return 0
 	}
 
-	memPart := parts[1]
+	memPart := parts[len(parts)-1]
 	if strings.HasSuffix(memPart, "gb") {
 		memPart = strings.TrimSuffix(memPart, "gb")
 	} else if strings.HasSuffix(memPart, "g") {
@@ -425,175 +1162,251 @@ func (m *MIGManager) getProfileMemoryReq() uint64 {
 
 	memGB, err := strconv.ParseUint(memPart, 10, 64)
 	if err != nil {
-		klog.Warningf("Failed to parse memory requirement from profile %s: %v", m.profile, err)
+		klog.Warningf("Failed to parse memory requirement from profile %s: %v", profile, err)
 		return 0
 	}
 
 	return memGB * 1024 // 转换为MB
 }
 
+// MIGPlan 单块GPU的MIG切分计划
+type MIGPlan struct {
+	GPU        string
+	Profile    string
+	MIGEnabled bool   // 当前是否已开启MIG模式
+	Existing   int    // 现有实例数，重新切分时会被销毁
+	Create     int    // 将创建的实例数
+	Skip       bool   // 不处理该GPU
+	Reason     string // 跳过原因
+}
+
+// PlanMIG 返回 MIG 配置将对各GPU执行的操作，不做任何修改
+func (m *NVIDIAManager) PlanMIG() ([]MIGPlan, error) {
+	if m.migManager == nil {
+		return nil, fmt.Errorf("MIG manager is not initialized")
+	}
+	m.migManager.mu.Lock()
+	defer m.migManager.mu.Unlock()
+	return m.migManager.plan()
+}
+
+// plan 只读地查询各GPU状态并计算切分计划，调用方需持有锁
+func (m *MIGManager) plan() ([]MIGPlan, error) {
+	// 获取GPU列表
+	out, err := runNvidiaSmiCommand(context.Background(), "--query-gpu=index", "--format=csv,noheader")
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []MIGPlan
+	for _, index := range regexp.MustCompile(`\d+`).FindAllString(string(out), -1) {
+		plans = append(plans, m.planGPU(index))
+	}
+	return plans, nil
+}
+
+func (m *MIGManager) planGPU(index string) MIGPlan {
+	p := MIGPlan{GPU: index, Profile: m.profileFor(index)}
+	skip := func(format string, args ...interface{}) MIGPlan {
+		p.Skip = true
+		p.Reason = fmt.Sprintf(format, args...)
+		return p
+	}
+
+	// 获取GPU显存大小
+	totalMemory, err := m.getGPUMemory(index)
+	if err != nil {
+		return skip("failed to get GPU memory: %v", err)
+	}
+
+	// 识别架构，未配置默认profile时使用该架构的半卡profile
+	var arch *migArch
+	if name, err := m.getGPUName(index); err != nil {
+		klog.Warningf("Failed to query name of GPU %s, sizing MIG instances by memory: %v", index, err)
+	} else if arch = detectMIGArch(name); arch == nil {
+		klog.Infof("Unknown MIG architecture for GPU %s (%s), sizing MIG instances by memory", index, name)
+	}
+	if _, perGPU := m.gpuProfiles[index]; arch != nil && m.autoProfile && !perGPU {
+		if profile := arch.defaultProfile(totalMemory); profile != "" {
+			p.Profile = profile
+		}
+	}
+
+	// 检查是否已启用MIG
+	out, err := runNvidiaSmiCommand(context.Background(), "-i", index, "--query-gpu=mig.mode.current", "--format=csv,noheader")
+	if err != nil {
+		return skip("failed to check MIG status: %v", err)
+	}
+	p.MIGEnabled = strings.TrimSpace(string(out)) == "Enabled"
+
+	if p.MIGEnabled {
+		// 检查现有MIG设备
+		count, err := m.getMIGDeviceCount(index)
+		if err != nil {
+			return skip("failed to get MIG device count: %v", err)
+		}
+		p.Existing = count
+
+		// 如果已切分且配置跳过，则跳过创建
+		if count > 0 && m.skipConfigured {
+			return skip("already has %d MIG devices", count)
+		}
+		// 重新切分需销毁现有设备，仍有分配时会终止运行中的任务
+		if count > 0 && m.inUse != nil && m.inUse(index) {
+			if !m.forceReconfig {
+				return skip("has allocated MIG devices, set MIG_FORCE_RECONFIG=true to override")
+			}
+			klog.Warningf("GPU %s has allocated MIG devices, reconfiguring anyway because MIG_FORCE_RECONFIG=true", index)
+		}
+
+		// 未开启MIG模式时 -lgip 不列出该GPU，开启后再由创建步骤校验
+		if supported, err := m.profiles.Supported(context.Background(), index, p.Profile); err != nil {
+			return skip("failed to check profile %s: %v", p.Profile, err)
+		} else if !supported {
+			return skip("profile %s is not supported", p.Profile)
+		}
+	}
+
+	// 计算最大可创建实例数：已知架构查profile表，否则按显存估算
+	profileMem := profileMemoryMB(p.Profile)
+	maxInstances := 0
+	sized := false
+	if arch != nil {
+		if maxInstances, sized = arch.maxInstances(p.Profile, totalMemory); !sized {
+			klog.Warningf("Profile %s is not a known %s MIG profile, sizing by memory", p.Profile, arch.name)
+		}
+	}
+	if !sized && profileMem > 0 {
+		maxInstances = int(totalMemory / profileMem)
+	}
+	if (sized || profileMem > 0) && maxInstances == 0 {
+		return skip("insufficient memory (%dMB) for profile %s (%dMB required)", totalMemory, p.Profile, profileMem)
+	}
+
+	// 确定要创建的实例数量
+	p.Create = maxInstances
+	if m.instanceCount > 0 {
+		if m.instanceCount > maxInstances {
+			klog.Warningf("Requested %d instances exceeds maximum %d for GPU %s",
+				m.instanceCount, maxInstances, index)
+		} else {
+			p.Create = m.instanceCount
+		}
+	}
+	if p.Create == 0 {
+		return skip("cannot determine instance count")
+	}
+	return p
+}
+
 /*
 *
 https://docs.nvidia.com/datacenter/tesla/mig-user-guide/index.html
 */
 func (m *MIGManager) createMIGDevices() error {
-	// 获取GPU列表
-	out, err := runNvidiaSmiCommand("--query-gpu=index", "--format=csv,noheader")
+	plans, err := m.plan()
 	if err != nil {
 		return err
 	}
 
-	gpuIndexes := regexp.MustCompile(`\d+`).FindAllString(string(out), -1)
-	for _, index := range gpuIndexes {
-		// 检查是否已启用MIG
-		out, err := runNvidiaSmiCommand("-i", index, "--query-gpu=mig.mode.current", "--format=csv,noheader")
-		if err != nil {
-			klog.Errorf("Failed to check MIG status for GPU %s: %v", index, err)
+	for _, p := range plans {
+		index := p.GPU
+		if p.Skip {
+			klog.Warningf("Skipping MIG configuration of GPU %s: %s", index, p.Reason)
 			continue
 		}
 
-		currentMode := strings.TrimSpace(string(out))
-		if currentMode != "Enabled" {
+		if !p.MIGEnabled {
 			// 启用MIG模式
-			if _, err := runNvidiaSmiCommand("-i", index, "--enable-mig"); err != nil {
+			if _, err := runNvidiaSmiCommand(context.Background(), "-i", index, "--enable-mig"); err != nil {
 				klog.Errorf("Failed to enable MIG for GPU %s: %v", index, err)
 				continue
 			}
 			klog.Infof("Enabled MIG mode for GPU %s", index)
+			// 开启后 -lgip 才会列出该GPU的profile
+			m.profiles.invalidate()
+			if supported, err := m.profiles.Supported(context.Background(), index, p.Profile); err != nil || !supported {
+				klog.Errorf("Profile %s is not supported on GPU %s (err: %v), skipping", p.Profile, index, err)
+				continue
+			}
 		} else {
 			klog.Infof("GPU %s already in MIG mode", index)
 		}
 
-		// 检查现有MIG设备
-		count, err := m.getMIGDeviceCount(index)
-		if err != nil {
-			klog.Errorf("Failed to get MIG device count for GPU %s: %v", index, err)
-			continue
-		}
-
-		// 如果已切分且配置跳过，则跳过创建
-		if count > 0 && m.skipConfigured {
-			klog.Infof("Skipping GPU %s (already has %d MIG devices)", index, count)
-			continue
-		}
-
 		// 如果已有设备且不跳过，先销毁现有设备
-		if count > 0 {
+		if p.Existing > 0 {
 			klog.Infof("Destroying existing MIG devices on GPU %s", index)
-			if _, err := runNvidiaSmiCommand("mig", "-i", index, "-dci"); err != nil {
+			if _, err := runNvidiaSmiCommand(context.Background(), "mig", "-i", index, "-dci"); err != nil {
 				klog.Errorf("Failed to destroy compute instances on GPU %s: %v", index, err)
 			}
-			if _, err := runNvidiaSmiCommand("mig", "-i", index, "-dgi"); err != nil {
+			if _, err := runNvidiaSmiCommand(context.Background(), "mig", "-i", index, "-dgi"); err != nil {
 				klog.Errorf("Failed to destroy GPU instances on GPU %s: %v", index, err)
 			}
 			time.Sleep(2 * time.Second) // 等待资源释放
 		}
 
-		// 获取GPU显存大小
-		totalMemory, err := m.getGPUMemory(index)
-		if err != nil {
-			klog.Errorf("Failed to get GPU memory for %s: %v", index, err)
-			continue
-		}
-
-		// 计算最大可创建实例数
-		profileMem := m.getProfileMemoryReq()
-		maxInstances := 0
-
-		if profileMem > 0 {
-			maxInstances = int(totalMemory / profileMem)
-			if maxInstances == 0 {
-				klog.Warningf("GPU %s has insufficient memory (%dMB) for profile %s (%dMB required)",
-					index, totalMemory, m.profile, profileMem)
-				continue
-			}
-		}
+		klog.Infof("Creating %d MIG device(s) with profile %s on GPU %s", p.Create, p.Profile, index)
 
-		// 确定要创建的实例数量
-		createCount := maxInstances
-		if m.instanceCount > 0 {
-			if m.instanceCount > maxInstances {
-				klog.Warningf("Requested %d instances exceeds maximum %d for GPU %s",
-					m.instanceCount, maxInstances, index)
-				createCount = maxInstances
-			} else {
-				createCount = m.instanceCount
-			}
-		}
-
-		if createCount == 0 {
-			klog.Errorf("Cannot determine instance count for GPU %s", index)
-			continue
-		}
-
-		klog.Infof("Creating %d MIG device(s) with profile %s on GPU %s", createCount, m.profile, index)
-
-		profileID, err := getProfileID(m.profile)
+		profileID, err := m.profiles.ID(context.Background(), p.Profile)
 		if err != nil {
 			klog.Errorf("Failed to get profile ID: %v", err)
 			continue
 		}
 
-		// === 修复开始 ===
-		// 构造逗号分隔的ID列表 (e.g., "9,9" for 2 instances)
-		ids := make([]string, createCount)
-		for i := 0; i < createCount; i++ {
-			ids[i] = strconv.Itoa(profileID)
-		}
-		profileArg := strings.Join(ids, ",")
-
-		// 单次执行创建命令
-		_, err = runNvidiaSmiCommand("mig", "-cgi", profileArg, "-C")
-		if err != nil {
-			klog.Errorf("Failed to create %d MIG devices on GPU %s: %v", createCount, index, err)
+		if err := m.createInstances(index, profileID, p.Create); err != nil {
+			klog.Errorf("Failed to create MIG devices on GPU %s: %v", index, err)
 		} else {
-			klog.Infof("Successfully created %d MIG devices on GPU %s", createCount, index)
+			klog.Infof("Successfully created %d MIG devices on GPU %s", p.Create, index)
 		}
-		// === 修复结束 ===
 	}
 
 	return nil
 }
 
-func getProfileID(profileName string) (int, error) {
-	out, err := runNvidiaSmiCommand("mig", "-lgip")
+// 两次创建尝试之间的等待时间
+var migCreateRetryDelay = 2 * time.Second
+
+// createInstances 创建want个实例并重新查询数量核对
+// 放置冲突时 -cgi 可能只创建了部分实例，此时仅补建缺少的部分，最多重试 createRetries 次
+func (m *MIGManager) createInstances(gpuIndex string, profileID int, want int) error {
+	base, err := m.getMIGDeviceCount(gpuIndex)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	// 正则表达式匹配profile行
-	re := regexp.MustCompile(`\|\s+\d+\s+MIG\s+(\S+)\s+(\d+)`)
-
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	for _, line := range lines {
-		klog.Infof("Found line %s", line)
-		// 跳过非profile行（表格线、标题等）
-		if !strings.Contains(line, "MIG") || !strings.Contains(line, "|") {
-			continue
+	missing := want
+	for attempt := 0; attempt <= m.createRetries && missing > 0; attempt++ {
+		if attempt > 0 {
+			klog.Warningf("GPU %s is short of %d MIG devices, retrying (%d/%d)", gpuIndex, missing, attempt, m.createRetries)
+			time.Sleep(migCreateRetryDelay)
 		}
 
-		matches := re.FindStringSubmatch(line)
-		if len(matches) > 2 {
-			name := matches[1]
-			idStr := matches[2]
+		// 构造逗号分隔的ID列表 (e.g., "9,9" for 2 instances)
+		ids := make([]string, missing)
+		for i := range ids {
+			ids[i] = strconv.Itoa(profileID)
+		}
+		if _, err := runNvidiaSmiCommand(context.Background(), "mig", "-i", gpuIndex, "-cgi", strings.Join(ids, ","), "-C"); err != nil {
+			klog.Warningf("Creating %d MIG devices on GPU %s failed: %v", missing, gpuIndex, err)
+		}
 
-			if name == profileName {
-				profileID, err := strconv.Atoi(idStr)
-				if err != nil {
-					klog.Warningf("Invalid profile ID format: %s", idStr)
-					continue
-				}
-				klog.Infof("Found profile %s with ID %d", profileName, profileID)
-				return profileID, nil
-			}
+		count, err := m.getMIGDeviceCount(gpuIndex)
+		if err != nil {
+			klog.Warningf("Failed to verify MIG devices on GPU %s: %v", gpuIndex, err)
+			continue
 		}
+		missing = want - (count - base)
+	}
+
+	if missing > 0 {
+		return fmt.Errorf("only %d of %d MIG devices created on GPU %s after %d retries", want-missing, want, gpuIndex, m.createRetries)
 	}
-	return 0, fmt.Errorf("profile not found: %s", profileName)
+	return nil
 }
 
 // 获取当前MIG设备数量
 func (m *MIGManager) getMIGDeviceCount(gpuIndex string) (int, error) {
-	out, err := runNvidiaSmiCommand("mig", "-lgi", "-i", gpuIndex)
+	out, err := runNvidiaSmiCommand(context.Background(), "mig", "-lgi", "-i", gpuIndex)
 	output := string(out)
 
 	// 处理无 MIG 设备的情况
@@ -615,23 +1428,20 @@ func (m *MIGManager) getMIGDeviceCount(gpuIndex string) (int, error) {
 		return 0, fmt.Errorf("nvidia-smi MIG query failed: %v, output: %s", err, output)
 	}
 
-	// 解析输出中的设备计数
-	count := 0
-	lines := strings.Split(output, "\n")
-
-	// 检测表头行
-	headerFound := false
-	for _, line := range lines {
-		if strings.Contains(line, "GPU Instance ID") {
-			headerFound = true
-			continue
-		}
+	return parseGPUInstanceCount(output), nil
+}
 
-		// 统计数据行
-		if headerFound && strings.TrimSpace(line) != "" {
+// parseGPUInstanceCount 统计 -lgi 输出中的实例行，实例行示例:
+//
+//	|   0  MIG 3g.20gb          9        1          4:4     |
+//
+// 表头在不同驱动版本中跨行排列，只按实例行计数，边框和表头均不计入
+func parseGPUInstanceCount(output string) int {
+	count := 0
+	for _, line := range strings.Split(output, "\n") {
+		if profileLineRe.MatchString(line) {
 			count++
 		}
 	}
-
-	return count, nil
+	return count
 }
@@ -0,0 +1,279 @@
+package device
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// nvidiaGPU 后端返回的物理GPU信息
+type nvidiaGPU struct {
+	index      string
+	uuid       string
+	memoryMB   uint64
+	migEnabled bool // 当前MIG模式是否启用
+	pciBusID   string
+	name       string // 型号名称，如 NVIDIA A100-SXM4-40GB
+	err        error  // 查询该GPU失败时非空，此时只有 index 有效
+}
+
+// migDeviceInfo 后端返回的MIG设备信息
+type migDeviceInfo struct {
+	uuid    string
+	profile string // 无法解析时为空
+}
+
+// nvidiaBackend 查询NVIDIA GPU状态的后端，默认通过 nvidia-smi 实现
+type nvidiaBackend interface {
+	Name() string
+	ListGPUs(ctx context.Context) ([]nvidiaGPU, error)
+	ListMIG(ctx context.Context, gpuIndex string) ([]migDeviceInfo, error)
+	// Utilization 返回GPU利用率(%)，id 可以是索引或UUID
+	Utilization(ctx context.Context, id string) (uint, error)
+	// UncorrectedECCErrors 返回累计不可纠正ECC错误数，GPU不支持ECC时 supported 为false
+	UncorrectedECCErrors(ctx context.Context, id string) (count uint64, supported bool, err error)
+	// Temperature 返回GPU核心温度(°C)
+	Temperature(ctx context.Context, id string) (uint, error)
+	// DegradationStatus 返回NVLink、可纠正ECC与温控降频状态，查询失败时仍返回已取得的部分
+	DegradationStatus(ctx context.Context, id string) (nvidiaDegradation, error)
+}
+
+// nvidiaDegradation 物理GPU的降级维度原始数据
+type nvidiaDegradation struct {
+	activeLinks     int    // 活跃NVLink数，-1表示未知
+	correctedECC    uint64 // 易失性可纠正ECC错误数，不支持ECC时为0
+	thermalSlowdown bool   // 是否处于硬件或软件温控降频
+}
+
+// healthEventSource 可选接口：能够推送健康事件的后端
+// notify 的参数为物理GPU索引，阻塞直到ctx结束
+type healthEventSource interface {
+	WatchEvents(ctx context.Context, notify func(gpuIndex string)) error
+}
+
+// newNVIDIABackend 按 NVIDIA_BACKEND 选择后端（smi|nvml），默认 smi
+// NVML 初始化失败时回退到 smi
+func newNVIDIABackend() nvidiaBackend {
+	switch backend := os.Getenv("NVIDIA_BACKEND"); backend {
+	case "", "smi":
+		return smiBackend{}
+	case "nvml":
+		nvml, err := newNVMLBackend()
+		if err != nil {
+			klog.Errorf("Failed to initialize NVML backend, falling back to nvidia-smi: %v", err)
+			return smiBackend{}
+		}
+		return nvml
+	default:
+		klog.Warningf("Unknown NVIDIA_BACKEND %q, using nvidia-smi", backend)
+		return smiBackend{}
+	}
+}
+
+// smiBackend 通过解析 nvidia-smi 输出实现
+type smiBackend struct{}
+
+func (smiBackend) Name() string { return "smi" }
+
+func (smiBackend) ListGPUs(ctx context.Context) ([]nvidiaGPU, error) {
+	out, err := runNvidiaSmiCommand(ctx, "--query-gpu=index,uuid,memory.total,mig.mode.current,pci.bus_id,name", "--format=csv,noheader")
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := parseSmiCSV(out)
+	if err != nil {
+		return nil, err
+	}
+
+	var gpus []nvidiaGPU
+	for _, fields := range records {
+		if len(fields) < 5 {
+			klog.Warningf("Skipping malformed nvidia-smi record: %q", fields)
+			continue
+		}
+		// 出错的GPU各字段显示为 "[Unknown Error]"、"[GPU requires reset]" 等，交由调用方跳过该GPU
+		if uuid := strings.TrimSpace(fields[1]); uuid == "" || strings.HasPrefix(uuid, "[") {
+			gpus = append(gpus, nvidiaGPU{
+				index: strings.TrimSpace(fields[0]),
+				err:   fmt.Errorf("failed to query UUID: %s", uuid),
+			})
+			continue
+		}
+
+		gpu := nvidiaGPU{
+			index:      strings.TrimSpace(fields[0]),
+			uuid:       strings.TrimSpace(fields[1]),
+			memoryMB:   parseMemoryMB(fields[2]),
+			migEnabled: strings.TrimSpace(fields[3]) == "Enabled",
+			pciBusID:   strings.TrimSpace(fields[4]),
+		}
+		if len(fields) > 5 {
+			gpu.name = strings.TrimSpace(fields[5])
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+// parseSmiCSV 解析 --format=csv,noheader 输出
+// 带引号的字段（如含逗号的产品名）保持完整，字段前后的空白被去除
+func parseSmiCSV(out []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(out))
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse nvidia-smi csv output: %v", err)
+	}
+	for _, record := range records {
+		for i := range record {
+			record[i] = strings.TrimSpace(record[i])
+		}
+	}
+	return records, nil
+}
+
+func (b smiBackend) ListMIG(ctx context.Context, gpuIndex string) ([]migDeviceInfo, error) {
+	// 查询GPU实例（GPU Instances）
+	out, err := runNvidiaSmiCommand(ctx, "mig", "-lgi", "-i", gpuIndex)
+	output := strings.TrimSpace(string(out))
+
+	// 处理无GPU实例的情况
+	if strings.Contains(output, "No GPU instances found") {
+		klog.Infof("No MIG GPU instances found on GPU %s", gpuIndex)
+		return nil, nil
+	}
+
+	if err != nil {
+		klog.Errorf("Failed to query GPU instances for GPU %s: %v", gpuIndex, err)
+		return nil, err
+	}
+
+	return b.getMIGDeviceUUIDs(ctx, gpuIndex)
+}
+
+// MIG设备行示例: "  MIG 3g.20gb     Device  0: (UUID: MIG-4f0c...)"
+var migListProfileRe = regexp.MustCompile(`^\s*MIG\s+(\S+)\s+Device`)
+
+// 获取指定GPU上的MIG设备UUID及profile
+func (smiBackend) getMIGDeviceUUIDs(ctx context.Context, gpuIndex string) ([]migDeviceInfo, error) {
+	// 使用nvidia-smi -L命令获取所有GPU信息
+	out, err := runNvidiaSmiCommand(ctx, "-L")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MIG UUIDs: %v", err)
+	}
+
+	output := strings.TrimSpace(string(out))
+	lines := strings.Split(output, "\n")
+
+	var infos []migDeviceInfo
+	currentGPU := ""
+
+	for _, line := range lines {
+		// 匹配GPU行
+		if strings.HasPrefix(line, "GPU ") {
+			currentGPU = ""
+			if strings.HasPrefix(line, "GPU "+gpuIndex+":") {
+				currentGPU = gpuIndex
+			}
+			continue
+		}
+
+		// 匹配MIG设备行
+		if currentGPU == gpuIndex && strings.Contains(line, "MIG") && strings.Contains(line, "UUID") {
+			parts := strings.Split(line, "UUID:")
+			if len(parts) >= 2 {
+				uuid := strings.TrimSpace(parts[1])
+				// 移除末尾的括号
+				uuid = strings.TrimSuffix(uuid, ")")
+				info := migDeviceInfo{uuid: uuid}
+				if matches := migListProfileRe.FindStringSubmatch(line); len(matches) > 1 {
+					info.profile = matches[1]
+				}
+				infos = append(infos, info)
+			}
+		}
+	}
+
+	klog.Infof("Found %d MIG devices for GPU %s: %v", len(infos), gpuIndex, infos)
+	return infos, nil
+}
+
+func (smiBackend) Utilization(ctx context.Context, id string) (uint, error) {
+	out, err := runNvidiaSmiCommand(ctx, "-i", id, "--query-gpu=utilization.gpu", "--format=csv,noheader,nounits")
+	if err != nil {
+		return 0, err
+	}
+	output := strings.TrimSpace(string(out))
+	if output == "" {
+		return 0, fmt.Errorf("empty utilization output for GPU %s", id)
+	}
+	// MIG模式下利用率为 [N/A]，能返回数据即说明GPU可响应
+	utilization, err := strconv.ParseUint(output, 10, 32)
+	if err != nil {
+		klog.V(4).Infof("Utilization of GPU %s is not numeric: %s", id, output)
+		return 0, nil
+	}
+	return uint(utilization), nil
+}
+
+func (smiBackend) UncorrectedECCErrors(ctx context.Context, id string) (uint64, bool, error) {
+	out, err := runNvidiaSmiCommand(ctx, "-i", id, "--query-gpu=ecc.errors.uncorrected.aggregate.total", "--format=csv,noheader,nounits")
+	if err != nil {
+		return 0, false, err
+	}
+	output := strings.TrimSpace(string(out))
+	// 不支持ECC的GPU返回 [N/A]
+	count, err := strconv.ParseUint(output, 10, 64)
+	if err != nil {
+		return 0, false, nil
+	}
+	return count, true, nil
+}
+
+func (smiBackend) Temperature(ctx context.Context, id string) (uint, error) {
+	out, err := runNvidiaSmiCommand(ctx, "-i", id, "--query-gpu=temperature.gpu", "--format=csv,noheader,nounits")
+	if err != nil {
+		return 0, err
+	}
+	temperature, err := strconv.ParseUint(strings.TrimSpace(string(out)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse temperature %q: %v", strings.TrimSpace(string(out)), err)
+	}
+	return uint(temperature), nil
+}
+
+func (smiBackend) DegradationStatus(ctx context.Context, id string) (nvidiaDegradation, error) {
+	status := nvidiaDegradation{activeLinks: -1}
+	if out, err := runNvidiaSmiCommand(ctx, "nvlink", "-s", "-i", id); err == nil {
+		status.activeLinks = countActiveNVLinks(string(out))
+	} else {
+		klog.V(4).Infof("Failed to query NVLink status for GPU %s: %v", id, err)
+	}
+
+	out, err := runNvidiaSmiCommand(ctx, "-i", id,
+		"--query-gpu=ecc.errors.corrected.volatile.total,clocks_throttle_reasons.hw_thermal_slowdown,clocks_throttle_reasons.sw_thermal_slowdown",
+		"--format=csv,noheader,nounits")
+	if err != nil {
+		return status, err
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), ",")
+	if len(fields) < 3 {
+		return status, fmt.Errorf("unexpected degradation status output %q", strings.TrimSpace(string(out)))
+	}
+	// 不支持ECC的GPU返回[N/A]，解析失败时忽略
+	if corrected, err := strconv.ParseUint(strings.TrimSpace(fields[0]), 10, 64); err == nil {
+		status.correctedECC = corrected
+	}
+	status.thermalSlowdown = strings.TrimSpace(fields[1]) == "Active" || strings.TrimSpace(fields[2]) == "Active"
+	return status, nil
+}
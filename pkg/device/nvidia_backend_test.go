@@ -0,0 +1,315 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// fakeSmiOutput 安装按参数输出固定内容的 nvidia-smi，script 为 case 语句的分支
+func fakeSmiOutput(t *testing.T, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nvidia-smi")
+	content := "#!/bin/sh\ncase \"$*\" in\n" + script + "\n*) echo \"unexpected arguments: $*\" >&2; exit 1 ;;\nesac\n"
+	if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NVIDIA_SMI_PATH", path)
+}
+
+func TestParseSmiCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   [][]string
+	}{
+		{"trims fields", "0, GPU-a , 40960 MiB\n1,GPU-b,81920 MiB\n", [][]string{
+			{"0", "GPU-a", "40960 MiB"}, {"1", "GPU-b", "81920 MiB"},
+		}},
+		{"quoted name with comma", `0, GPU-a, "NVIDIA H100, PCIe"`, [][]string{{"0", "GPU-a", "NVIDIA H100, PCIe"}}},
+		{"stray quote kept", `0, GPU-a, Tesla 5" rev`, [][]string{{"0", "GPU-a", `Tesla 5" rev`}}},
+		{"ragged records", "0, GPU-a\n1\n", [][]string{{"0", "GPU-a"}, {"1"}}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSmiCSV([]byte(tt.output))
+			if err != nil {
+				t.Fatalf("parseSmiCSV() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseSmiCSV() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSmiBackendListGPUs(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    []nvidiaGPU
+		wantErr []bool // 各GPU是否带查询错误
+	}{
+		{"healthy and failed GPUs", `0, GPU-aaa, 40960 MiB, Enabled, 00000000:3B:00.0, NVIDIA A100-SXM4-40GB
+1, [Unknown Error], [Unknown Error], [Unknown Error], 00000000:3C:00.0, [Unknown Error]
+2, GPU-ccc, 81920 MiB, Disabled, 00000000:AF:00.0, "NVIDIA H100, PCIe"
+bogus`, []nvidiaGPU{
+			{index: "0", uuid: "GPU-aaa", memoryMB: 40960, migEnabled: true, pciBusID: "00000000:3B:00.0", name: "NVIDIA A100-SXM4-40GB"},
+			{index: "1"},
+			{index: "2", uuid: "GPU-ccc", memoryMB: 81920, pciBusID: "00000000:AF:00.0", name: "NVIDIA H100, PCIe"},
+		}, []bool{false, true, false}},
+		{"without name column", "0, GPU-aaa, N/A, [N/A], 00000000:3B:00.0", []nvidiaGPU{
+			{index: "0", uuid: "GPU-aaa", pciBusID: "00000000:3B:00.0"},
+		}, []bool{false}},
+		{"empty", "", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSmiOutput(t, "*--query-gpu=*) cat <<'OUT'\n"+tt.output+"\nOUT\n;;")
+			got, err := smiBackend{}.ListGPUs(context.Background())
+			if err != nil {
+				t.Fatalf("ListGPUs() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ListGPUs() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if (got[i].err != nil) != tt.wantErr[i] {
+					t.Fatalf("GPU %d error = %v, wantErr %v", i, got[i].err, tt.wantErr[i])
+				}
+				got[i].err = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ListGPUs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+const smiListFixture = `GPU 0: NVIDIA A100-SXM4-40GB (UUID: GPU-aaa)
+  MIG 3g.20gb     Device  0: (UUID: MIG-111)
+  MIG 1g.5gb      Device  1: (UUID: MIG-222)
+GPU 1: NVIDIA A100-SXM4-40GB (UUID: GPU-bbb)
+  MIG 7g.40gb     Device  0: (UUID: MIG-333)
+GPU 10: NVIDIA A100-SXM4-40GB (UUID: GPU-ccc)
+  MIG 7g.40gb     Device  0: (UUID: MIG-444)`
+
+func TestSmiBackendListMIG(t *testing.T) {
+	tests := []struct {
+		name    string
+		gpu     string
+		lgi     string
+		list    string
+		want    []migDeviceInfo
+		wantErr bool
+	}{
+		{"slices of the requested GPU", "1", "echo '" + lgiFixture + "'", "echo '" + smiListFixture + "'",
+			[]migDeviceInfo{{uuid: "MIG-333", profile: "7g.40gb"}}, false},
+		{"several slices", "0", "echo '" + lgiFixture + "'", "echo '" + smiListFixture + "'",
+			[]migDeviceInfo{{uuid: "MIG-111", profile: "3g.20gb"}, {uuid: "MIG-222", profile: "1g.5gb"}}, false},
+		{"no instances", "0", "echo 'No GPU instances found'; exit 6", "exit 1", nil, false},
+		{"listing fails", "0", "echo '" + lgiFixture + "'", "exit 1", nil, true},
+		{"empty listing", "0", "echo '" + lgiFixture + "'", "true", nil, false},
+		{"malformed device line", "0", "echo '" + lgiFixture + "'", "echo 'GPU 0: A100 (UUID: GPU-aaa)\n  MIG Device (UUID: MIG-555)'",
+			[]migDeviceInfo{{uuid: "MIG-555"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSmiOutput(t, "\"mig -lgi -i \"*) "+tt.lgi+" ;;\n-L) "+tt.list+" ;;")
+			got, err := smiBackend{}.ListMIG(context.Background(), tt.gpu)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListMIG() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ListMIG() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 同时运行的 nvidia-smi 进程数不超过全局上限
+func TestNvidiaSmiConcurrencyLimit(t *testing.T) {
+	orig := smiSemaphore
+	smiSemaphore = semaphore.NewWeighted(2)
+	t.Cleanup(func() { smiSemaphore = orig })
+
+	state := t.TempDir()
+	t.Setenv("FAKE_SMI_STATE", state)
+	// 每个进程启动时记录正在运行的进程数
+	fakeSmiOutput(t, `*) mkdir "$FAKE_SMI_STATE/running.$$"
+	ls -d "$FAKE_SMI_STATE"/running.* | wc -l >> "$FAKE_SMI_STATE/seen"
+	sleep 0.2
+	rmdir "$FAKE_SMI_STATE/running.$$" ;;`)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := runNvidiaSmiCommand(context.Background(), "-L"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	raw, err := os.ReadFile(filepath.Join(state, "seen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := strings.Fields(string(raw))
+	if len(seen) != 6 {
+		t.Fatalf("recorded %d runs, want 6", len(seen))
+	}
+	for _, n := range seen {
+		if count, _ := strconv.Atoi(n); count > 2 {
+			t.Fatalf("%d nvidia-smi processes ran concurrently, limit is 2", count)
+		}
+	}
+}
+
+func TestGetSmiMaxConcurrent(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"", defaultSmiMaxConcurrent},
+		{"8", 8},
+		{"0", defaultSmiMaxConcurrent},
+		{"-1", defaultSmiMaxConcurrent},
+		{"many", defaultSmiMaxConcurrent},
+	}
+	for _, tt := range tests {
+		t.Setenv("NVIDIA_SMI_MAX_CONCURRENT", tt.value)
+		if got := getSmiMaxConcurrent(); got != tt.want {
+			t.Errorf("getSmiMaxConcurrent() with %q = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+// 本机没有 NVML 时选择 nvml 也回退到 nvidia-smi
+func TestNewNVIDIABackend(t *testing.T) {
+	for _, backend := range []string{"", "smi", "nvml", "dcgm"} {
+		t.Run(backend, func(t *testing.T) {
+			t.Setenv("NVIDIA_BACKEND", backend)
+			if got := newNVIDIABackend().Name(); got != "smi" {
+				t.Fatalf("newNVIDIABackend() = %q, want smi", got)
+			}
+		})
+	}
+}
+
+// 不可纠正ECC错误达到阈值时判定不健康，不支持或查询失败时不影响健康
+func TestCheckECC(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		threshold uint64
+		want      bool
+	}{
+		{"no errors", "echo 0", 1, true},
+		{"below threshold", "echo 2", 3, true},
+		{"reaches threshold", "echo 3", 3, false},
+		{"not supported", "echo '[N/A]'", 1, true},
+		{"query fails", "exit 1", 1, true},
+		{"check disabled", "echo 100", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSmiOutput(t, "\"-i 0 --query-gpu=ecc.errors.uncorrected.aggregate.total --format=csv,noheader,nounits\") "+tt.output+" ;;")
+			m := newTestNVIDIAManager(smiBackend{}, 1)
+			m.eccThreshold.Store(tt.threshold)
+			if got := m.checkECC(context.Background(), "0"); got != tt.want {
+				t.Fatalf("checkECC() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 温度超过阈值时判定不健康，恰好等于阈值仍视为健康
+func TestCheckTemperature(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		threshold uint64
+		want      bool
+	}{
+		{"below threshold", "echo 85", 90, true},
+		{"at threshold", "echo 90", 90, true},
+		{"above threshold", "echo 91", 90, false},
+		{"not numeric", "echo '[N/A]'", 90, true},
+		{"query fails", "exit 1", 90, true},
+		{"check disabled", "echo 120", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSmiOutput(t, "\"-i 0 --query-gpu=temperature.gpu --format=csv,noheader,nounits\") "+tt.output+" ;;")
+			m := newTestNVIDIAManager(smiBackend{}, 1)
+			m.tempThreshold.Store(tt.threshold)
+			if got := m.checkTemperature(context.Background(), "0"); got != tt.want {
+				t.Fatalf("checkTemperature() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// nvidia-smi 卡住或排队超时时返回 errNvidiaSmiTimeout，而不是无限阻塞
+func TestRunNvidiaSmiTimeout(t *testing.T) {
+	origTimeout, origSemaphore := smiTimeout, smiSemaphore
+	smiTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { smiTimeout, smiSemaphore = origTimeout, origSemaphore })
+	fakeSmiOutput(t, "-L) exec sleep 10 ;;")
+
+	tests := []struct {
+		name string
+		busy bool // 并发槽位已被占满
+	}{
+		{"hung process", false},
+		{"no free slot", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smiSemaphore = semaphore.NewWeighted(1)
+			if tt.busy {
+				smiSemaphore.Acquire(context.Background(), 1)
+			}
+			start := time.Now()
+			_, err := runNvidiaSmiCommand(context.Background(), "-L")
+			if !errors.Is(err, errNvidiaSmiTimeout) {
+				t.Fatalf("runNvidiaSmiCommand() error = %v, want %v", err, errNvidiaSmiTimeout)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("runNvidiaSmiCommand() returned after %v, want about %v", elapsed, smiTimeout)
+			}
+		})
+	}
+}
+
+func TestGetSmiTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultSmiTimeout},
+		{"5s", 5 * time.Second},
+		{"0", defaultSmiTimeout},
+		{"-1s", defaultSmiTimeout},
+		{"soon", defaultSmiTimeout},
+	}
+	for _, tt := range tests {
+		t.Setenv("NVIDIA_SMI_TIMEOUT", tt.value)
+		if got := getSmiTimeout(); got != tt.want {
+			t.Errorf("getSmiTimeout() with %q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package device
+
+import (
+	"context"
+	"math"
+	"strings"
+)
+
+// migArch 支持MIG的GPU架构及其profile表
+// profiles 为各profile在单块GPU上可创建的最大实例数，取自 NVIDIA MIG 用户指南，
+// 同一架构不同显存型号的profile名称基本不重叠，重名时（如A100 40GB/80GB的 1g.10gb）再按显存收紧
+type migArch struct {
+	name     string
+	models   []string // 匹配 nvidia-smi --query-gpu=name 的型号关键字
+	profiles map[string]int
+}
+
+var migArchs = []*migArch{
+	{
+		name:   "ampere",
+		models: []string{"A100", "A30"},
+		profiles: map[string]int{
+			// A100 40GB
+			"1g.5gb": 7, "1g.5gb+me": 1, "2g.10gb": 3, "3g.20gb": 2, "4g.20gb": 1, "7g.40gb": 1,
+			// A100 80GB，1g.10gb 在 40GB 型号上最多4个
+			"1g.10gb": 7, "1g.10gb+me": 1, "1g.20gb": 4, "2g.20gb": 3, "3g.40gb": 2, "4g.40gb": 1, "7g.80gb": 1,
+			// A30 24GB
+			"1g.6gb": 4, "1g.6gb+me": 1, "2g.12gb": 2, "2g.12gb+me": 1, "4g.24gb": 1,
+		},
+	},
+	{
+		name:   "hopper",
+		models: []string{"H100", "H200", "H800", "H20"},
+		profiles: map[string]int{
+			// H100/H800 80GB
+			"1g.10gb": 7, "1g.10gb+me": 1, "1g.20gb": 4, "2g.20gb": 3, "3g.40gb": 2, "4g.40gb": 1, "7g.80gb": 1,
+			// H100 NVL 94GB
+			"1g.12gb": 7, "1g.12gb+me": 1, "1g.24gb": 4, "2g.24gb": 3, "3g.47gb": 2, "4g.47gb": 1, "7g.94gb": 1,
+			// GH200 96GB
+			"3g.48gb": 2, "4g.48gb": 1, "7g.96gb": 1,
+			// H200 141GB
+			"1g.18gb": 7, "1g.18gb+me": 1, "1g.35gb": 4, "2g.35gb": 3, "3g.71gb": 2, "4g.71gb": 1, "7g.141gb": 1,
+		},
+	},
+}
+
+// detectMIGArch 按GPU型号名称识别架构，未知型号返回 nil
+func detectMIGArch(gpuName string) *migArch {
+	name := strings.ToUpper(gpuName)
+	for _, arch := range migArchs {
+		for _, model := range arch.models {
+			if strings.Contains(name, model) {
+				return arch
+			}
+		}
+	}
+	return nil
+}
+
+// maxInstances 返回profile在显存为 totalMemory(MB) 的GPU上最多可创建的实例数，profile不在表中时 ok 为false
+// profile名称中的显存是取整后的值（如H100的 3g.40gb 实际不足总显存一半），按四舍五入比较
+func (a *migArch) maxInstances(profile string, totalMemory uint64) (int, bool) {
+	n, ok := a.profiles[profile]
+	if !ok {
+		return 0, false
+	}
+	if profileMem := profileMemoryMB(profile); profileMem > 0 && totalMemory > 0 {
+		if fit := int(math.Round(float64(totalMemory) / float64(profileMem))); fit < n {
+			n = fit
+		}
+	}
+	return n, true
+}
+
+// defaultProfile 未配置默认profile时使用半卡profile（每卡2个实例），取显存最接近总显存一半的一项
+func (a *migArch) defaultProfile(totalMemory uint64) string {
+	best, bestDiff := "", math.MaxFloat64
+	for profile, n := range a.profiles {
+		if n != 2 {
+			continue
+		}
+		if diff := math.Abs(float64(profileMemoryMB(profile)) - float64(totalMemory)/2); diff < bestDiff {
+			best, bestDiff = profile, diff
+		}
+	}
+	return best
+}
+
+// getGPUName 查询GPU型号名称，如 "NVIDIA H100 80GB HBM3"
+func (m *MIGManager) getGPUName(gpuIndex string) (string, error) {
+	out, err := runNvidiaSmiCommand(context.Background(), "-i", gpuIndex, "--query-gpu=name", "--format=csv,noheader")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
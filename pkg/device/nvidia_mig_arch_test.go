@@ -0,0 +1,46 @@
+package device
+
+import "testing"
+
+// 按型号识别架构，查profile表得到实例数并按显存收紧，未配置profile时选择半卡profile
+func TestMIGArch(t *testing.T) {
+	tests := []struct {
+		gpuName      string
+		memory       uint64 // MB
+		profile      string
+		wantArch     string
+		wantMax      int
+		wantKnown    bool
+		wantFallback string
+	}{
+		{"NVIDIA A100-SXM4-40GB", 40960, "1g.5gb", "ampere", 7, true, "3g.20gb"},
+		{"NVIDIA A100-SXM4-40GB", 40960, "1g.10gb", "ampere", 4, true, "3g.20gb"},
+		{"NVIDIA A100-SXM4-80GB", 81920, "1g.10gb", "ampere", 7, true, "3g.40gb"},
+		{"NVIDIA A30", 24576, "2g.12gb", "ampere", 2, true, "2g.12gb"},
+		{"NVIDIA H100 80GB HBM3", 81559, "3g.40gb", "hopper", 2, true, "3g.40gb"},
+		{"NVIDIA H100 NVL", 95830, "1g.12gb", "hopper", 7, true, "3g.47gb"},
+		{"NVIDIA H200", 143771, "7g.141gb", "hopper", 1, true, "3g.71gb"},
+		{"NVIDIA H100 80GB HBM3", 81559, "3g.20gb", "hopper", 0, false, "3g.40gb"},
+		{"Tesla V100-SXM2-16GB", 16384, "1g.5gb", "", 0, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.gpuName+"/"+tt.profile, func(t *testing.T) {
+			arch := detectMIGArch(tt.gpuName)
+			if arch == nil {
+				if tt.wantArch != "" {
+					t.Fatalf("detectMIGArch(%q) = nil, want %s", tt.gpuName, tt.wantArch)
+				}
+				return
+			}
+			if arch.name != tt.wantArch {
+				t.Fatalf("detectMIGArch(%q) = %s, want %s", tt.gpuName, arch.name, tt.wantArch)
+			}
+			if n, ok := arch.maxInstances(tt.profile, tt.memory); n != tt.wantMax || ok != tt.wantKnown {
+				t.Fatalf("maxInstances(%s, %d) = %d, %v, want %d, %v", tt.profile, tt.memory, n, ok, tt.wantMax, tt.wantKnown)
+			}
+			if got := arch.defaultProfile(tt.memory); got != tt.wantFallback {
+				t.Fatalf("defaultProfile(%d) = %q, want %q", tt.memory, got, tt.wantFallback)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSmiScript 模拟一块已开启MIG的 A100 40GB，实例数保存在状态目录中
+// 每次 -cgi 最多创建 per-create 个实例，模拟放置冲突时只创建了部分实例
+const fakeSmiScript = `#!/bin/sh
+state="$FAKE_SMI_STATE"
+count=$(cat "$state/count")
+case "$*" in
+*--query-gpu=index*) echo 0 ;;
+*memory.total*) echo 40960 ;;
+*--query-gpu=name*) echo "NVIDIA A100-SXM4-40GB" ;;
+*mig.mode.current*) echo Enabled ;;
+"mig -lgip") echo "|   0  MIG 3g.20gb          9     2/2        19.50      No     42     2     0   |" ;;
+*-cgi*) echo $((count + $(cat "$state/per-create"))) > "$state/count" ;;
+"mig -lgi"*)
+	if [ "$count" -eq 0 ]; then
+		echo "No GPU instances found"
+		exit 6
+	fi
+	echo "| GPU   Name             Profile  GPU Instance ID  Placement |"
+	i=0
+	while [ "$i" -lt "$count" ]; do
+		echo "|   0  MIG 3g.20gb          9        $i          0:4     |"
+		i=$((i + 1))
+	done
+	;;
+*) echo "unexpected arguments: $*" >&2; exit 1 ;;
+esac
+`
+
+// fakeNvidiaSmi 安装模拟的 nvidia-smi，GPU 0 上已有 count 个实例，返回读取当前实例数的函数
+func fakeNvidiaSmi(t *testing.T, count, perCreate int) func() int {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nvidia-smi")
+	if err := os.WriteFile(path, []byte(fakeSmiScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range map[string]int{"count": count, "per-create": perCreate} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strconv.Itoa(n)+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("NVIDIA_SMI_PATH", path)
+	t.Setenv("FAKE_SMI_STATE", dir)
+	return func() int {
+		raw, err := os.ReadFile(filepath.Join(dir, "count"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+}
+
+// 放置冲突时每次只创建部分实例，按 createRetries 补建缺少的部分
+func TestCreateInstancesRetry(t *testing.T) {
+	migCreateRetryDelay = 0
+	tests := []struct {
+		name      string
+		perCreate int
+		retries   int
+		want      int
+		wantErr   bool
+		wantCount int
+	}{
+		{"created at once", 2, 0, 2, false, 2},
+		{"partial then retried", 1, 2, 2, false, 2},
+		{"retries exhausted", 1, 0, 2, true, 1},
+		{"nothing created", 0, 2, 2, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := fakeNvidiaSmi(t, 0, tt.perCreate)
+			m := &MIGManager{createRetries: tt.retries}
+			err := m.createInstances("0", 9, tt.want)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("createInstances() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := count(); got != tt.wantCount {
+				t.Fatalf("instances after createInstances() = %d, want %d", got, tt.wantCount)
+			}
+		})
+	}
+}
+
+// 物理GPU上仍有分配时不重新切分，除非设置 MIG_FORCE_RECONFIG
+func TestPlanGPUInUseGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		inUse    bool
+		force    bool
+		wantSkip bool
+	}{
+		{"idle GPU", false, false, false},
+		{"GPU in use", true, false, true},
+		{"GPU in use with force", true, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeNvidiaSmi(t, 2, 0)
+			m := &MIGManager{
+				profile:       "3g.20gb",
+				forceReconfig: tt.force,
+				inUse:         func(string) bool { return tt.inUse },
+				profiles:      newProfileTable(),
+			}
+			p := m.planGPU("0")
+			if p.Skip != tt.wantSkip {
+				t.Fatalf("planGPU() Skip = %v (%s), want %v", p.Skip, p.Reason, tt.wantSkip)
+			}
+			if p.Existing != 2 {
+				t.Fatalf("planGPU() Existing = %d, want 2", p.Existing)
+			}
+			if !p.Skip && p.Create != 2 {
+				t.Fatalf("planGPU() Create = %d, want 2", p.Create)
+			}
+		})
+	}
+}
+
+// 未设置 MIG_CREATE 时 Configure 只输出计划，不修改GPU
+func TestConfigureCreate(t *testing.T) {
+	tests := []struct {
+		name   string
+		create bool
+		want   int
+	}{
+		{"plan only", false, 0},
+		{"MIG_CREATE=true", true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := fakeNvidiaSmi(t, 0, 2)
+			m := &MIGManager{enabled: true, create: tt.create, profile: "3g.20gb", profiles: newProfileTable()}
+			m.Configure()
+			if got := count(); got != tt.want {
+				t.Fatalf("Configure() left %d instances, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+//go:build nvml
+
+package device
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/NVIDIA/go-nvml/pkg/nvml"
+	"k8s.io/klog/v2"
+)
+
+// nvmlBackend 通过 NVML Go 绑定查询GPU，需要 cgo 与宿主机的 libnvidia-ml.so
+type nvmlBackend struct {
+	mu sync.Mutex
+}
+
+var (
+	nvmlInitOnce sync.Once
+	nvmlInitErr  error
+)
+
+func newNVMLBackend() (nvidiaBackend, error) {
+	nvmlInitOnce.Do(func() {
+		if ret := nvml.Init(); ret != nvml.SUCCESS {
+			nvmlInitErr = fmt.Errorf("failed to initialize NVML: %v", nvml.ErrorString(ret))
+		}
+	})
+	if nvmlInitErr != nil {
+		return nil, nvmlInitErr
+	}
+	klog.Info("Using NVML backend for NVIDIA devices")
+	return &nvmlBackend{}, nil
+}
+
+func (b *nvmlBackend) Name() string { return "nvml" }
+
+func (b *nvmlBackend) ListGPUs(_ context.Context) ([]nvidiaGPU, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get device count: %v", nvml.ErrorString(ret))
+	}
+
+	gpus := make([]nvidiaGPU, 0, count)
+	for i := 0; i < count; i++ {
+		dev, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			gpus = append(gpus, nvidiaGPU{index: strconv.Itoa(i),
+				err: fmt.Errorf("failed to get handle: %v", nvml.ErrorString(ret))})
+			continue
+		}
+		uuid, ret := dev.GetUUID()
+		if ret != nvml.SUCCESS {
+			gpus = append(gpus, nvidiaGPU{index: strconv.Itoa(i),
+				err: fmt.Errorf("failed to get UUID: %v", nvml.ErrorString(ret))})
+			continue
+		}
+
+		gpu := nvidiaGPU{index: strconv.Itoa(i), uuid: uuid}
+		if memory, ret := dev.GetMemoryInfo(); ret == nvml.SUCCESS {
+			gpu.memoryMB = memory.Total / 1024 / 1024
+		}
+		// 不支持MIG的GPU返回 NOT_SUPPORTED，视为未启用
+		if current, _, ret := dev.GetMigMode(); ret == nvml.SUCCESS {
+			gpu.migEnabled = current == nvml.DEVICE_MIG_ENABLE
+		}
+		if pciInfo, ret := dev.GetPciInfo(); ret == nvml.SUCCESS {
+			gpu.pciBusID = int8ArrayToString(pciInfo.BusId[:])
+		}
+		if name, ret := dev.GetName(); ret == nvml.SUCCESS {
+			gpu.name = name
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+func (b *nvmlBackend) ListMIG(_ context.Context, gpuIndex string) ([]migDeviceInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	index, err := strconv.Atoi(gpuIndex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GPU index %q: %v", gpuIndex, err)
+	}
+	parent, ret := nvml.DeviceGetHandleByIndex(index)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get handle for GPU %s: %v", gpuIndex, nvml.ErrorString(ret))
+	}
+	maxCount, ret := parent.GetMaxMigDeviceCount()
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get max MIG device count for GPU %s: %v", gpuIndex, nvml.ErrorString(ret))
+	}
+
+	var infos []migDeviceInfo
+	for i := 0; i < maxCount; i++ {
+		mig, ret := parent.GetMigDeviceHandleByIndex(i)
+		if ret == nvml.ERROR_NOT_FOUND || ret == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get MIG device %d on GPU %s: %v", i, gpuIndex, nvml.ErrorString(ret))
+		}
+		uuid, ret := mig.GetUUID()
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get MIG UUID on GPU %s: %v", gpuIndex, nvml.ErrorString(ret))
+		}
+
+		info := migDeviceInfo{uuid: uuid}
+		// MIG设备名称形如 "NVIDIA A100-SXM4-40GB MIG 3g.20gb"
+		if name, ret := mig.GetName(); ret == nvml.SUCCESS {
+			if idx := strings.LastIndex(name, "MIG "); idx >= 0 {
+				info.profile = strings.TrimSpace(name[idx+len("MIG "):])
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	klog.Infof("Found %d MIG devices for GPU %s via NVML: %v", len(infos), gpuIndex, infos)
+	return infos, nil
+}
+
+func (b *nvmlBackend) Utilization(_ context.Context, id string) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev, err := nvmlDeviceHandle(id)
+	if err != nil {
+		return 0, err
+	}
+	utilization, ret := dev.GetUtilizationRates()
+	// MIG模式下利用率不可用，能取得句柄即说明GPU可响应
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return 0, nil
+	}
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get utilization for GPU %s: %v", id, nvml.ErrorString(ret))
+	}
+	return uint(utilization.Gpu), nil
+}
+
+func (b *nvmlBackend) UncorrectedECCErrors(_ context.Context, id string) (uint64, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev, err := nvmlDeviceHandle(id)
+	if err != nil {
+		return 0, false, err
+	}
+	count, ret := dev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_UNCORRECTED, nvml.AGGREGATE_ECC)
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		return 0, false, nil
+	}
+	if ret != nvml.SUCCESS {
+		return 0, false, fmt.Errorf("failed to get ECC errors for GPU %s: %v", id, nvml.ErrorString(ret))
+	}
+	return count, true, nil
+}
+
+func (b *nvmlBackend) Temperature(_ context.Context, id string) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev, err := nvmlDeviceHandle(id)
+	if err != nil {
+		return 0, err
+	}
+	temperature, ret := dev.GetTemperature(nvml.TEMPERATURE_GPU)
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("failed to get temperature for GPU %s: %v", id, nvml.ErrorString(ret))
+	}
+	return uint(temperature), nil
+}
+
+// nvmlThermalSlowdown 硬件或软件温控降频
+const nvmlThermalSlowdown = nvml.ClocksThrottleReasonHwThermalSlowdown | nvml.ClocksThrottleReasonSwThermalSlowdown
+
+func (b *nvmlBackend) DegradationStatus(_ context.Context, id string) (nvidiaDegradation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := nvidiaDegradation{activeLinks: -1}
+	dev, err := nvmlDeviceHandle(id)
+	if err != nil {
+		return status, err
+	}
+	// 不支持NVLink的GPU各链路返回 NOT_SUPPORTED，活跃数为0
+	status.activeLinks = 0
+	for link := 0; link < nvml.NVLINK_MAX_LINKS; link++ {
+		if state, ret := dev.GetNvLinkState(link); ret == nvml.SUCCESS && state == nvml.FEATURE_ENABLED {
+			status.activeLinks++
+		}
+	}
+	if corrected, ret := dev.GetTotalEccErrors(nvml.MEMORY_ERROR_TYPE_CORRECTED, nvml.VOLATILE_ECC); ret == nvml.SUCCESS {
+		status.correctedECC = corrected
+	}
+	reasons, ret := dev.GetCurrentClocksThrottleReasons()
+	if ret != nvml.SUCCESS {
+		return status, fmt.Errorf("failed to get throttle reasons for GPU %s: %v", id, nvml.ErrorString(ret))
+	}
+	status.thermalSlowdown = reasons&nvmlThermalSlowdown != 0
+	return status, nil
+}
+
+// nvmlDeviceHandle 按UUID或索引获取设备句柄
+func nvmlDeviceHandle(id string) (nvml.Device, error) {
+	if strings.HasPrefix(id, "GPU-") || strings.HasPrefix(id, "MIG-") {
+		dev, ret := nvml.DeviceGetHandleByUUID(id)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("failed to get handle for GPU %s: %v", id, nvml.ErrorString(ret))
+		}
+		return dev, nil
+	}
+	index, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GPU id %q: %v", id, err)
+	}
+	dev, ret := nvml.DeviceGetHandleByIndex(index)
+	if ret != nvml.SUCCESS {
+		return nil, fmt.Errorf("failed to get handle for GPU %s: %v", id, nvml.ErrorString(ret))
+	}
+	return dev, nil
+}
+
+func int8ArrayToString(chars []int8) string {
+	var builder strings.Builder
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		builder.WriteByte(byte(c))
+	}
+	return builder.String()
+}
+
+// NVML 事件等待超时（毫秒），超时后检查ctx是否结束
+const nvmlEventWaitTimeoutMs = 5000
+
+// 触发健康复查的NVML事件类型
+const nvmlHealthEventTypes = nvml.EventTypeXidCriticalError | nvml.EventTypeDoubleBitEccError
+
+// WatchEvents 订阅XID与双比特ECC事件，收到事件后通知对应的物理GPU
+func (b *nvmlBackend) WatchEvents(ctx context.Context, notify func(gpuIndex string)) error {
+	set, ret := nvml.EventSetCreate()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to create event set: %v", nvml.ErrorString(ret))
+	}
+	defer set.Free()
+
+	if err := b.registerHealthEvents(set); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		data, ret := set.Wait(nvmlEventWaitTimeoutMs)
+		if ret == nvml.ERROR_TIMEOUT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			klog.Warningf("Failed to wait for NVML events: %v", nvml.ErrorString(ret))
+			continue
+		}
+		index, ret := data.Device.GetIndex()
+		if ret != nvml.SUCCESS {
+			klog.Warningf("Failed to get index of GPU for NVML event %d: %v", data.EventType, nvml.ErrorString(ret))
+			continue
+		}
+		klog.Warningf("NVML event %d (data %d) on GPU %d", data.EventType, data.EventData, index)
+		notify(strconv.Itoa(index))
+	}
+}
+
+// registerHealthEvents 为所有GPU注册健康事件，不支持事件的GPU跳过
+func (b *nvmlBackend) registerHealthEvents(set nvml.EventSet) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count, ret := nvml.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to get device count: %v", nvml.ErrorString(ret))
+	}
+	registered := 0
+	for i := 0; i < count; i++ {
+		dev, ret := nvml.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			klog.Errorf("Failed to get handle for GPU %d: %v", i, nvml.ErrorString(ret))
+			continue
+		}
+		if ret := dev.RegisterEvents(nvmlHealthEventTypes, set); ret != nvml.SUCCESS {
+			klog.Warningf("GPU %d does not support health events: %v", i, nvml.ErrorString(ret))
+			continue
+		}
+		registered++
+	}
+	if registered == 0 {
+		return fmt.Errorf("no GPU supports health events")
+	}
+	return nil
+}
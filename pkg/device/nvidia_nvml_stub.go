@@ -0,0 +1,10 @@
+//go:build !nvml
+
+package device
+
+import "errors"
+
+// newNVMLBackend 未使用 nvml 构建标签编译时不可用
+func newNVMLBackend() (nvidiaBackend, error) {
+	return nil, errors.New("built without NVML support, rebuild with -tags nvml")
+}
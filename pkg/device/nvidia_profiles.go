@@ -0,0 +1,172 @@
+package device
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+)
+
+// -lgip 表格中的profile行，如 "|   0  MIG 1g.10gb          19     7/7        9.50       No     14     0     0   |"
+// 依次捕获GPU序号、profile名称和ID；-lgi 的实例行格式相同
+var profileLineRe = regexp.MustCompile(`\|\s+(\d+)\s+MIG\s+(\S+)\s+(\d+)`)
+
+// profileTable 缓存 `nvidia-smi mig -lgip` 得到的 profile 名称与ID映射
+// 发现缓存失效时一并失效，避免每次查询都启动nvidia-smi
+type profileTable struct {
+	mu     sync.Mutex
+	loaded bool
+	ids    map[string]int             // profile名称到ID
+	names  map[int]string             // ID到profile名称
+	gpus   map[string]map[string]bool // GPU序号到其支持的profile
+}
+
+func newProfileTable() *profileTable {
+	return &profileTable{}
+}
+
+// load 未加载时执行一次 -lgip，调用方需持有锁
+func (t *profileTable) load(ctx context.Context) error {
+	if t.loaded {
+		return nil
+	}
+	out, err := runNvidiaSmiCommand(ctx, "mig", "-lgip")
+	if err != nil {
+		return err
+	}
+	t.ids, t.names, t.gpus = parseProfileTable(string(out))
+	t.loaded = true
+	klog.V(4).Infof("Loaded %d MIG profiles", len(t.ids))
+	return nil
+}
+
+// ID 返回profile名称对应的ID
+func (t *profileTable) ID(ctx context.Context, name string) (int, error) {
+	if t == nil {
+		t = newProfileTable()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(ctx); err != nil {
+		return 0, err
+	}
+	id, ok := t.ids[name]
+	if !ok {
+		return 0, fmt.Errorf("profile not found: %s", name)
+	}
+	return id, nil
+}
+
+// Name 返回profile ID对应的名称
+func (t *profileTable) Name(ctx context.Context, id int) (string, error) {
+	if t == nil {
+		t = newProfileTable()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(ctx); err != nil {
+		return "", err
+	}
+	name, ok := t.names[id]
+	if !ok {
+		return "unknown", fmt.Errorf("profile not found for ID %d", id)
+	}
+	return name, nil
+}
+
+// Supported 判断指定GPU是否支持该profile
+func (t *profileTable) Supported(ctx context.Context, gpuIndex string, name string) (bool, error) {
+	if t == nil {
+		t = newProfileTable()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.load(ctx); err != nil {
+		return false, err
+	}
+	return t.gpus[gpuIndex][name], nil
+}
+
+// invalidate 下次查询时重新执行 -lgip
+func (t *profileTable) invalidate() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loaded = false
+}
+
+// parseProfileTable 解析 -lgip 输出，多块GPU会重复列出相同的profile
+func parseProfileTable(output string) (map[string]int, map[int]string, map[string]map[string]bool) {
+	ids := make(map[string]int)
+	names := make(map[int]string)
+	gpus := make(map[string]map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		matches := profileLineRe.FindStringSubmatch(line)
+		if len(matches) < 4 {
+			continue
+		}
+		gpu, name := matches[1], matches[2]
+		id, err := strconv.Atoi(matches[3])
+		if err != nil {
+			klog.Warningf("Invalid profile ID format: %s", matches[3])
+			continue
+		}
+		ids[name] = id
+		names[id] = name
+		if gpus[gpu] == nil {
+			gpus[gpu] = make(map[string]bool)
+		}
+		gpus[gpu][name] = true
+	}
+	return ids, names, gpus
+}
+
+// 未配置 MIG_PROFILE 时的默认切分策略
+const defaultMIGProfile = "3g.20gb"
+
+// parseMIGProfiles 解析 MIG_PROFILE，支持按GPU序号配置，如 "0=1g.10gb,1=3g.20gb"
+// 不带序号的项作为其余GPU的默认profile，未指定时使用 3g.20gb
+func parseMIGProfiles(spec string) (string, map[string]string) {
+	def := ""
+	perGPU := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		index, profile, found := strings.Cut(entry, "=")
+		if !found {
+			if def != "" {
+				klog.Warningf("Multiple default MIG profiles in %q, using %s", spec, entry)
+			}
+			def = entry
+			continue
+		}
+		index, profile = strings.TrimSpace(index), strings.TrimSpace(profile)
+		if _, err := strconv.Atoi(index); err != nil || profile == "" {
+			klog.Warningf("Ignoring invalid MIG profile entry %q", entry)
+			continue
+		}
+		perGPU[index] = profile
+	}
+	if def == "" {
+		def = defaultMIGProfile
+	}
+	return def, perGPU
+}
+
+// hasDefaultMIGProfile MIG_PROFILE 中是否显式配置了默认profile，未配置时按GPU架构选择
+func hasDefaultMIGProfile(spec string) bool {
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" && !strings.Contains(entry, "=") {
+			return true
+		}
+	}
+	return false
+}
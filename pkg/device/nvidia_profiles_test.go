@@ -0,0 +1,172 @@
+package device
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+)
+
+const lgipFixture = `+-----------------------------------------------------------------------------+
+| GPU instance profiles:                                                      |
+| GPU   Name             ID    Instances   Memory     P2P    SM    DEC   ENC  |
+|                              Free/Total   GiB              CE    JPEG  OFA  |
+|=============================================================================|
+|   0  MIG 1g.5gb        19     7/7        4.75       No     14     0     0   |
+|                                                             1     0     0   |
++-----------------------------------------------------------------------------+
+|   0  MIG 3g.20gb        9     2/2        19.50      No     42     2     0   |
+|                                                             3     0     0   |
++-----------------------------------------------------------------------------+
+|   1  MIG 1g.5gb        19     7/7        4.75       No     14     0     0   |
+|                                                             1     0     0   |
++-----------------------------------------------------------------------------+
+`
+
+func TestParseProfileTable(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		wantIDs   map[string]int
+		wantNames map[int]string
+		wantGPUs  map[string]map[string]bool
+	}{
+		{"profiles per GPU", lgipFixture,
+			map[string]int{"1g.5gb": 19, "3g.20gb": 9},
+			map[int]string{19: "1g.5gb", 9: "3g.20gb"},
+			map[string]map[string]bool{"0": {"1g.5gb": true, "3g.20gb": true}, "1": {"1g.5gb": true}}},
+		{"empty", "", map[string]int{}, map[int]string{}, map[string]map[string]bool{}},
+		{"malformed", "No MIG-enabled devices found.\n|   0  MIG  |\n", map[string]int{}, map[int]string{}, map[string]map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, names, gpus := parseProfileTable(tt.output)
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(names, tt.wantNames) || !reflect.DeepEqual(gpus, tt.wantGPUs) {
+				t.Fatalf("parseProfileTable() = %v, %v, %v, want %v, %v, %v", ids, names, gpus, tt.wantIDs, tt.wantNames, tt.wantGPUs)
+			}
+		})
+	}
+}
+
+const lgiFixture = `+-------------------------------------------------------+
+| GPU instances:                                        |
+| GPU   Name             Profile  Instance   Placement  |
+|                          ID       ID       Start:Size |
+|=======================================================|
+|   0  MIG 3g.20gb          9        1          4:4     |
++-------------------------------------------------------+
+|   0  MIG 3g.20gb          9        2          0:4     |
++-------------------------------------------------------+
+`
+
+func TestParseGPUInstanceCount(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   int
+	}{
+		{"instances", lgiFixture, 2},
+		{"empty", "", 0},
+		{"malformed", "| GPU instances: |\n|=====|\nunexpected output\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseGPUInstanceCount(tt.output); got != tt.want {
+				t.Fatalf("parseGPUInstanceCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileMemoryMB(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    uint64
+	}{
+		{"3g.20gb", 20 * 1024},
+		{"1g.5g", 5 * 1024},
+		{"1c.3g.20gb", 20 * 1024},
+		{"1g.10gb+me", 10 * 1024},
+		{"1g.24gb+gfx", 24 * 1024},
+		{"MIG 7g.80gb", 80 * 1024},
+		{" 2G.20GB ", 20 * 1024},
+		{"1g.10gb-me", 10 * 1024},
+		{"3g", 0},
+		{"3g.xgb", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := profileMemoryMB(tt.profile); got != tt.want {
+			t.Errorf("profileMemoryMB(%q) = %d, want %d", tt.profile, got, tt.want)
+		}
+	}
+}
+
+// profile 表只查询一次，失效后下次查询重新执行 -lgip
+func TestProfileTableCache(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	t.Setenv("FAKE_SMI_CALLS", calls)
+	fakeSmiOutput(t, "\"mig -lgip\") echo >> \"$FAKE_SMI_CALLS\"; echo '"+lgipFixture+"' ;;")
+	countCalls := func() int {
+		raw, _ := os.ReadFile(calls)
+		return strings.Count(string(raw), "\n")
+	}
+
+	ctx := context.Background()
+	table := newProfileTable()
+	if id, err := table.ID(ctx, "3g.20gb"); err != nil || id != 9 {
+		t.Fatalf("ID(3g.20gb) = %d, %v, want 9", id, err)
+	}
+	if name, err := table.Name(ctx, 19); err != nil || name != "1g.5gb" {
+		t.Fatalf("Name(19) = %q, %v, want 1g.5gb", name, err)
+	}
+	if ok, err := table.Supported(ctx, "1", "3g.20gb"); err != nil || ok {
+		t.Fatalf("Supported(1, 3g.20gb) = %v, %v, want false", ok, err)
+	}
+	if _, err := table.ID(ctx, "7g.80gb"); err == nil {
+		t.Fatal("ID(7g.80gb) succeeded for a profile missing from the table")
+	}
+	if got := countCalls(); got != 1 {
+		t.Fatalf("nvidia-smi mig -lgip ran %d times, want 1", got)
+	}
+
+	table.invalidate()
+	if ok, err := table.Supported(ctx, "0", "3g.20gb"); err != nil || !ok {
+		t.Fatalf("Supported(0, 3g.20gb) = %v, %v, want true", ok, err)
+	}
+	if got := countCalls(); got != 2 {
+		t.Fatalf("nvidia-smi mig -lgip ran %d times after invalidate, want 2", got)
+	}
+}
+
+// MIG_PROFILE 可按GPU序号配置，未单独配置的GPU使用默认profile
+func TestMIGProfileFor(t *testing.T) {
+	tests := []struct {
+		spec        string
+		want        map[string]string // GPU序号到profile
+		wantDefault bool
+	}{
+		{"", map[string]string{"0": defaultMIGProfile, "1": defaultMIGProfile}, false},
+		{"1g.10gb", map[string]string{"0": "1g.10gb", "3": "1g.10gb"}, true},
+		{"0=1g.10gb, 1=3g.40gb", map[string]string{"0": "1g.10gb", "1": "3g.40gb", "2": defaultMIGProfile}, false},
+		{"2g.20gb,1=7g.80gb", map[string]string{"0": "2g.20gb", "1": "7g.80gb"}, true},
+		{"x=1g.10gb,0=,1g.10gb", map[string]string{"0": "1g.10gb", "x": "1g.10gb"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			m := NewMIGManagerWithConfig(config.MIGConfig{Profile: tt.spec})
+			for gpu, want := range tt.want {
+				if got := m.profileFor(gpu); got != want {
+					t.Errorf("profileFor(%s) = %q, want %q", gpu, got, want)
+				}
+			}
+			if got := hasDefaultMIGProfile(tt.spec); got != tt.wantDefault {
+				t.Errorf("hasDefaultMIGProfile() = %v, want %v", got, tt.wantDefault)
+			}
+		})
+	}
+}
@@ -0,0 +1,486 @@
+package device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+)
+
+func TestPhysicalCapacity(t *testing.T) {
+	tests := []struct {
+		name   string
+		device *NVIDIADevice
+		want   int
+	}{
+		{"whole GPU", &NVIDIADevice{}, 1},
+		{"time-slice replicas", &NVIDIADevice{replicas: 4}, 4},
+		{"A100 1g.5gb", &NVIDIADevice{migEnabled: true, profile: "1g.5gb", productName: "NVIDIA A100-SXM4-40GB"}, 7},
+		{"H100 3g.40gb", &NVIDIADevice{migEnabled: true, profile: "3g.40gb", productName: "NVIDIA H100 80GB HBM3"}, 2},
+		{"unknown profile", &NVIDIADevice{migEnabled: true, profile: "9g.1tb", productName: "NVIDIA A100-SXM4-40GB"}, 0},
+		{"unknown model", &NVIDIADevice{migEnabled: true, profile: "1g.5gb", productName: "Tesla T4"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.device.PhysicalCapacity(); got != tt.want {
+				t.Fatalf("PhysicalCapacity() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeBackend 按固定数据返回GPU与MIG设备，delay 模拟每次 nvidia-smi 调用的耗时
+// 健康检查相关的查询按GPU计数
+type fakeBackend struct {
+	gpus    []nvidiaGPU
+	mig     map[string][]migDeviceInfo
+	migErrs map[string]error
+	listErr error
+	delay   time.Duration
+
+	mu           sync.Mutex
+	healthCalls  map[string]int
+	degradation  nvidiaDegradation
+	utilizeError error
+}
+
+func (b *fakeBackend) countHealthCall(id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.healthCalls == nil {
+		b.healthCalls = make(map[string]int)
+	}
+	b.healthCalls[id]++
+}
+
+func (b *fakeBackend) Name() string { return "fake" }
+
+func (b *fakeBackend) ListGPUs(context.Context) ([]nvidiaGPU, error) {
+	return b.gpus, b.listErr
+}
+
+func (b *fakeBackend) ListMIG(_ context.Context, gpuIndex string) ([]migDeviceInfo, error) {
+	time.Sleep(b.delay)
+	return b.mig[gpuIndex], b.migErrs[gpuIndex]
+}
+
+func (b *fakeBackend) Utilization(_ context.Context, id string) (uint, error) {
+	b.countHealthCall(id)
+	return 0, b.utilizeError
+}
+func (b *fakeBackend) UncorrectedECCErrors(_ context.Context, id string) (uint64, bool, error) {
+	b.countHealthCall(id)
+	return 0, true, nil
+}
+func (b *fakeBackend) Temperature(_ context.Context, id string) (uint, error) {
+	b.countHealthCall(id)
+	return 40, nil
+}
+func (b *fakeBackend) DegradationStatus(_ context.Context, id string) (nvidiaDegradation, error) {
+	b.countHealthCall(id)
+	return b.degradation, nil
+}
+
+// newFakeMIGBackend 每块GPU均开启MIG并切分为 perGPU 个 1g.5gb 实例
+func newFakeMIGBackend(gpuCount, perGPU int) *fakeBackend {
+	b := &fakeBackend{mig: make(map[string][]migDeviceInfo)}
+	for i := 0; i < gpuCount; i++ {
+		index := strconv.Itoa(i)
+		b.gpus = append(b.gpus, nvidiaGPU{index: index, uuid: "GPU-" + index, migEnabled: true, name: "NVIDIA A100-SXM4-40GB"})
+		for k := 0; k < perGPU; k++ {
+			b.mig[index] = append(b.mig[index], migDeviceInfo{uuid: fmt.Sprintf("MIG-%s-%d", index, k), profile: "1g.5gb"})
+		}
+	}
+	return b
+}
+
+func newTestNVIDIAManager(backend nvidiaBackend, concurrency int) *NVIDIAManager {
+	return &NVIDIAManager{
+		backend:              backend,
+		migManager:           &MIGManager{enabled: true},
+		deviceMap:            make(map[string]*NVIDIADevice),
+		maxActiveLinks:       make(map[string]int),
+		eccCounts:            make(map[string]uint64),
+		gpuHealth:            make(map[string]gpuHealthResult),
+		discoveryConcurrency: concurrency,
+	}
+}
+
+func deviceIDs(devices []GPUDevice) []string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID()
+	}
+	return ids
+}
+
+// 并行查询MIG设备的结果与串行查询完全一致，且顺序稳定
+func TestDiscoverMIGConcurrencyMatchesSerial(t *testing.T) {
+	backend := newFakeMIGBackend(8, 7)
+	serial, err := newTestNVIDIAManager(backend, 1).DiscoverGPUs()
+	if err != nil {
+		t.Fatalf("serial DiscoverGPUs() error = %v", err)
+	}
+	if len(serial) != 56 {
+		t.Fatalf("serial DiscoverGPUs() found %d devices, want 56", len(serial))
+	}
+	for _, concurrency := range []int{2, 4, 8, 16} {
+		t.Run(strconv.Itoa(concurrency), func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				devices, err := newTestNVIDIAManager(backend, concurrency).DiscoverGPUs()
+				if err != nil {
+					t.Fatalf("DiscoverGPUs() error = %v", err)
+				}
+				if got, want := deviceIDs(devices), deviceIDs(serial); !reflect.DeepEqual(got, want) {
+					t.Fatalf("DiscoverGPUs() = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDiscoverMIG(b *testing.B) {
+	backend := newFakeMIGBackend(8, 7)
+	backend.delay = time.Millisecond
+	for _, concurrency := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			m := newTestNVIDIAManager(backend, concurrency)
+			for i := 0; i < b.N; i++ {
+				if _, err := m.DiscoverGPUs(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// 单块GPU查询失败时其余GPU照常上报，并报告失败的GPU
+func TestDiscoverReportsFailedGPUs(t *testing.T) {
+	tests := []struct {
+		name       string
+		migErrs    map[string]error
+		gpuErr     bool // GPU 2 的基本信息查询失败
+		wantCount  int
+		wantFailed []string
+		wantErr    bool
+	}{
+		{"all discovered", nil, false, 21, nil, false},
+		{"MIG query failed", map[string]error{"1": errors.New("timeout")}, false, 14, []string{"1"}, false},
+		{"GPU query failed", nil, true, 14, []string{"2"}, false},
+		{"all failed", map[string]error{"0": errors.New("timeout"), "1": errors.New("timeout")}, true, 0, []string{"0", "1", "2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newFakeMIGBackend(3, 7)
+			backend.migErrs = tt.migErrs
+			if tt.gpuErr {
+				backend.gpus[2] = nvidiaGPU{index: "2", err: errors.New("failed to query UUID")}
+			}
+			m := newTestNVIDIAManager(backend, 4)
+			devices, err := m.DiscoverGPUs()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DiscoverGPUs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(devices) != tt.wantCount {
+				t.Fatalf("DiscoverGPUs() found %d devices, want %d", len(devices), tt.wantCount)
+			}
+			if got := m.FailedPhysicalIDs(); !reflect.DeepEqual(got, tt.wantFailed) {
+				t.Fatalf("FailedPhysicalIDs() = %v, want %v", got, tt.wantFailed)
+			}
+		})
+	}
+}
+
+// 列出GPU失败时保留设备映射，恢复后沿用上次的健康检查结果
+func TestDiscoverKeepsHealthWhenListingFails(t *testing.T) {
+	backend := newFakeMIGBackend(1, 2)
+	m := newTestNVIDIAManager(backend, 1)
+	if _, err := m.DiscoverGPUs(); err != nil {
+		t.Fatal(err)
+	}
+	m.deviceMap["MIG-0-0"].setHealthy(false)
+
+	backend.listErr = errors.New("nvidia-smi timed out")
+	if _, err := m.DiscoverGPUs(); err == nil {
+		t.Fatal("DiscoverGPUs() succeeded while listing GPUs fails")
+	}
+	if _, ok := m.GetDevice("MIG-0-0"); !ok {
+		t.Fatal("device map was reset by a failed discovery")
+	}
+
+	backend.listErr = nil
+	if _, err := m.DiscoverGPUs(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"MIG-0-0", false},
+		{"MIG-0-1", true},
+	}
+	for _, tt := range tests {
+		d, ok := m.GetDevice(tt.id)
+		if !ok {
+			t.Fatalf("GetDevice(%s) not found", tt.id)
+		}
+		if d.IsHealthy() != tt.want {
+			t.Fatalf("%s IsHealthy() = %v, want %v", tt.id, d.IsHealthy(), tt.want)
+		}
+	}
+}
+
+// 同一物理GPU上的MIG切片与时间片副本在一轮检查中只查询一次GPU状态
+func TestCheckHealthQueriesEachGPUOnce(t *testing.T) {
+	wholeGPUs := &fakeBackend{gpus: []nvidiaGPU{
+		{index: "0", uuid: "GPU-0", name: "NVIDIA A100-SXM4-40GB"},
+		{index: "1", uuid: "GPU-1", name: "NVIDIA A100-SXM4-40GB"},
+	}}
+	tests := []struct {
+		name       string
+		backend    *fakeBackend
+		timeSlices int
+		wantIDs    []string // 每块GPU的查询标识
+	}{
+		{"MIG slices", newFakeMIGBackend(2, 7), 1, []string{"0", "1"}},
+		{"time-slice replicas", wholeGPUs, 4, []string{"GPU-0", "GPU-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.backend.degradation = nvidiaDegradation{activeLinks: -1, thermalSlowdown: true}
+			m := newTestNVIDIAManager(tt.backend, 1)
+			m.timeSliceCount = tt.timeSlices
+			m.eccThreshold.Store(1)
+			m.tempThreshold.Store(90)
+			fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+			m.SetClock(fakeClock)
+			devices, err := m.DiscoverGPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(devices) <= len(tt.wantIDs) {
+				t.Fatalf("DiscoverGPUs() found %d devices, want several per GPU", len(devices))
+			}
+
+			// 每块GPU查询利用率、ECC、温度与降级状态各一次
+			for round, wantCalls := range []int{4, 4, 8} {
+				switch round {
+				case 1:
+					fakeClock.Step(time.Second) // 同一轮内复用结果
+				case 2:
+					fakeClock.Step(gpuHealthCacheTTL)
+				}
+				for _, d := range devices {
+					if !m.CheckHealth(d.ID()) {
+						t.Fatalf("CheckHealth(%s) = false, want true", d.ID())
+					}
+					if got := d.(*NVIDIADevice).Degradations(); !reflect.DeepEqual(got, []string{DegradationThermal}) {
+						t.Fatalf("%s Degradations() = %v, want [%s]", d.ID(), got, DegradationThermal)
+					}
+				}
+				for _, id := range tt.wantIDs {
+					if got := tt.backend.healthCalls[id]; got != wantCalls {
+						t.Fatalf("round %d: GPU %s queried %d times, want %d", round, id, got, wantCalls)
+					}
+				}
+			}
+		})
+	}
+}
+
+// 强制刷新时丢弃缓存的健康结果，GPU故障立即可见
+func TestInvalidateCacheRechecksHealth(t *testing.T) {
+	backend := newFakeMIGBackend(1, 2)
+	m := newTestNVIDIAManager(backend, 1)
+	m.SetClock(clock.NewFakeClock(time.Unix(0, 0)))
+	if _, err := m.DiscoverGPUs(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.CheckHealth("MIG-0-0") {
+		t.Fatal("CheckHealth() = false before the GPU failed")
+	}
+	backend.utilizeError = errors.New("GPU is lost")
+	if !m.CheckHealth("MIG-0-1") {
+		t.Fatal("CheckHealth() did not reuse the cached result")
+	}
+	m.InvalidateCache()
+	if m.CheckHealth("MIG-0-1") {
+		t.Fatal("CheckHealth() = true after the cache was invalidated")
+	}
+}
+
+// eventBackend 通过 events 推送健康事件的后端
+type eventBackend struct {
+	*fakeBackend
+	events chan string
+}
+
+func (b eventBackend) WatchEvents(ctx context.Context, notify func(gpuIndex string)) error {
+	for {
+		select {
+		case gpuIndex := <-b.events:
+			notify(gpuIndex)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// 后端推送健康事件时立即上报该GPU上的全部设备，无需等待轮询
+func TestWatchHealthEvents(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1h")
+	backend := eventBackend{newFakeMIGBackend(2, 2), make(chan string)}
+	m := newTestNVIDIAManager(backend, 1)
+	m.SetCacheTTL(time.Hour)
+	if _, err := m.DiscoverGPUs(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan string)
+	go m.WatchHealth(ctx, changed)
+	backend.events <- "1"
+
+	var got []string
+	for len(got) < 2 {
+		select {
+		case id := <-changed:
+			got = append(got, id)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("WatchHealth() reported %v, want the devices of GPU 1", got)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"MIG-1-0", "MIG-1-1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("WatchHealth() reported %v, want %v", got, want)
+	}
+	m.discoverySync.Lock()
+	cached := m.devices
+	m.discoverySync.Unlock()
+	if cached != nil {
+		t.Fatal("health event did not invalidate the discovery cache")
+	}
+}
+
+// 找不到 nvidia-smi 且允许回退时使用模拟设备，否则照常报错
+func TestSimulatorFallback(t *testing.T) {
+	installed := filepath.Join(t.TempDir(), "nvidia-smi")
+	if err := os.WriteFile(installed, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		smiPath      string
+		allow        string
+		wantFallback bool
+	}{
+		{"missing and allowed", "/nonexistent/nvidia-smi", "true", true},
+		{"missing but not allowed", "/nonexistent/nvidia-smi", "", false},
+		{"installed", installed, "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NVIDIA_SMI_PATH", tt.smiPath)
+			t.Setenv("ALLOW_SIMULATOR_FALLBACK", tt.allow)
+			t.Setenv("SIM_FAIL_RATE", "0")
+			m := NewNVIDIAManager()
+			devices, err := m.DiscoverGPUs()
+			if !tt.wantFallback {
+				if m.fallback != nil || err == nil {
+					t.Fatalf("DiscoverGPUs() = %d devices, %v, want an error from nvidia-smi", len(devices), err)
+				}
+				return
+			}
+			if err != nil || len(devices) == 0 {
+				t.Fatalf("DiscoverGPUs() = %d devices, %v, want simulated devices", len(devices), err)
+			}
+			if !m.CheckHealth(devices[0].ID()) {
+				t.Fatalf("CheckHealth(%s) = false for a simulated device", devices[0].ID())
+			}
+		})
+	}
+}
+
+// 型号名称记录在整卡上，MIG切片与时间片副本继承物理GPU的型号
+func TestDiscoverProductName(t *testing.T) {
+	const product = "NVIDIA A100-SXM4-40GB"
+	tests := []struct {
+		name       string
+		backend    *fakeBackend
+		timeSlices int
+	}{
+		{"whole GPU", &fakeBackend{gpus: []nvidiaGPU{{index: "0", uuid: "GPU-0", name: product}}}, 1},
+		{"MIG slices", newFakeMIGBackend(1, 2), 1},
+		{"time-slice replicas", &fakeBackend{gpus: []nvidiaGPU{{index: "0", uuid: "GPU-0", name: product}}}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestNVIDIAManager(tt.backend, 1)
+			m.timeSliceCount = tt.timeSlices
+			devices, err := m.DiscoverGPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(devices) == 0 {
+				t.Fatal("DiscoverGPUs() found no devices")
+			}
+			for _, d := range devices {
+				if got := d.(ProductNamer).ProductName(); got != product {
+					t.Fatalf("%s ProductName() = %q, want %q", d.ID(), got, product)
+				}
+				if got := d.Attributes()[AttrProductName]; got != product {
+					t.Fatalf("%s attribute %s = %q, want %q", d.ID(), AttrProductName, got, product)
+				}
+			}
+		})
+	}
+}
+
+// listCountingBackend 记录列出GPU的次数
+type listCountingBackend struct {
+	*fakeBackend
+	lists int
+}
+
+func (b *listCountingBackend) ListGPUs(ctx context.Context) ([]nvidiaGPU, error) {
+	b.lists++
+	return b.fakeBackend.ListGPUs(ctx)
+}
+
+// GetDevice 只在尚未发现过设备时发现一次，之后直接查设备映射
+func TestGetDeviceWithoutRediscovery(t *testing.T) {
+	backend := &listCountingBackend{fakeBackend: newFakeMIGBackend(1, 2)}
+	m := newTestNVIDIAManager(backend, 1)
+
+	tests := []struct {
+		id      string
+		found   bool
+		wantMIG bool
+	}{
+		{"MIG-0-1", true, true},
+		{"MIG-0-0", true, true},
+		{"MIG-9-9", false, false},
+	}
+	for _, tt := range tests {
+		d, ok := m.GetDevice(tt.id)
+		if ok != tt.found {
+			t.Fatalf("GetDevice(%s) found = %v, want %v", tt.id, ok, tt.found)
+		}
+		if ok && d.IsMIG() != tt.wantMIG {
+			t.Fatalf("GetDevice(%s).IsMIG() = %v, want %v", tt.id, d.IsMIG(), tt.wantMIG)
+		}
+	}
+	if backend.lists != 1 {
+		t.Fatalf("GPUs listed %d times, want 1", backend.lists)
+	}
+}
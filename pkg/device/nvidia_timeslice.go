@@ -0,0 +1,45 @@
+package device
+
+import "strconv"
+
+// replicaSeparator 时间片共享时副本设备ID的分隔符，如 GPU-xxx::0
+const replicaSeparator = "::"
+
+// replicaID 生成物理GPU第i个时间片副本的设备ID
+func replicaID(uuid string, i int) string {
+	return uuid + replicaSeparator + strconv.Itoa(i)
+}
+
+// replicaMemoryLimit 副本平分GPU显存，余数舍去，各副本配额之和不超过总显存
+func replicaMemoryLimit(totalMB uint64, count int) uint64 {
+	if count <= 1 {
+		return 0
+	}
+	return totalMB / uint64(count)
+}
+
+// timeSliceReplicas 将整卡按 NVIDIA_TIME_SLICE_COUNT 展开为多个副本设备
+// 副本共享UUID与物理GPU，分配时映射回同一块GPU；count 不大于1时原样返回
+func timeSliceReplicas(gpu *NVIDIADevice, count int) []*NVIDIADevice {
+	if count <= 1 {
+		return []*NVIDIADevice{gpu}
+	}
+	memoryLimit := replicaMemoryLimit(gpu.memoryMB, count)
+	replicas := make([]*NVIDIADevice, count)
+	for i := range replicas {
+		replicas[i] = &NVIDIADevice{
+			id:          replicaID(gpu.uuid, i),
+			uuid:        gpu.uuid,
+			deviceIndex: gpu.deviceIndex,
+			physicalID:  gpu.physicalID,
+			memoryMB:    gpu.memoryMB,
+			pciBusID:    gpu.pciBusID,
+			numaNode:    gpu.numaNode,
+			productName: gpu.productName,
+			healthy:     gpu.healthy,
+			replicas:    count,
+			memoryLimit: memoryLimit,
+		}
+	}
+	return replicas
+}
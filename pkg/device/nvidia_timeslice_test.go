@@ -0,0 +1,51 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 开启时间片共享时每块整卡展开为多个副本，副本映射回同一UUID并平分显存
+func TestDiscoverTimeSliceReplicas(t *testing.T) {
+	backend := &fakeBackend{gpus: []nvidiaGPU{
+		{index: "0", uuid: "GPU-0", memoryMB: 40000, name: "NVIDIA A100-SXM4-40GB"},
+	}}
+	tests := []struct {
+		name      string
+		count     int
+		wantIDs   []string
+		wantAttrs map[string]string // 每个副本应带的属性，nil 表示不应出现
+	}{
+		{"exclusive", 1, []string{"GPU-0"}, nil},
+		{"three replicas", 3, []string{"GPU-0::0", "GPU-0::1", "GPU-0::2"},
+			map[string]string{AttrReplicas: "3", AttrMemoryLimit: "13333"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestNVIDIAManager(backend, 1)
+			m.timeSliceCount = tt.count
+			devices, err := m.DiscoverGPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, d := range devices {
+				ids = append(ids, d.ID())
+				gpu := d.(*NVIDIADevice)
+				if got := gpu.VisibleDeviceID(); got != "GPU-0" {
+					t.Fatalf("%s VisibleDeviceID() = %q, want GPU-0", d.ID(), got)
+				}
+				attrs := d.Attributes()
+				for _, key := range []string{AttrReplicas, AttrMemoryLimit} {
+					want, ok := tt.wantAttrs[key]
+					if got, has := attrs[key]; has != ok || got != want {
+						t.Fatalf("%s attribute %s = %q (present %v), want %q (present %v)", d.ID(), key, got, has, want, ok)
+					}
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Fatalf("DiscoverGPUs() ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
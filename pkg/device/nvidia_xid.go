@@ -0,0 +1,98 @@
+package device
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"k8s.io/klog/v2"
+)
+
+// 默认视为致命的XID错误
+// 48: 双比特ECC错误, 63/64: 显存页退役, 74: NVLink错误, 79: GPU掉卡, 94/95: 显存错误（可/不可隔离）
+const defaultFatalXIDs = "48,63,64,74,79,94,95"
+
+// 内核日志扫描结果的缓存时间，避免每个设备的健康检查都执行一次dmesg
+const xidScanInterval = 10 * time.Second
+
+// 内核日志示例: "NVRM: Xid (PCI:0000:3b:00): 79, pid=1234, GPU has fallen off the bus."
+var xidLogRe = regexp.MustCompile(`NVRM: Xid \(PCI:([0-9a-fA-F]+:[0-9a-fA-F]+:[0-9a-fA-F]+)[^)]*\): (\d+)`)
+
+// 读取内核日志的命令，测试时可替换
+var kernelLogCommand = []string{"dmesg"}
+
+// fatalXIDSet 解析 NVIDIA_FATAL_XIDS（逗号分隔），未设置时使用默认列表
+func fatalXIDSet() map[int]bool {
+	value := os.Getenv("NVIDIA_FATAL_XIDS")
+	if value == "" {
+		value = defaultFatalXIDs
+	}
+	xids := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		xid, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			klog.Warningf("Ignoring invalid XID %q in NVIDIA_FATAL_XIDS", field)
+			continue
+		}
+		xids[xid] = true
+	}
+	return xids
+}
+
+// parseXIDEvents 解析内核日志，返回每个PCI地址最近一次的XID
+func parseXIDEvents(output string) map[string]int {
+	events := make(map[string]int)
+	for _, line := range strings.Split(output, "\n") {
+		matches := xidLogRe.FindStringSubmatch(line)
+		if len(matches) < 3 {
+			continue
+		}
+		xid, err := strconv.Atoi(matches[2])
+		if err != nil {
+			continue
+		}
+		events[normalizeXIDBusID(matches[1])] = xid
+	}
+	return events
+}
+
+// normalizeXIDBusID 统一为 "0000:3b:00" 形式
+// nvidia-smi 的总线地址为 "00000000:3B:00.0"，内核日志为 "0000:3b:00"
+func normalizeXIDBusID(busID string) string {
+	busID = strings.ToLower(busID)
+	if idx := strings.Index(busID, "."); idx >= 0 {
+		busID = busID[:idx]
+	}
+	parts := strings.Split(busID, ":")
+	if len(parts) == 3 && len(parts[0]) > 4 {
+		parts[0] = parts[0][len(parts[0])-4:]
+	}
+	return strings.Join(parts, ":")
+}
+
+// recentXID 返回物理GPU最近一次的XID，没有时返回0
+func (m *NVIDIAManager) recentXID(pciBusID string) int {
+	if pciBusID == "" {
+		return 0
+	}
+
+	m.xidMu.Lock()
+	defer m.xidMu.Unlock()
+
+	now := clock.OrReal(m.clock).Now()
+	if m.xidEvents == nil || now.Sub(m.xidScannedAt) >= xidScanInterval {
+		out, err := exec.Command(kernelLogCommand[0], kernelLogCommand[1:]...).Output()
+		if err != nil {
+			klog.V(4).Infof("Failed to read kernel log for XID events: %v", err)
+			m.xidEvents = make(map[string]int)
+		} else {
+			m.xidEvents = parseXIDEvents(string(out))
+		}
+		m.xidScannedAt = now
+	}
+	return m.xidEvents[normalizeXIDBusID(pciBusID)]
+}
@@ -0,0 +1,105 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+)
+
+func TestParseXIDEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   map[string]int
+	}{
+		{"latest XID per GPU", `[ 1234.567] NVRM: Xid (PCI:0000:3b:00): 13, pid=1234, Graphics Exception
+[ 1240.001] NVRM: Xid (PCI:0000:af:00.0): 79, pid=0, GPU has fallen off the bus.
+[ 1250.002] NVRM: Xid (PCI:0000:3B:00): 48, pid=1234, An uncorrectable double bit error
+[ 1251.000] usb 1-1: new high-speed USB device`, map[string]int{"0000:3b:00": 48, "0000:af:00": 79}},
+		{"empty", "", map[string]int{}},
+		{"malformed", "NVRM: Xid (PCI:zz): 79\nNVRM: Xid (PCI:0000:3b:00): abc\nNVRM: Xid 79", map[string]int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseXIDEvents(tt.output); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseXIDEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeXIDBusID(t *testing.T) {
+	tests := []struct {
+		busID string
+		want  string
+	}{
+		{"00000000:3B:00.0", "0000:3b:00"},
+		{"0000:3b:00", "0000:3b:00"},
+		{"0000:AF:00.0", "0000:af:00"},
+		{"3b:00", "3b:00"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeXIDBusID(tt.busID); got != tt.want {
+			t.Errorf("normalizeXIDBusID(%q) = %q, want %q", tt.busID, got, tt.want)
+		}
+	}
+}
+
+// 致命XID将GPU标记为不健康，非致命XID只记录在设备属性中
+func TestCheckHealthFatalXID(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "dmesg")
+	log := `[ 10.000] NVRM: Xid (PCI:0000:3b:00): 13, pid=1234, Graphics Exception
+[ 20.000] NVRM: Xid (PCI:0000:af:00): 79, pid=0, GPU has fallen off the bus.
+`
+	if err := os.WriteFile(logPath, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+	saved := kernelLogCommand
+	kernelLogCommand = []string{"cat", logPath}
+	t.Cleanup(func() { kernelLogCommand = saved })
+
+	tests := []struct {
+		name      string
+		fatalXIDs string
+		want      map[string]bool
+	}{
+		{"default fatal list", "", map[string]bool{"GPU-0": true, "GPU-1": false, "GPU-2": true}},
+		{"custom fatal list", "13", map[string]bool{"GPU-0": false, "GPU-1": true, "GPU-2": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NVIDIA_FATAL_XIDS", tt.fatalXIDs)
+			m := newTestNVIDIAManager(&fakeBackend{gpus: []nvidiaGPU{
+				{index: "0", uuid: "GPU-0", pciBusID: "00000000:3B:00.0"},
+				{index: "1", uuid: "GPU-1", pciBusID: "00000000:AF:00.0"},
+				{index: "2", uuid: "GPU-2", pciBusID: "00000000:D8:00.0"},
+			}}, 1)
+			m.fatalXIDs = fatalXIDSet()
+			m.tempThreshold.Store(90)
+			m.SetClock(clock.NewFakeClock(time.Unix(0, 0)))
+			if _, err := m.DiscoverGPUs(); err != nil {
+				t.Fatal(err)
+			}
+			wantXID := map[string]int{"GPU-0": 13, "GPU-1": 79, "GPU-2": 0}
+			for id, want := range tt.want {
+				if got := m.CheckHealth(id); got != want {
+					t.Errorf("CheckHealth(%s) = %v, want %v", id, got, want)
+				}
+				device := m.deviceMap[id]
+				if got := device.LastXID(); got != wantXID[id] {
+					t.Errorf("%s LastXID() = %d, want %d", id, got, wantXID[id])
+				}
+				attr, ok := device.Attributes()[AttrLastXID]
+				if wantXID[id] == 0 && ok || wantXID[id] != 0 && attr != strconv.Itoa(wantXID[id]) {
+					t.Errorf("%s %s attribute = %q, want XID %d", id, AttrLastXID, attr, wantXID[id])
+				}
+			}
+		})
+	}
+}
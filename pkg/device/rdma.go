@@ -0,0 +1,98 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// sysfs中RDMA设备目录，测试时可替换
+var sysfsInfinibandPath = "/sys/class/infiniband"
+
+// rdmaCMDevice RDMA连接管理设备，使用 RDMA 的容器都需要
+const rdmaCMDevice = "/dev/infiniband/rdma_cm"
+
+// rdmaNIC 与GPU拓扑最近的RDMA网卡
+type rdmaNIC struct {
+	name  string   // RDMA设备名，如 mlx5_0
+	paths []string // 容器需要的设备节点
+}
+
+// nearestRDMANIC 按PCI拓扑查找离GPU最近的RDMA网卡：sysfs 中两者路径的公共前缀越长，
+// 经过的PCIe交换机越少；没有RDMA设备时返回nil
+func nearestRDMANIC(pciBusID string) *rdmaNIC {
+	gpuPath, err := filepath.EvalSymlinks(filepath.Join(sysfsPCIDevicesPath, sysfsBusID(pciBusID)))
+	if err != nil {
+		klog.V(4).Infof("Failed to resolve PCI path of GPU %s: %v", pciBusID, err)
+		return nil
+	}
+	entries, err := os.ReadDir(sysfsInfinibandPath)
+	if err != nil {
+		klog.V(4).Infof("No RDMA devices found in %s: %v", sysfsInfinibandPath, err)
+		return nil
+	}
+
+	best, bestDepth := "", -1
+	for _, entry := range entries {
+		nicPath, err := filepath.EvalSymlinks(filepath.Join(sysfsInfinibandPath, entry.Name(), "device"))
+		if err != nil {
+			continue
+		}
+		// 按名称顺序遍历，深度相同时选名称最小的网卡
+		if depth := commonPathDepth(gpuPath, nicPath); depth > bestDepth {
+			best, bestDepth = entry.Name(), depth
+		}
+	}
+	if best == "" {
+		return nil
+	}
+	return &rdmaNIC{name: best, paths: rdmaDevicePaths(best)}
+}
+
+// rdmaDevicePaths 返回RDMA网卡的 uverbs 设备节点及 rdma_cm
+func rdmaDevicePaths(name string) []string {
+	var paths []string
+	entries, err := os.ReadDir(filepath.Join(sysfsInfinibandPath, name, "device", "infiniband_verbs"))
+	if err != nil {
+		klog.Warningf("Failed to list verbs devices of RDMA device %s: %v", name, err)
+	}
+	for _, entry := range entries {
+		paths = append(paths, "/dev/infiniband/"+entry.Name())
+	}
+	sort.Strings(paths)
+	return append(paths, rdmaCMDevice)
+}
+
+// commonPathDepth 两个路径共有的前导目录层数
+func commonPathDepth(a, b string) int {
+	as := strings.Split(filepath.Clean(a), string(filepath.Separator))
+	bs := strings.Split(filepath.Clean(b), string(filepath.Separator))
+	depth := 0
+	for depth < len(as) && depth < len(bs) && as[depth] == bs[depth] {
+		depth++
+	}
+	return depth
+}
+
+// attachRDMA 为设备关联拓扑最近的RDMA网卡，MIG设备与其物理GPU共用
+func (m *NVIDIAManager) attachRDMA(devices []GPUDevice) {
+	nics := make(map[string]*rdmaNIC)
+	for _, d := range devices {
+		nvDevice, ok := d.(*NVIDIADevice)
+		if !ok || nvDevice.pciBusID == "" {
+			continue
+		}
+		nic, cached := nics[nvDevice.pciBusID]
+		if !cached {
+			nic = nearestRDMANIC(nvDevice.pciBusID)
+			nics[nvDevice.pciBusID] = nic
+			if nic != nil {
+				klog.Infof("GPU %s uses RDMA device %s for GPUDirect", nvDevice.pciBusID, nic.name)
+			}
+		}
+		nvDevice.rdma = nic
+	}
+}
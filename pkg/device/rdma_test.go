@@ -0,0 +1,87 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSysfs 在临时目录中构造PCI拓扑：GPU与 mlx5_1 位于同一PCIe交换机下，mlx5_0 在另一个根复合体
+func fakeSysfs(t *testing.T) {
+	root := t.TempDir()
+	mkdir := func(parts ...string) string {
+		dir := filepath.Join(append([]string{root}, parts...)...)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return dir
+	}
+	symlink := func(target, link string) {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gpu := mkdir("pci0000:00", "0000:00:01.0", "0000:3b:00.0")
+	near := mkdir("pci0000:00", "0000:00:01.0", "0000:3c:00.0")
+	far := mkdir("pci0000:80", "0000:80:01.0", "0000:af:00.0")
+	mkdir("pci0000:00", "0000:00:01.0", "0000:3c:00.0", "infiniband_verbs", "uverbs1")
+	mkdir("pci0000:80", "0000:80:01.0", "0000:af:00.0", "infiniband_verbs", "uverbs0")
+
+	pciDevices := mkdir("bus", "pci", "devices")
+	symlink(gpu, filepath.Join(pciDevices, "0000:3b:00.0"))
+	infiniband := mkdir("class", "infiniband")
+	for name, target := range map[string]string{"mlx5_0": far, "mlx5_1": near} {
+		symlink(target, filepath.Join(mkdir("class", "infiniband", name), "device"))
+	}
+
+	oldPCI, oldIB := sysfsPCIDevicesPath, sysfsInfinibandPath
+	sysfsPCIDevicesPath, sysfsInfinibandPath = pciDevices, infiniband
+	t.Cleanup(func() { sysfsPCIDevicesPath, sysfsInfinibandPath = oldPCI, oldIB })
+}
+
+// 选择与GPU公共PCI路径最长的网卡，并挂载其 uverbs 设备与 rdma_cm
+func TestNearestRDMANIC(t *testing.T) {
+	fakeSysfs(t)
+	nic := nearestRDMANIC("00000000:3B:00.0")
+	if nic == nil {
+		t.Fatal("nearestRDMANIC() = nil, want mlx5_1")
+	}
+	want := &rdmaNIC{name: "mlx5_1", paths: []string{"/dev/infiniband/uverbs1", rdmaCMDevice}}
+	if !reflect.DeepEqual(nic, want) {
+		t.Fatalf("nearestRDMANIC() = %+v, want %+v", nic, want)
+	}
+
+	// GPU 不在 sysfs 中或节点没有RDMA设备时不关联网卡
+	if nic := nearestRDMANIC("00000000:99:00.0"); nic != nil {
+		t.Fatalf("nearestRDMANIC(unknown GPU) = %+v, want nil", nic)
+	}
+	sysfsInfinibandPath = filepath.Join(t.TempDir(), "missing")
+	if nic := nearestRDMANIC("00000000:3B:00.0"); nic != nil {
+		t.Fatalf("nearestRDMANIC() without RDMA devices = %+v, want nil", nic)
+	}
+}
+
+// 开启 GPUDirect 后发现的设备带上关联的网卡
+func TestDiscoverAttachesRDMA(t *testing.T) {
+	fakeSysfs(t)
+	backend := &fakeBackend{gpus: []nvidiaGPU{
+		{index: "0", uuid: "GPU-0", pciBusID: "00000000:3B:00.0", name: "NVIDIA A100-SXM4-40GB"},
+	}}
+	m := newTestNVIDIAManager(backend, 1)
+	m.gpuDirect = true
+	devices, err := m.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 {
+		t.Fatalf("DiscoverGPUs() found %d devices, want 1", len(devices))
+	}
+	if got := devices[0].Attributes()[AttrRDMADevice]; got != "mlx5_1" {
+		t.Fatalf("%s attribute %s = %q, want mlx5_1", devices[0].ID(), AttrRDMADevice, got)
+	}
+	name, paths := devices[0].(RDMADeviceProvider).RDMADevice()
+	if name != "mlx5_1" || !reflect.DeepEqual(paths, []string{"/dev/infiniband/uverbs1", rdmaCMDevice}) {
+		t.Fatalf("RDMADevice() = %s %v", name, paths)
+	}
+}
@@ -1,23 +1,242 @@
 package device
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultSimDeviceCount = 3
+	defaultSimFailRate    = 0.1
+	// 模拟MIG设备使用的profile
+	simMIGProfile = "1g.10gb"
 )
 
 type SimulatorManager struct {
 	lastDiscovery time.Time
 	devices       []GPUDevice
+	clock         clock.Clock
+
+	deviceCount int             // 模拟GPU数
+	migPerGPU   int             // 每块GPU的模拟MIG设备数，0表示整卡
+	unhealthy   map[string]bool // 始终不健康的设备ID
+	failRate    float64         // 健康检查随机失败的比例
+
+	mu        sync.Mutex
+	overrides map[string]bool            // SetHealth 设置的健康状态，优先于脚本和随机失败
+	script    map[string][]simHealthStep // SIM_HEALTH_SCRIPT 中每个设备的状态切换
+	ticks     map[string]int             // 每个设备的 CheckHealth 调用次数
+	watchers  map[chan []GPUDevice]struct{}
+}
+
+// simHealthStep 第tick次（从1开始）检查起设备的健康状态
+type simHealthStep struct {
+	tick    int
+	healthy bool
+}
+
+// NewSimulatorManager 按 SIM_DEVICE_COUNT、SIM_MIG_PER_GPU、SIM_UNHEALTHY_IDS、SIM_FAIL_RATE 创建模拟管理器
+func NewSimulatorManager() *SimulatorManager {
+	m := &SimulatorManager{
+		clock:       clock.RealClock{},
+		deviceCount: int(uint64FromEnv("SIM_DEVICE_COUNT", defaultSimDeviceCount)),
+		migPerGPU:   int(uint64FromEnv("SIM_MIG_PER_GPU", 0)),
+		unhealthy:   make(map[string]bool),
+		failRate:    defaultSimFailRate,
+		overrides:   make(map[string]bool),
+		script:      parseSimHealthScript(os.Getenv("SIM_HEALTH_SCRIPT")),
+		ticks:       make(map[string]int),
+	}
+	for _, id := range strings.Split(os.Getenv("SIM_UNHEALTHY_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			m.unhealthy[id] = true
+		}
+	}
+	if value := os.Getenv("SIM_FAIL_RATE"); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			klog.Warningf("Invalid SIM_FAIL_RATE %q, using default %v", value, defaultSimFailRate)
+		} else {
+			m.failRate = rate
+		}
+	}
+	return m
+}
+
+// SetClock 替换时间来源，用于测试
+func (m *SimulatorManager) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// SetHealth 固定设备的健康状态，用于确定性地驱动健康状态切换
+func (m *SimulatorManager) SetHealth(id string, healthy bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.overrides == nil {
+		m.overrides = make(map[string]bool)
+	}
+	m.overrides[id] = healthy
+	m.notifyLocked()
+}
+
+// Watch 在 SetHealth 修改状态后推送最新设备列表
+func (m *SimulatorManager) Watch(ctx context.Context) (<-chan []GPUDevice, error) {
+	ch := make(chan []GPUDevice, 1)
+	m.mu.Lock()
+	if m.watchers == nil {
+		m.watchers = make(map[chan []GPUDevice]struct{})
+	}
+	m.watchers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		m.mu.Unlock()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// notifyLocked 向所有订阅者推送设备列表，未取走的旧列表被替换，调用方需持有锁
+func (m *SimulatorManager) notifyLocked() {
+	if len(m.watchers) == 0 {
+		return
+	}
+	devices := m.discoverLocked()
+	for ch := range m.watchers {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- devices
+	}
+}
+
+// parseSimHealthScript 解析 "id@tick:healthy,..."，如 "0@3:false,0@6:true"
+// 表示设备0从第3次检查起不健康、第6次起恢复，脚本中的设备不再随机失败
+func parseSimHealthScript(spec string) map[string][]simHealthStep {
+	script := make(map[string][]simHealthStep)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, rest, found := strings.Cut(entry, "@")
+		tickStr, healthyStr, found2 := strings.Cut(rest, ":")
+		tick, err := strconv.Atoi(tickStr)
+		healthy, err2 := strconv.ParseBool(healthyStr)
+		if !found || !found2 || id == "" || err != nil || tick < 1 || err2 != nil {
+			klog.Warningf("Ignoring invalid SIM_HEALTH_SCRIPT entry %q", entry)
+			continue
+		}
+		script[id] = append(script[id], simHealthStep{tick: tick, healthy: healthy})
+	}
+	for _, steps := range script {
+		sort.Slice(steps, func(i, j int) bool { return steps[i].tick < steps[j].tick })
+	}
+	return script
+}
+
+// scriptedHealth 返回 SetHealth 或脚本决定的健康状态，均未指定时返回false
+func (m *SimulatorManager) scriptedHealth(deviceID string) (bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ticks == nil {
+		m.ticks = make(map[string]int)
+	}
+	m.ticks[deviceID]++
+	if healthy, ok := m.overrides[deviceID]; ok {
+		return healthy, true
+	}
+	steps, ok := m.script[deviceID]
+	if !ok {
+		return false, false
+	}
+	healthy := true
+	for _, step := range steps {
+		if step.tick > m.ticks[deviceID] {
+			break
+		}
+		healthy = step.healthy
+	}
+	return healthy, true
 }
 
 func (m *SimulatorManager) DiscoverGPUs() ([]GPUDevice, error) {
-	return []GPUDevice{
-		&SimulatorDevice{id: "0", healthy: true},
-		&SimulatorDevice{id: "1", healthy: true},
-		&SimulatorDevice{id: "2", healthy: true},
-	}, nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.discoverLocked(), nil
+}
+
+// discoverLocked 生成模拟设备，SetHealth 固定的状态体现在设备上，调用方需持有锁
+func (m *SimulatorManager) discoverLocked() []GPUDevice {
+	var devices []GPUDevice
+	for i := 0; i < m.deviceCount; i++ {
+		gpu := strconv.Itoa(i)
+		if m.migPerGPU == 0 {
+			devices = append(devices, &SimulatorDevice{id: gpu, healthy: m.initialHealth(gpu, gpu)})
+			continue
+		}
+		for k := 0; k < m.migPerGPU; k++ {
+			id := fmt.Sprintf("%s-mig%d", gpu, k)
+			devices = append(devices, &SimulatorDevice{
+				id:       id,
+				healthy:  m.initialHealth(id, gpu),
+				parentID: gpu,
+				profile:  simMIGProfile,
+			})
+		}
+	}
+	return devices
+}
+
+// initialHealth 发现时设备的健康状态，调用方需持有锁
+func (m *SimulatorManager) initialHealth(id, gpu string) bool {
+	if m.unhealthy[id] || m.unhealthy[gpu] {
+		return false
+	}
+	if healthy, ok := m.overrides[id]; ok {
+		return healthy
+	}
+	return true
+}
+
+// InvalidateCache 模拟器不缓存发现结果
+func (m *SimulatorManager) InvalidateCache() {}
+
+func (m *SimulatorManager) WatchHealth(ctx context.Context, changed chan<- string) {
+	PollHealth(ctx, m, healthPollInterval(), changed)
+}
+
+// GetDevice 模拟设备由配置生成，直接按当前配置查找
+func (m *SimulatorManager) GetDevice(id string) (GPUDevice, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return findDevice(m.discoverLocked(), id)
 }
 
+// CheckHealth SIM_UNHEALTHY_IDS 中的设备（或其所属GPU）始终不健康，
+// 其次按 SetHealth 和 SIM_HEALTH_SCRIPT，其余按 SIM_FAIL_RATE 随机失败
 func (m *SimulatorManager) CheckHealth(deviceID string) bool {
-	// 模拟 10% 的失败率
-	return time.Now().UnixNano()%10 != 0
+	if m.unhealthy[deviceID] {
+		return false
+	}
+	if gpu, _, found := strings.Cut(deviceID, "-mig"); found && m.unhealthy[gpu] {
+		return false
+	}
+	if healthy, ok := m.scriptedHealth(deviceID); ok {
+		return healthy
+	}
+	return clock.OrReal(m.clock).Now().UnixNano()%1000 >= int64(m.failRate*1000)
 }
@@ -0,0 +1,105 @@
+package device
+
+import (
+	"reflect"
+	"testing"
+)
+
+// SIM_* 环境变量决定模拟设备的数量、MIG切分与健康状态
+func TestNewSimulatorManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		wantIDs     []string
+		wantHealthy []bool
+	}{
+		{"whole GPUs", map[string]string{"SIM_DEVICE_COUNT": "2", "SIM_FAIL_RATE": "0"},
+			[]string{"0", "1"}, []bool{true, true}},
+		{"MIG slices", map[string]string{"SIM_DEVICE_COUNT": "2", "SIM_MIG_PER_GPU": "2", "SIM_UNHEALTHY_IDS": "1", "SIM_FAIL_RATE": "0"},
+			[]string{"0-mig0", "0-mig1", "1-mig0", "1-mig1"}, []bool{true, true, false, false}},
+		{"unhealthy IDs", map[string]string{"SIM_DEVICE_COUNT": "3", "SIM_UNHEALTHY_IDS": " 0, 2", "SIM_FAIL_RATE": "0"},
+			[]string{"0", "1", "2"}, []bool{false, true, false}},
+		{"always failing", map[string]string{"SIM_DEVICE_COUNT": "1", "SIM_FAIL_RATE": "1"},
+			[]string{"0"}, []bool{false}},
+		{"default count", map[string]string{"SIM_FAIL_RATE": "0"},
+			[]string{"0", "1", "2"}, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"SIM_DEVICE_COUNT", "SIM_MIG_PER_GPU", "SIM_UNHEALTHY_IDS", "SIM_FAIL_RATE", "SIM_HEALTH_SCRIPT"} {
+				t.Setenv(key, tt.env[key])
+			}
+			m := NewSimulatorManager()
+			devices, err := m.DiscoverGPUs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			var healthy []bool
+			for _, d := range devices {
+				ids = append(ids, d.ID())
+				healthy = append(healthy, m.CheckHealth(d.ID()))
+				if d.IsMIG() && d.(ProfiledDevice).Profile() != simMIGProfile {
+					t.Fatalf("%s profile = %q, want %s", d.ID(), d.(ProfiledDevice).Profile(), simMIGProfile)
+				}
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(healthy, tt.wantHealthy) {
+				t.Fatalf("devices = %v healthy %v, want %v healthy %v", ids, healthy, tt.wantIDs, tt.wantHealthy)
+			}
+		})
+	}
+}
+
+func TestSimulatorFailRate(t *testing.T) {
+	for _, value := range []string{"-0.5", "2", "often"} {
+		t.Setenv("SIM_FAIL_RATE", value)
+		if got := NewSimulatorManager().failRate; got != defaultSimFailRate {
+			t.Errorf("failRate with SIM_FAIL_RATE=%q = %v, want default %v", value, got, defaultSimFailRate)
+		}
+	}
+}
+
+// 脚本按检查次数切换健康状态，SetHealth 优先于脚本
+func TestSimulatorHealthScript(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "2")
+	t.Setenv("SIM_FAIL_RATE", "1")
+	t.Setenv("SIM_HEALTH_SCRIPT", "0@4:true, 0@2:false, bad, 1@0:false, 1@x:true")
+	m := NewSimulatorManager()
+
+	// 脚本中的设备不再随机失败，无效条目被忽略
+	want := []bool{true, false, false, true, true}
+	for i, wantHealthy := range want {
+		if got := m.CheckHealth("0"); got != wantHealthy {
+			t.Fatalf("check %d: CheckHealth(0) = %v, want %v", i+1, got, wantHealthy)
+		}
+	}
+	if m.CheckHealth("1") {
+		t.Fatal("CheckHealth(1) = true, want failure from SIM_FAIL_RATE=1")
+	}
+
+	m.SetHealth("0", false)
+	m.SetHealth("1", true)
+	if m.CheckHealth("0") || !m.CheckHealth("1") {
+		t.Fatal("SetHealth() did not override the script and the fail rate")
+	}
+	devices, err := m.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if devices[0].IsHealthy() || !devices[1].IsHealthy() {
+		t.Fatal("discovered devices do not reflect SetHealth()")
+	}
+}
+
+// 模拟管理器按当前配置查找整卡与MIG设备
+func TestSimulatorGetDevice(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "2")
+	t.Setenv("SIM_MIG_PER_GPU", "2")
+	m := NewSimulatorManager()
+	if d, ok := m.GetDevice("1-mig1"); !ok || !d.IsMIG() || d.ID() != "1-mig1" {
+		t.Fatalf("GetDevice(1-mig1) = %v, %v", d, ok)
+	}
+	if _, ok := m.GetDevice("2"); ok {
+		t.Fatal("GetDevice(2) found a device beyond SIM_DEVICE_COUNT")
+	}
+}
@@ -0,0 +1,50 @@
+package device
+
+import (
+	"os"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+	"k8s.io/klog/v2"
+)
+
+// Vendors 支持的真实设备厂商
+var Vendors = []string{"nvidia", "huawei", "amd"}
+
+// ToolPath 返回厂商管理工具（nvidia-smi、npu-smi、rocm-smi）的路径，未知厂商返回空
+func ToolPath(vendor string, cfg config.VendorConfig) string {
+	switch vendor {
+	case "nvidia":
+		if cfg.SmiPath != "" {
+			return cfg.SmiPath
+		}
+		return NvidiaSmiPath()
+	case "huawei":
+		return getNpuSmiPath()
+	case "amd":
+		return getRocmSmiPath()
+	}
+	return ""
+}
+
+// ToolAvailable 厂商管理工具是否存在于宿主机上
+func ToolAvailable(vendor string, cfg config.VendorConfig) bool {
+	path := ToolPath(vendor, cfg)
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// DetectVendors 探测宿主机上存在管理工具的厂商，按 Vendors 的顺序返回
+func DetectVendors(cfg *config.Config) []string {
+	var detected []string
+	for _, vendor := range Vendors {
+		if ToolAvailable(vendor, cfg.Vendor(vendor)) {
+			detected = append(detected, vendor)
+		} else {
+			klog.Infof("%s management tool not found at %s", vendor, ToolPath(vendor, cfg.Vendor(vendor)))
+		}
+	}
+	return detected
+}
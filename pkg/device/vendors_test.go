@@ -0,0 +1,47 @@
+package device
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
+)
+
+// 只返回管理工具存在的厂商，配置中的 smiPath 覆盖默认的 nvidia-smi 路径
+func TestDetectVendors(t *testing.T) {
+	dir := t.TempDir()
+	tool := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	nvidiaSmi, npuSmi, rocmSmi := tool("nvidia-smi"), tool("npu-smi"), tool("rocm-smi")
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name              string
+		nvidia, npu, rocm string // 各管理工具的环境变量路径
+		cfgSmi            string
+		want              []string
+	}{
+		{"all tools", nvidiaSmi, npuSmi, rocmSmi, "", []string{"nvidia", "huawei", "amd"}},
+		{"huawei only", missing, npuSmi, missing, "", []string{"huawei"}},
+		{"none", missing, missing, missing, "", nil},
+		{"smiPath from config", "", missing, missing, nvidiaSmi, []string{"nvidia"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NVIDIA_SMI_PATH", tt.nvidia)
+			t.Setenv("NPU_SMI_PATH", tt.npu)
+			t.Setenv("ROCM_SMI_PATH", tt.rocm)
+			cfg := &config.Config{Vendors: map[string]config.VendorConfig{"nvidia": {SmiPath: tt.cfgSmi}}}
+			if got := DetectVendors(cfg); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DetectVendors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,523 @@
+package deviceplugin
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		drain    bool
+		ids      []string
+		wantCode codes.Code
+	}{
+		{"healthy device", false, []string{"0"}, codes.OK},
+		{"unknown device", false, []string{"missing"}, codes.NotFound},
+		{"draining", true, []string{"0"}, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			if tt.drain {
+				s.Drain()
+			}
+			req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: tt.ids}}}
+			_, err := s.Allocate(context.Background(), req)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("Allocate() code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK && len(s.allocator.GetAllocatedDevices()) > 0 {
+				t.Fatalf("rejected Allocate() left devices %v allocated", s.allocator.GetAllocatedDevices())
+			}
+		})
+	}
+}
+
+// slowPodGetter 模拟响应缓慢的API Server，查询一直阻塞到 ctx 结束
+type slowPodGetter struct{}
+
+func (slowPodGetter) GetPod(ctx context.Context, _, _ string) (*corev1.Pod, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowPodGetter) GetPodByUID(ctx context.Context, _ string) (*corev1.Pod, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// 查询Pod超过 ALLOCATE_TIMEOUT 时返回 DeadlineExceeded，回滚本次已分配的设备且不释放其他Pod的设备
+func TestAllocateTimeout(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.allocateTimeout = 100 * time.Millisecond
+	s.SetPodGetter(slowPodGetter{})
+	if err := s.allocator.Allocate([]string{"1"}, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+		{DevicesIDs: []string{"0"}},
+		{DevicesIDs: []string{"1"}},
+	}}
+	start := time.Now()
+	_, err := s.Allocate(context.Background(), req)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("Allocate() error = %v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Allocate() returned after %v, want about %v", elapsed, s.allocateTimeout)
+	}
+	want := map[string][]string{"1": {"other"}}
+	if got := s.allocator.GetAllocationMap(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("allocations after timeout = %v, want %v", got, want)
+	}
+}
+
+// 后面的容器分配失败时释放前面容器已分配的设备，其他Pod的分配保持不变
+func TestAllocateRollsBackEarlierContainers(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.SetPodGetter(NewPodGetter(fake.NewSimpleClientset(testPod("other", "node-1", corev1.PodRunning)), s.nodeName))
+	if err := s.allocator.Allocate([]string{"2"}, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+		{DevicesIDs: []string{"0"}},
+		{DevicesIDs: []string{"1"}},
+		{DevicesIDs: []string{"2"}},
+	}}
+	_, err := s.Allocate(context.Background(), req)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Allocate() error = %v, want ResourceExhausted", err)
+	}
+	want := map[string][]string{"2": {"other"}}
+	if got := s.allocator.GetAllocationMap(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("allocations after failed request = %v, want %v", got, want)
+	}
+
+	// 回滚后设备可以再次分配
+	req.ContainerRequests = req.ContainerRequests[:2]
+	if _, err := s.Allocate(context.Background(), req); err != nil {
+		t.Fatalf("Allocate() after rollback error = %v", err)
+	}
+}
+
+// 请求中任一容器引用了未发现的设备时拒绝整个请求，错误中只列出未知的ID
+func TestAllocateUnknownDevices(t *testing.T) {
+	s, _ := newTestServer(t)
+	req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+		{DevicesIDs: []string{"0"}},
+		{DevicesIDs: []string{"1", "0-mig0", "9"}},
+	}}
+	_, err := s.Allocate(context.Background(), req)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("Allocate() error = %v, want NotFound", err)
+	}
+	if msg := status.Convert(err).Message(); !strings.Contains(msg, "[0-mig0 9]") {
+		t.Fatalf("Allocate() error %q does not list the unknown devices", msg)
+	}
+	if got := s.allocator.GetAllocatedDevices(); len(got) > 0 {
+		t.Fatalf("rejected Allocate() left devices %v allocated", got)
+	}
+}
+
+// 设备映射已建立时，Allocate 不等待持有 updateMu 的设备列表刷新
+func TestAllocateNotBlockedByRefresh(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.ensureDeviceMap()
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"0"}}}}
+		_, err := s.Allocate(context.Background(), req)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Allocate() error = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Allocate() blocked while a device list refresh holds updateMu")
+	}
+}
+
+// 启用 CDI 时每个设备ID注入一个完全限定的CDI设备，设备节点按物理GPU去重
+func TestAllocateCDIDevices(t *testing.T) {
+	tests := []struct {
+		name      string
+		cdi       bool
+		prefix    string
+		migPerGPU string
+		ids       []string
+		wantCDI   []string
+		wantNodes []string
+	}{
+		{"cdi disabled", false, "micro.device", "0", []string{"0"}, nil, []string{"/dev/sim_gpu0"}},
+		{"whole GPUs", true, "micro.device", "0", []string{"0", "1"},
+			[]string{"micro.device/nvidia=0", "micro.device/nvidia=1"}, []string{"/dev/sim_gpu0", "/dev/sim_gpu1"}},
+		{"prefix is a full kind", true, "nvidia.com/gpu", "0", []string{"1"},
+			[]string{"nvidia.com/gpu=1"}, []string{"/dev/sim_gpu1"}},
+		{"MIG slices share the GPU node", true, "micro.device", "2", []string{"0-mig0", "0-mig1"},
+			[]string{"micro.device/nvidia=0-mig0", "micro.device/nvidia=0-mig1"}, []string{"/dev/sim_gpu0"}},
+		{"empty prefix falls back to env", true, "", "0", []string{"0"}, nil, []string{"/dev/sim_gpu0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SIM_MIG_PER_GPU", tt.migPerGPU)
+			s, _ := newTestServer(t)
+			s.cdiEnabled, s.cdiPrefix = tt.cdi, tt.prefix
+			req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: tt.ids}}}
+			resp, err := s.Allocate(context.Background(), req)
+			if err != nil {
+				t.Fatalf("Allocate() error = %v", err)
+			}
+			container := resp.ContainerResponses[0]
+			var gotCDI []string
+			for _, d := range container.CDIDevices {
+				gotCDI = append(gotCDI, d.Name)
+			}
+			if !reflect.DeepEqual(gotCDI, tt.wantCDI) {
+				t.Fatalf("CDIDevices = %v, want %v", gotCDI, tt.wantCDI)
+			}
+			var gotNodes []string
+			for _, d := range container.Devices {
+				gotNodes = append(gotNodes, d.HostPath)
+			}
+			if !reflect.DeepEqual(gotNodes, tt.wantNodes) {
+				t.Fatalf("Devices = %v, want %v", gotNodes, tt.wantNodes)
+			}
+		})
+	}
+}
+
+// controlDevice 需要额外挂载控制设备的设备
+type controlDevice struct {
+	device.GPUDevice
+	controls []string
+}
+
+func (d controlDevice) ControlPaths() []string { return d.controls }
+
+// 设备节点与控制设备均以读写方式挂载到相同路径，重复路径只挂载一次
+func TestDeviceSpecs(t *testing.T) {
+	s, sim := newTestServer(t)
+	devices, err := sim.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	controls := []string{"/dev/sim_ctl", "/dev/sim_uvm"}
+	s.setDeviceMap(map[string]device.GPUDevice{
+		"0": controlDevice{devices[0], controls},
+		"1": controlDevice{devices[1], controls},
+		"2": devices[2],
+	})
+
+	tests := []struct {
+		name string
+		ids  []string
+		want []string
+	}{
+		{"device with control nodes", []string{"0"}, []string{"/dev/sim_gpu0", "/dev/sim_ctl", "/dev/sim_uvm"}},
+		{"control nodes mounted once", []string{"0", "1"}, []string{"/dev/sim_gpu0", "/dev/sim_ctl", "/dev/sim_uvm", "/dev/sim_gpu1"}},
+		{"device node only", []string{"2"}, []string{"/dev/sim_gpu2"}},
+		{"unknown device skipped", []string{"missing", "2"}, []string{"/dev/sim_gpu2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, spec := range s.deviceSpecs(tt.ids) {
+				if spec.ContainerPath != spec.HostPath || spec.Permissions != "rw" {
+					t.Fatalf("spec %+v, want %s mounted rw at the same path", spec, spec.HostPath)
+				}
+				got = append(got, spec.HostPath)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("deviceSpecs(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+// rdmaDevice 关联了RDMA网卡的设备
+type rdmaDevice struct {
+	device.GPUDevice
+	nic string
+}
+
+func (d rdmaDevice) RDMADevice() (string, []string) {
+	return d.nic, []string{"/dev/infiniband/uverbs-" + d.nic, "/dev/infiniband/rdma_cm"}
+}
+
+// GPUDirect：网卡设备节点随GPU挂载且只挂载一次，NCCL 只使用关联的网卡
+func TestRDMAAllocation(t *testing.T) {
+	s, sim := newTestServer(t)
+	devices, err := sim.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setDeviceMap(map[string]device.GPUDevice{
+		"0": rdmaDevice{devices[0], "mlx5_0"},
+		"1": rdmaDevice{devices[1], "mlx5_0"},
+		"2": rdmaDevice{devices[2], "mlx5_1"},
+	})
+
+	var paths []string
+	for _, spec := range s.deviceSpecs([]string{"0", "1", "2"}) {
+		paths = append(paths, spec.HostPath)
+	}
+	wantPaths := []string{
+		"/dev/sim_gpu0", "/dev/infiniband/uverbs-mlx5_0", "/dev/infiniband/rdma_cm",
+		"/dev/sim_gpu1", "/dev/sim_gpu2", "/dev/infiniband/uverbs-mlx5_1",
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Fatalf("deviceSpecs() = %v, want %v", paths, wantPaths)
+	}
+
+	wantEnvs := map[string]string{"NCCL_IB_HCA": "mlx5_0,mlx5_1", "NVIDIA_GDRCOPY": "enabled"}
+	if got := s.rdmaEnvs([]string{"0", "1", "2"}); !reflect.DeepEqual(got, wantEnvs) {
+		t.Fatalf("rdmaEnvs() = %v, want %v", got, wantEnvs)
+	}
+	s.setDeviceMap(map[string]device.GPUDevice{"0": devices[0]})
+	if got := s.rdmaEnvs([]string{"0"}); got != nil {
+		t.Fatalf("rdmaEnvs() without RDMA devices = %v, want nil", got)
+	}
+}
+
+// uuidDevice 带有容器运行时标识的设备
+type uuidDevice struct {
+	device.GPUDevice
+	uuid string
+}
+
+func (d uuidDevice) VisibleDeviceID() string { return d.uuid }
+
+// NVIDIA_VISIBLE_DEVICES 使用GPU/MIG UUID，同一UUID的时间片副本只写一次，未提供UUID的设备保留ID
+func TestVisibleDevices(t *testing.T) {
+	s, sim := newTestServer(t)
+	devices, err := sim.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setDeviceMap(map[string]device.GPUDevice{
+		"0":      uuidDevice{devices[0], "GPU-aaa"},
+		"0-mig0": uuidDevice{devices[0], "MIG-111"},
+		"0-mig1": uuidDevice{devices[0], "MIG-222"},
+		"1::0":   uuidDevice{devices[1], "GPU-bbb"},
+		"1::1":   uuidDevice{devices[1], "GPU-bbb"},
+		"2":      devices[2],
+	})
+
+	tests := []struct {
+		name string
+		ids  []string
+		want []string
+	}{
+		{"whole GPU", []string{"0"}, []string{"GPU-aaa"}},
+		{"MIG slices", []string{"0-mig1", "0-mig0"}, []string{"MIG-222", "MIG-111"}},
+		{"time-slice replicas deduplicated", []string{"1::0", "1::1"}, []string{"GPU-bbb"}},
+		{"no UUID", []string{"2"}, []string{"2"}},
+		{"unknown device keeps its ID", []string{"missing"}, []string{"missing"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.visibleDevices(tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("visibleDevices(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+// replicaDevice 带显存配额的时间片副本，limit 为空表示未声明配额
+type replicaDevice struct {
+	device.GPUDevice
+	uuid, limit string
+}
+
+func (d replicaDevice) VisibleDeviceID() string { return d.uuid }
+func (d replicaDevice) Attributes() map[string]string {
+	if d.limit == "" {
+		return nil
+	}
+	return map[string]string{device.AttrMemoryLimit: d.limit}
+}
+
+// 显存配额按 NVIDIA_VISIBLE_DEVICES 的序号输出，同一GPU的副本配额相加，任一副本无配额时不限制
+func TestMemoryLimitEnvs(t *testing.T) {
+	s, sim := newTestServer(t)
+	devices, err := sim.DiscoverGPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setDeviceMap(map[string]device.GPUDevice{
+		"0::0": replicaDevice{devices[0], "GPU-aaa", "10000"},
+		"0::1": replicaDevice{devices[0], "GPU-aaa", "10000"},
+		"1::0": replicaDevice{devices[1], "GPU-bbb", "20000"},
+		"2::0": replicaDevice{devices[2], "GPU-ccc", "5000"},
+		"2":    replicaDevice{devices[2], "GPU-ccc", ""},
+	})
+
+	tests := []struct {
+		name string
+		ids  []string
+		want map[string]string
+	}{
+		{"single replica", []string{"1::0"}, map[string]string{"CUDA_DEVICE_MEMORY_LIMIT_0": "20000m"}},
+		{"replicas on one GPU add up", []string{"0::0", "0::1"}, map[string]string{"CUDA_DEVICE_MEMORY_LIMIT_0": "20000m"}},
+		{"index follows visible devices", []string{"1::0", "0::0"}, map[string]string{
+			"CUDA_DEVICE_MEMORY_LIMIT_0": "20000m",
+			"CUDA_DEVICE_MEMORY_LIMIT_1": "10000m",
+		}},
+		{"unlimited device on the same GPU", []string{"2::0", "2"}, map[string]string{}},
+		{"unknown device", []string{"missing"}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.memoryLimitEnvs(tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("memoryLimitEnvs(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+// 可用设备不足时返回部分结果，必须包含的设备不存在时报错
+func TestGetPreferredAllocationPartial(t *testing.T) {
+	tests := []struct {
+		name      string
+		available []string
+		required  []string
+		size      int32
+		want      []string
+		wantCode  codes.Code
+	}{
+		{"enough devices", []string{"1", "2"}, nil, 1, []string{"1"}, codes.OK},
+		{"allocated device skipped", []string{"0", "1", "2"}, nil, 3, []string{"1", "2"}, codes.OK},
+		{"required device kept", []string{"1", "2"}, []string{"2"}, 2, []string{"2", "1"}, codes.OK},
+		{"vanished device skipped", []string{"9", "1"}, nil, 2, []string{"1"}, codes.OK},
+		{"unknown required device", []string{"1"}, []string{"9"}, 1, nil, codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.ensureDeviceMap()
+			if err := s.allocator.Allocate([]string{"0"}, "pod-a"); err != nil {
+				t.Fatal(err)
+			}
+			req := &pluginapi.PreferredAllocationRequest{ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{{
+				AvailableDeviceIDs:   tt.available,
+				MustIncludeDeviceIDs: tt.required,
+				AllocationSize:       tt.size,
+			}}}
+			resp, err := s.GetPreferredAllocation(context.Background(), req)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("GetPreferredAllocation() code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+			if got := resp.ContainerResponses[0].DeviceIDs; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DeviceIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// numaDevice 位于指定物理GPU和NUMA节点的切片
+type numaDevice struct {
+	id, gpu string
+	numa    int
+}
+
+func (d numaDevice) ID() string                    { return d.id }
+func (d numaDevice) IsHealthy() bool               { return true }
+func (d numaDevice) GetVendor() string             { return "nvidia" }
+func (d numaDevice) GetPath() string               { return "/dev/nvidia" + d.gpu }
+func (d numaDevice) IsMIG() bool                   { return true }
+func (d numaDevice) PhysicalID() string            { return d.gpu }
+func (d numaDevice) Attributes() map[string]string { return nil }
+func (d numaDevice) NUMANode() int                 { return d.numa }
+
+// 偏好分配按物理GPU/NUMA分组：pack 挑选能容纳请求的最小分组，spread 分散到不同GPU
+func TestGetPreferredAllocationTopology(t *testing.T) {
+	devices := []device.GPUDevice{
+		numaDevice{"a0", "0", 0}, numaDevice{"b0", "1", 0}, numaDevice{"c0", "2", 1},
+		numaDevice{"a1", "0", 0}, numaDevice{"c1", "2", 1}, numaDevice{"a2", "0", 0},
+	}
+	available := []string{"a0", "b0", "c0", "a1", "c1", "a2"}
+	tests := []struct {
+		name   string
+		policy allocator.Policy
+		size   int32
+		want   []string
+	}{
+		{"pack into the smallest fitting GPU", allocator.PolicyPack, 2, []string{"c0", "c1"}},
+		{"pack into one GPU", allocator.PolicyPack, 3, []string{"a0", "a1", "a2"}},
+		{"spread across GPUs", allocator.PolicySpread, 3, []string{"a0", "c0", "b0"}},
+		{"first-fit keeps kubelet order", allocator.PolicyFirstFit, 2, []string{"a0", "b0"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sim := newTestServer(t)
+			s.manager = &fixedManager{SimulatorManager: sim, devices: devices}
+			s.allocator.(*allocator.SimpleAllocator).SetPolicy(tt.policy)
+			s.ensureDeviceMap()
+			req := &pluginapi.PreferredAllocationRequest{ContainerRequests: []*pluginapi.ContainerPreferredAllocationRequest{{
+				AvailableDeviceIDs: available,
+				AllocationSize:     tt.size,
+			}}}
+			resp, err := s.GetPreferredAllocation(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resp.ContainerResponses[0].DeviceIDs; !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DeviceIDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	s, _ := newTestServer(t)
+	if got, want := s.topologyGroup(devices[2]), "1/2"; got != want {
+		t.Fatalf("topologyGroup(c0) = %q, want %q", got, want)
+	}
+}
+
+// 开启校验时拒绝已消失或不健康的设备，未开启时直接放行
+func TestPreStartContainer(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate bool
+		ids      []string
+		wantCode codes.Code
+	}{
+		{"validation disabled", false, []string{"missing"}, codes.OK},
+		{"healthy devices", true, []string{"0", "1"}, codes.OK},
+		{"device gone", true, []string{"0", "missing"}, codes.NotFound},
+		{"device unhealthy", true, []string{"2"}, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PRESTART_RESET", strconv.FormatBool(tt.validate))
+			t.Setenv("SIM_UNHEALTHY_IDS", "2")
+			s, _ := newTestServer(t)
+			_, err := s.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{DevicesIDs: tt.ids})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("PreStartContainer() code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+		})
+	}
+}
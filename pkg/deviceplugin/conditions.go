@@ -0,0 +1,100 @@
+package deviceplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+const (
+	reasonDevicesUnhealthy = "DevicesUnhealthy"
+	reasonDevicesHealthy   = "DevicesHealthy"
+)
+
+// nodeConditionType 各厂商使用独立的节点状况，如 NvidiaDegraded，避免多个插件互相覆盖
+func nodeConditionType(vendor string) corev1.NodeConditionType {
+	if vendor == "" {
+		return "Degraded"
+	}
+	return corev1.NodeConditionType(strings.ToUpper(vendor[:1]) + vendor[1:] + "Degraded")
+}
+
+// recordDegraded 记录资源是否存在不健康设备并据此上报节点状况，调用方需持有 updateMu
+func (s *DevicePluginServer) recordDegraded(resource string, unhealthy int) {
+	s.degradedResources[resource] = unhealthy > 0
+	if len(s.degradedResources) < len(s.endpoints) {
+		return
+	}
+	degraded := false
+	for _, d := range s.degradedResources {
+		degraded = degraded || d
+	}
+	s.reportNodeCondition(degraded)
+}
+
+// reportNodeCondition 设备不健康时将节点状况置为True，全部恢复后置为False
+// 状态需保持 NODE_CONDITION_DEBOUNCE 才会上报，避免设备抖动导致状况反复切换；调用方需持有 updateMu
+// patch 由后台协程发布，成功后才记为已上报
+func (s *DevicePluginServer) reportNodeCondition(degraded bool) {
+	if !s.kubernetesEnabled() || s.nodeName == "" {
+		return
+	}
+	now := clock.OrReal(s.clock).Now()
+	if s.conditionPendingSince.IsZero() || degraded != s.conditionPending {
+		s.conditionPending = degraded
+		s.conditionPendingSince = now
+	}
+	status := corev1.ConditionFalse
+	if degraded {
+		status = corev1.ConditionTrue
+	}
+	if status == s.conditionReported || now.Sub(s.conditionPendingSince) < s.conditionDebounce {
+		return
+	}
+
+	condition := corev1.NodeCondition{
+		Type:               nodeConditionType(s.vendor),
+		Status:             status,
+		LastHeartbeatTime:  metav1.NewTime(now),
+		LastTransitionTime: metav1.NewTime(now),
+		Reason:             reasonDevicesHealthy,
+		Message:            fmt.Sprintf("all %s devices are healthy", s.vendor),
+	}
+	if degraded {
+		condition.Reason = reasonDevicesUnhealthy
+		condition.Message = fmt.Sprintf("some %s devices are unhealthy", s.vendor)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{condition},
+		},
+	})
+	if err != nil {
+		klog.Errorf("Failed to encode node condition patch: %v", err)
+		return
+	}
+
+	since := s.conditionPendingSince
+	s.queueNodePatch(nodePatch{
+		key:         "condition",
+		patchType:   types.StrategicMergePatchType,
+		data:        patch,
+		subresource: []string{"status"},
+		onSuccess: func() {
+			s.conditionReported = status
+			klog.InfoS("Updated node condition", "vendor", s.vendor, "node", s.nodeName,
+				"condition", condition.Type, "status", status, "since", since.Format(time.RFC3339))
+		},
+		onError: func(err error) {
+			klog.ErrorS(err, "Failed to update node condition", "vendor", s.vendor, "node", s.nodeName,
+				"condition", condition.Type, "status", status)
+		},
+	})
+}
@@ -0,0 +1,128 @@
+package deviceplugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// nodeCondition 返回节点上插件的状况，尚未上报时为空
+func nodeCondition(t *testing.T, s *DevicePluginServer) corev1.ConditionStatus {
+	t.Helper()
+	node, err := s.kubeClient.CoreV1().Nodes().Get(context.Background(), s.nodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range node.Status.Conditions {
+		if c.Type == nodeConditionType(s.vendor) {
+			return c.Status
+		}
+	}
+	return ""
+}
+
+func TestReportNodeCondition(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.kubeClient = fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+	s.SetClock(fakeClock)
+	s.conditionDebounce = time.Minute
+
+	steps := []struct {
+		name     string
+		step     time.Duration
+		degraded bool
+		want     corev1.ConditionStatus
+	}{
+		{"first degraded report is debounced", 0, true, ""},
+		{"still debouncing", 30 * time.Second, true, ""},
+		{"degraded long enough", 31 * time.Second, true, corev1.ConditionTrue},
+		{"brief recovery is debounced", 10 * time.Second, false, corev1.ConditionTrue},
+		{"flap back resets the timer", 10 * time.Second, true, corev1.ConditionTrue},
+		{"recovery starts", 10 * time.Second, false, corev1.ConditionTrue},
+		{"recovered long enough", time.Minute, false, corev1.ConditionFalse},
+	}
+	for _, step := range steps {
+		fakeClock.Step(step.step)
+		s.reportNodeCondition(step.degraded)
+		s.applyNodePatches(context.Background())
+		if got := nodeCondition(t, s); got != step.want {
+			t.Fatalf("%s: node condition = %q, want %q", step.name, got, step.want)
+		}
+	}
+}
+
+// 未注入时钟时使用系统时间
+func TestReportNodeConditionWithoutClock(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.kubeClient = fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	s.clock = nil
+	s.conditionDebounce = 0
+	s.reportNodeCondition(true)
+	s.applyNodePatches(context.Background())
+	if got := nodeCondition(t, s); got != corev1.ConditionTrue {
+		t.Fatalf("node condition = %q, want %q", got, corev1.ConditionTrue)
+	}
+}
+
+// API Server 响应缓慢时设备列表刷新不等待节点patch，patch完成后才记为已发布
+func TestNodePatchesDoNotBlockRefresh(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.conditionDebounce = 0
+	client := fake.NewSimpleClientset(&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1"}})
+	release := make(chan struct{})
+	client.PrependReactor("patch", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-release
+		return false, nil, nil
+	})
+	s.kubeClient = client
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.runNodePatcher(ctx)
+
+	done := make(chan error, 1)
+	go func() { done <- s.updateDeviceList(discardStream{}, s.resource, allDevices) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("updateDeviceList blocked on node patch")
+	}
+	s.updateMu.Lock()
+	published := s.lastLabelPatch
+	s.updateMu.Unlock()
+	if published != "" {
+		t.Fatalf("labels recorded as published before the patch completed: %s", published)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		node, err := client.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.updateMu.Lock()
+		published = s.lastLabelPatch
+		s.updateMu.Unlock()
+		if node.Labels[s.labelPrefix+"/nvidia.count"] != "" && published != "" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("node labels not published: %v", node.Labels)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
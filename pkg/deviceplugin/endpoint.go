@@ -0,0 +1,376 @@
+package deviceplugin
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// ResourceFilter 判断设备是否属于某个扩展资源
+type ResourceFilter func(d device.GPUDevice) bool
+
+// resourceEndpoint 一个扩展资源对应的gRPC端点，独立注册并维护自己的 ListAndWatch
+// 分配、偏好等其余接口由所属插件统一处理
+type resourceEndpoint struct {
+	*DevicePluginServer
+
+	resource   string
+	socket     string
+	filter     ResourceFilter
+	mu         sync.Mutex // 保护 server，串行化重启与停止
+	server     *grpc.Server
+	health     *health.Server // 标准gRPC健康服务，注册成功前为 NOT_SERVING
+	registered atomic.Bool    // 是否已向kubelet注册
+	// healthChan 仅用于唤醒 ListAndWatch，每次刷新都会上报全部设备，容量为1即可
+	healthChan chan string
+	dirty      atomic.Bool // 有尚未上报的健康变化
+}
+
+// 默认的socket名前缀
+const defaultSocketPrefix = "microui.sock"
+
+// devicePluginPathFromEnv 读取 DEVICE_PLUGIN_PATH，未设置时使用kubelet的默认插件目录，主要用于测试
+func devicePluginPathFromEnv() string {
+	if dir := os.Getenv("DEVICE_PLUGIN_PATH"); dir != "" {
+		return dir
+	}
+	return pluginapi.DevicePluginPath
+}
+
+// kubeletSocket kubelet 的注册socket，与插件socket位于同一目录
+func (s *DevicePluginServer) kubeletSocket() string {
+	return path.Join(s.pluginPath, path.Base(pluginapi.KubeletSocket))
+}
+
+// checkDirWritable 在目录中创建并删除临时文件，确认插件能在其中创建socket
+func checkDirWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".probe-")
+	if err != nil {
+		return fmt.Errorf("device plugin directory %s is not writable, check that the host path is mounted read-write: %v", dir, err)
+	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		klog.Warningf("Failed to remove probe file %s: %v", f.Name(), err)
+	}
+	return nil
+}
+
+// unix socket 路径的最大长度：sun_path 为108字节，需留出结尾的NUL
+const maxSocketPathLen = 107
+
+// socketPrefixFromEnv 读取 SOCKET_PREFIX，同一节点运行多个同厂商实例（如灰度验证）时用于区分socket
+func socketPrefixFromEnv() string {
+	prefix := os.Getenv("SOCKET_PREFIX")
+	if prefix == "" {
+		return defaultSocketPrefix
+	}
+	if strings.Contains(prefix, "/") {
+		klog.Warningf("Invalid SOCKET_PREFIX %q: must not contain '/', using %s", prefix, defaultSocketPrefix)
+		return defaultSocketPrefix
+	}
+	return prefix
+}
+
+// validateSocketPath 检查socket路径是否超出unix socket长度限制，超出时 net.Listen 只会报 invalid argument
+func validateSocketPath(socket string) error {
+	if len(socket) > maxSocketPathLen {
+		return fmt.Errorf("socket path %s is %d bytes, exceeding the unix socket limit of %d bytes; use a shorter SOCKET_PREFIX or resource name",
+			socket, len(socket), maxSocketPathLen)
+	}
+	return nil
+}
+
+// socketFor 返回资源对应的socket路径，插件默认资源沿用原有socket名
+func (s *DevicePluginServer) socketFor(resource string) string {
+	name := s.socketPrefix + "." + s.vendor
+	if resource != s.resource {
+		name += "-" + strings.NewReplacer("/", "-", ".", "-").Replace(resource[strings.Index(resource, "/")+1:])
+	}
+	return path.Join(s.pluginPath, name)
+}
+
+func (s *DevicePluginServer) newEndpoint(resource string, filter ResourceFilter) *resourceEndpoint {
+	return &resourceEndpoint{
+		DevicePluginServer: s,
+		resource:           resource,
+		socket:             s.socketFor(resource),
+		filter:             filter,
+		healthChan:         make(chan string, 1),
+	}
+}
+
+// ListAndWatch 默认刷新间隔
+const defaultListWatchInterval = 10 * time.Second
+
+// listWatchInterval 读取 LISTWATCH_INTERVAL，0或无效时使用默认值
+func listWatchInterval() time.Duration {
+	interval := durationFromEnv("LISTWATCH_INTERVAL", defaultListWatchInterval)
+	if interval <= 0 {
+		return defaultListWatchInterval
+	}
+	return interval
+}
+
+// jitter 在基准间隔上加入±10%的随机偏移，避免大量节点上的插件同时调用nvidia-smi
+func jitter(interval time.Duration) time.Duration {
+	return time.Duration(float64(interval) * (0.9 + 0.2*rand.Float64()))
+}
+
+// ListAndWatch 上报属于该资源的设备
+func (e *resourceEndpoint) ListAndWatch(_ *pluginapi.Empty, stream pluginapi.DevicePlugin_ListAndWatchServer) error {
+	klog.Infof("Starting ListAndWatch for %s", e.resource)
+
+	// 初始设备列表
+	if err := e.refresh(stream); err != nil {
+		return err
+	}
+
+	// 管理器支持推送时设备变化立即上报，定时更新仍保留用于刷新健康状态
+	var updates <-chan []device.GPUDevice
+	if watcher, ok := e.manager.(device.Watcher); ok {
+		ctx, cancel := context.WithCancel(stream.Context())
+		defer cancel()
+		ch, err := watcher.Watch(ctx)
+		if err != nil {
+			klog.Warningf("Failed to watch %s devices, falling back to polling: %v", e.resource, err)
+		} else {
+			updates = ch
+		}
+	}
+
+	// 定时更新和健康检查，每轮重新计算抖动后的间隔
+	timer := time.NewTimer(jitter(e.listWatchInterval))
+	defer timer.Stop()
+
+	// 健康变化在 healthDebounce 窗口内合并为一次刷新，窗口从第一条通知开始计时
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-timer.C:
+			if e.dirty.Load() {
+				klog.V(4).Infof("Flushing pending health changes for %s", e.resource)
+			}
+			klog.V(5).Infof("Periodic device list update for %s", e.resource)
+			if err := e.refresh(stream); err != nil {
+				return err
+			}
+			timer.Reset(jitter(e.listWatchInterval))
+		case _, ok := <-updates:
+			if !ok {
+				updates = nil
+				continue
+			}
+			klog.V(4).Infof("Device change pushed for %s", e.resource)
+			if err := e.refresh(stream); err != nil {
+				return err
+			}
+		case id := <-e.healthChan:
+			klog.Warningf("Device %s health status changed, updating device list", e.deviceName(id))
+			if e.healthDebounce <= 0 {
+				if err := e.refresh(stream); err != nil {
+					return err
+				}
+				continue
+			}
+			if debounce == nil {
+				debounce = time.After(e.healthDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			if err := e.refresh(stream); err != nil {
+				return err
+			}
+		case <-e.stop:
+			klog.Infof("Stopping ListAndWatch for %s", e.resource)
+			return nil
+		case <-stream.Context().Done():
+			klog.Infof("ListAndWatch stream for %s closed by kubelet", e.resource)
+			return nil
+		}
+	}
+}
+
+// notifyHealth 标记有待上报的变化并尝试唤醒 ListAndWatch，从不阻塞
+// 通道已满时说明已有待处理的唤醒，之后的刷新会一并上报本次变化
+func (e *resourceEndpoint) notifyHealth(id string) {
+	e.dirty.Store(true)
+	select {
+	case e.healthChan <- id:
+	default:
+		klog.V(4).Infof("Health update for %s already pending, coalescing %s", e.resource, e.deviceName(id))
+	}
+}
+
+// refresh 上报设备列表并清除待上报标记
+func (e *resourceEndpoint) refresh(stream pluginapi.DevicePlugin_ListAndWatchServer) error {
+	e.dirty.Store(false)
+	return e.updateDeviceList(stream, e.resource, e.filter)
+}
+
+// serve 创建socket并启动gRPC服务，然后向kubelet注册
+func (e *resourceEndpoint) serve() error {
+	// 路径过长时 net.Listen 只会报 invalid argument，先给出明确的错误
+	if err := validateSocketPath(e.socket); err != nil {
+		return err
+	}
+
+	// 清理现有的socket文件
+	if err := syscall.Unlink(e.socket); err != nil && !os.IsNotExist(err) {
+		klog.Errorf("Failed to unlink socket %s: %v", e.socket, err)
+		return fmt.Errorf("failed to unlink socket %s: %v", e.socket, err)
+	}
+
+	// 创建监听
+	lis, err := net.Listen("unix", e.socket)
+	if err != nil {
+		klog.Errorf("Failed to listen on socket %s: %v", e.socket, err)
+		return fmt.Errorf("failed to listen on socket %s (%d bytes): %v", e.socket, len(e.socket), err)
+	}
+
+	// 创建gRPC服务
+	e.server = grpc.NewServer()
+	pluginapi.RegisterDevicePluginServer(e.server, e)
+	e.health = health.NewServer()
+	e.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(e.server, e.health)
+
+	// 启动gRPC服务
+	go func(server *grpc.Server) {
+		klog.Infof("Starting %s device plugin server at: %s", e.resource, e.socket)
+		if err := server.Serve(lis); err != nil {
+			klog.Fatalf("Device plugin server failed: %v", err)
+		}
+	}(e.server)
+
+	// 等待服务器启动
+	connCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := waitForSocket(connCtx, e.socket); err != nil {
+		klog.Errorf("Failed to start gRPC server: %v", err)
+		return fmt.Errorf("failed to start gRPC server: %v", err)
+	}
+
+	// 注册到kubelet，插件可能先于kubelet就绪，失败时退避重试
+	if err := e.registerWithRetry(); err != nil {
+		klog.Errorf("Failed to register with kubelet: %v", err)
+		return fmt.Errorf("failed to register %s with kubelet: %v", e.resource, err)
+	}
+	e.registered.Store(true)
+	e.health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	return nil
+}
+
+func (e *resourceEndpoint) registerWithKubelet() error {
+	klog.Infof("Registering %s with kubelet at %s", e.resource, e.kubeletSocket())
+
+	// 使用 passthrough 解析器，将socket路径原样交给拨号函数
+	conn, err := grpc.NewClient("passthrough:///"+e.kubeletSocket(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to connect to kubelet: %v", err)
+	}
+	defer conn.Close()
+
+	client := pluginapi.NewRegistrationClient(conn)
+	req := &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     path.Base(e.socket),
+		ResourceName: e.resource,
+	}
+
+	// kubelet无响应时不无限阻塞启动
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+	_, err = client.Register(ctx, req)
+	return err
+}
+
+// 单次注册请求的超时时间
+const registerTimeout = 10 * time.Second
+
+// 注册重试的初始退避时间
+const registerInitialBackoff = time.Second
+
+// registerWithRetry 按指数退避重试注册，直到成功、达到最大次数或插件停止
+func (e *resourceEndpoint) registerWithRetry() error {
+	backoff := registerInitialBackoff
+	var err error
+	for attempt := 1; attempt <= e.registerMaxAttempts; attempt++ {
+		if err = e.registerWithKubelet(); err == nil {
+			return nil
+		}
+		if attempt == e.registerMaxAttempts {
+			break
+		}
+		klog.Warningf("Registration attempt %d/%d for %s failed: %v, retrying in %v",
+			attempt, e.registerMaxAttempts, e.resource, err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-e.stop:
+			return fmt.Errorf("plugin stopped while registering: %v", err)
+		}
+		backoff *= 2
+		if backoff > e.registerMaxBackoff {
+			backoff = e.registerMaxBackoff
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %v", e.registerMaxAttempts, err)
+}
+
+// shutdown 停止gRPC服务并删除socket文件，避免快速重启时冲突或kubelet保留失效端点
+func (e *resourceEndpoint) shutdown() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.server != nil {
+		e.server.Stop()
+		e.server = nil
+	}
+	if err := syscall.Unlink(e.socket); err != nil && !os.IsNotExist(err) {
+		klog.Warningf("Failed to remove socket %s: %v", e.socket, err)
+	}
+}
+
+// restart 停止当前gRPC服务并重新启动、注册
+func (e *resourceEndpoint) restart() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// 停止时删除socket也会触发重启，插件已停止则忽略
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+	e.registered.Store(false)
+	if e.server != nil {
+		e.server.Stop()
+	}
+	if err := e.serve(); err != nil {
+		klog.Errorf("Failed to restart %s device plugin: %v", e.resource, err)
+		return
+	}
+	klog.Infof("%s device plugin re-registered at %s", e.resource, e.socket)
+}
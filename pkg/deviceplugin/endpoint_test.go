@@ -0,0 +1,412 @@
+package deviceplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 通过unix socket向kubelet注册，Endpoint 为插件socket相对插件目录的文件名
+func TestRegisterWithKubelet(t *testing.T) {
+	s, _ := newTestServer(t)
+	kubelet := startFakeKubelet(t, s.pluginPath, 0)
+	endpoint := s.newEndpoint("nvidia.com/mig-1g.10gb", allDevices)
+	if err := endpoint.registerWithKubelet(); err != nil {
+		t.Fatalf("registerWithKubelet() error = %v", err)
+	}
+	req := kubelet.waitRegistration(t, time.Second)
+	want := &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     filepath.Base(endpoint.socket),
+		ResourceName: "nvidia.com/mig-1g.10gb",
+	}
+	if req.Version != want.Version || req.Endpoint != want.Endpoint || req.ResourceName != want.ResourceName {
+		t.Fatalf("Register() request = %+v, want %+v", req, want)
+	}
+}
+
+// kubelet 未就绪时按退避重试注册，达到最大次数后放弃
+func TestRegisterWithRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		kubelet     bool
+		failures    int
+		maxAttempts int
+		wantErr     bool
+	}{
+		{"first attempt", true, 0, 3, false},
+		{"kubelet becomes ready", true, 2, 3, false},
+		{"gives up", true, 3, 3, true},
+		{"kubelet not running", false, 0, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.registerMaxAttempts = tt.maxAttempts
+			s.registerMaxBackoff = time.Millisecond
+			var kubelet *fakeKubelet
+			if tt.kubelet {
+				kubelet = startFakeKubelet(t, s.pluginPath, tt.failures)
+			}
+			err := s.newEndpoint(s.resource, allDevices).registerWithRetry()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("registerWithRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if kubelet != nil && kubelet.failures != 0 {
+				t.Fatalf("registerWithRetry() left %d failing attempts unused", kubelet.failures)
+			}
+		})
+	}
+}
+
+// 插件停止时不再等待下一次重试
+func TestRegisterWithRetryStops(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.registerMaxAttempts = 10
+	done := make(chan error, 1)
+	go func() { done <- s.newEndpoint(s.resource, allDevices).registerWithRetry() }()
+	close(s.stop)
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("registerWithRetry() succeeded without a kubelet")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("registerWithRetry() kept retrying after the plugin stopped")
+	}
+}
+
+// 注册完成后插件就绪，各端点的gRPC健康服务返回 SERVING
+func TestReadyAfterRegistration(t *testing.T) {
+	s, _ := newTestServer(t)
+	startFakeKubelet(t, s.pluginPath, 0)
+	if s.Ready() {
+		t.Fatal("Ready() = true before Start")
+	}
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	if !s.Ready() {
+		t.Fatal("Ready() = false after Start registered with kubelet")
+	}
+
+	for _, endpoint := range s.snapshotEndpoints() {
+		conn, err := grpc.NewClient("unix://"+endpoint.socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("%s health check error = %v", endpoint.resource, err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Fatalf("%s health = %v, want SERVING", endpoint.resource, resp.Status)
+		}
+	}
+
+	s.Stop()
+	if s.Ready() {
+		t.Fatal("Ready() = true after Stop")
+	}
+}
+
+// chanStream 将 ListAndWatch 上报的设备健康状态写入通道
+type chanStream struct {
+	pluginapi.DevicePlugin_ListAndWatchServer
+	ctx       context.Context
+	responses chan map[string]string
+}
+
+func newChanStream(ctx context.Context) *chanStream {
+	return &chanStream{ctx: ctx, responses: make(chan map[string]string, 16)}
+}
+
+func (s *chanStream) Context() context.Context { return s.ctx }
+
+func (s *chanStream) Send(resp *pluginapi.ListAndWatchResponse) error {
+	health := make(map[string]string, len(resp.Devices))
+	for _, d := range resp.Devices {
+		health[d.ID] = d.Health
+	}
+	s.responses <- health
+	return nil
+}
+
+// next 等待下一次上报
+func (s *chanStream) next(t *testing.T, timeout time.Duration) map[string]string {
+	t.Helper()
+	select {
+	case health := <-s.responses:
+		return health
+	case <-time.After(timeout):
+		t.Fatal("ListAndWatch did not send a device list")
+		return nil
+	}
+}
+
+// 管理器推送设备变化时立即上报，无需等待定时刷新
+func TestListAndWatchPushedChanges(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.listWatchInterval = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newChanStream(ctx)
+	go s.newEndpoint(s.resource, allDevices).ListAndWatch(&pluginapi.Empty{}, stream)
+
+	if got := stream.next(t, 5*time.Second)["1"]; got != pluginapi.Healthy {
+		t.Fatalf("initial health of device 1 = %q, want %s", got, pluginapi.Healthy)
+	}
+	// 订阅在首次上报之后建立，之前的变化不会推送，重复设置直到收到推送
+	deadline := time.After(5 * time.Second)
+	for {
+		sim.SetHealth("1", false)
+		select {
+		case health := <-stream.responses:
+			if health["1"] != pluginapi.Unhealthy {
+				t.Fatalf("pushed health of device 1 = %q, want %s", health["1"], pluginapi.Unhealthy)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("ListAndWatch did not report the pushed change")
+		}
+	}
+}
+
+func TestListWatchInterval(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultListWatchInterval},
+		{"30s", 30 * time.Second},
+		{"0", defaultListWatchInterval},
+		{"-5s", defaultListWatchInterval},
+		{"often", defaultListWatchInterval},
+	}
+	for _, tt := range tests {
+		t.Setenv("LISTWATCH_INTERVAL", tt.value)
+		if got := listWatchInterval(); got != tt.want {
+			t.Errorf("listWatchInterval() with %q = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+// 抖动后的间隔在基准间隔的±10%以内，且不总是相同
+func TestJitter(t *testing.T) {
+	const interval = 10 * time.Second
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		got := jitter(interval)
+		if got < 9*time.Second || got > 11*time.Second {
+			t.Fatalf("jitter(%v) = %v, want within ±10%%", interval, got)
+		}
+		seen[got] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("jitter(%v) always returned %v", interval, seen)
+	}
+}
+
+// 定时刷新按配置的间隔上报
+func TestListAndWatchPeriodicRefresh(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.listWatchInterval = 50 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := newChanStream(ctx)
+	go s.newEndpoint(s.resource, allDevices).ListAndWatch(&pluginapi.Empty{}, stream)
+	for i := 0; i < 3; i++ {
+		stream.next(t, 2*time.Second)
+	}
+}
+
+// 去抖窗口内的多次健康变化合并为一次刷新，未开启去抖时每次变化都刷新
+func TestListAndWatchHealthDebounce(t *testing.T) {
+	tests := []struct {
+		name     string
+		debounce time.Duration
+		want     int
+	}{
+		{"debounced", 300 * time.Millisecond, 1},
+		{"immediate", 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.listWatchInterval = time.Hour
+			s.healthDebounce = tt.debounce
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream := newChanStream(ctx)
+			endpoint := s.newEndpoint(s.resource, allDevices)
+			go endpoint.ListAndWatch(&pluginapi.Empty{}, stream)
+			stream.next(t, 5*time.Second)
+
+			// 每次通知都等 ListAndWatch 取走后再发下一次，排除通道合并的影响
+			for _, id := range []string{"0", "1", "2"} {
+				endpoint.notifyHealth(id)
+				for len(endpoint.healthChan) > 0 {
+					time.Sleep(time.Millisecond)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+			time.Sleep(tt.debounce + 200*time.Millisecond)
+			if got := len(stream.responses); got != tt.want {
+				t.Fatalf("ListAndWatch sent %d updates, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// 没有 ListAndWatch 消费时，健康通知也不会阻塞，多次变化合并为一次待处理唤醒
+func TestNotifyHealthNeverBlocks(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.listWatchInterval = time.Hour
+	endpoint := s.newEndpoint(s.resource, allDevices)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			endpoint.notifyHealth("0")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifyHealth blocked without a ListAndWatch consumer")
+	}
+	if got := len(endpoint.healthChan); got != 1 {
+		t.Fatalf("healthChan holds %d notifications, want 1", got)
+	}
+	if !endpoint.dirty.Load() {
+		t.Fatal("pending health change not marked dirty")
+	}
+
+	// 刷新上报后清除待上报标记
+	if err := endpoint.refresh(discardStream{}); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if endpoint.dirty.Load() {
+		t.Fatal("dirty flag still set after refresh")
+	}
+}
+
+// Stop 后各资源的 socket 文件被删除，kubelet 不会再看到失效的插件
+func TestStopRemovesSockets(t *testing.T) {
+	s, _ := newTestServer(t)
+	kubelet := startFakeKubelet(t, s.pluginPath, 0)
+	endpoint := s.newEndpoint(s.resource, allDevices)
+	s.endpoints = []*resourceEndpoint{endpoint}
+	if err := endpoint.serve(); err != nil {
+		t.Fatal(err)
+	}
+	kubelet.waitRegistration(t, 5*time.Second)
+	if _, err := os.Stat(endpoint.socket); err != nil {
+		t.Fatalf("socket missing while serving: %v", err)
+	}
+
+	s.Stop()
+	if _, err := os.Stat(endpoint.socket); !os.IsNotExist(err) {
+		t.Fatalf("socket %s still present after Stop: %v", endpoint.socket, err)
+	}
+}
+
+// SOCKET_PREFIX 含 '/' 时回退到默认前缀，非默认资源在socket名中带上资源后缀
+func TestSocketFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		resource string
+		want     string
+	}{
+		{"default resource", "", "nvidia.com/microgpu", "microui.sock.nvidia"},
+		{"MIG resource", "", "nvidia.com/mig-1g.10gb", "microui.sock.nvidia-mig-1g-10gb"},
+		{"custom prefix", "canary.sock", "nvidia.com/mig-1g.10gb", "canary.sock.nvidia-mig-1g-10gb"},
+		{"prefix with slash", "../escape", "nvidia.com/microgpu", "microui.sock.nvidia"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SOCKET_PREFIX", tt.prefix)
+			s, _ := newTestServer(t)
+			if got, want := s.socketFor(tt.resource), filepath.Join(s.pluginPath, tt.want); got != want {
+				t.Fatalf("socketFor(%s) = %q, want %q", tt.resource, got, want)
+			}
+		})
+	}
+}
+
+// socket 路径超出 unix socket 长度限制时 Start 直接报错，不创建任何socket
+func TestStartRejectsLongSocketPath(t *testing.T) {
+	t.Setenv("SOCKET_PREFIX", strings.Repeat("x", maxSocketPathLen))
+	s, _ := newTestServer(t)
+	t.Cleanup(s.Stop)
+
+	err := s.Start(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "unix socket limit") {
+		t.Fatalf("Start() error = %v, want socket length error", err)
+	}
+	entries, err := os.ReadDir(s.pluginPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("plugin directory contains %d entries after a rejected start", len(entries))
+	}
+}
+
+// serve 在监听前检查路径长度，监听失败时错误中带上socket路径
+func TestServeSocketErrors(t *testing.T) {
+	s, _ := newTestServer(t)
+	tests := []struct {
+		name   string
+		socket string
+		want   string
+	}{
+		{"path too long", filepath.Join(s.pluginPath, strings.Repeat("x", maxSocketPathLen)), "unix socket limit"},
+		{"missing directory", filepath.Join(s.pluginPath, "missing", "plugin.sock"), "failed to listen on socket"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := s.newEndpoint(s.resource, allDevices)
+			endpoint.socket = tt.socket
+			err := endpoint.serve()
+			if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), tt.socket) {
+				t.Fatalf("serve() error = %v, want %q naming %s", err, tt.want, tt.socket)
+			}
+		})
+	}
+}
+
+// 插件目录可写时不留下探测文件，无法在其中创建文件时报错
+func TestCheckDirWritable(t *testing.T) {
+	dir := t.TempDir()
+	if err := checkDirWritable(dir); err != nil {
+		t.Fatalf("checkDirWritable(%s) error = %v", dir, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("probe file left behind: %v", entries)
+	}
+
+	// 以普通文件代替目录，root 运行测试时同样无法写入
+	file := filepath.Join(dir, "not-a-dir")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDirWritable(file); err == nil || !strings.Contains(err.Error(), "not writable") {
+		t.Fatalf("checkDirWritable(%s) error = %v, want not writable", file, err)
+	}
+}
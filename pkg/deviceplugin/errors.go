@@ -0,0 +1,35 @@
+package deviceplugin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 分配与启动前校验的错误类型，返回给 kubelet 时映射为对应的 gRPC 状态码
+var (
+	ErrUnknownDevice   = errors.New("unknown device")
+	ErrDeviceUnhealthy = errors.New("device unhealthy")
+	ErrDraining        = errors.New("device plugin is draining")
+)
+
+// grpcError 按错误类型转换为 gRPC 状态错误，未识别的错误使用 Internal
+func grpcError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, ErrUnknownDevice):
+		code = codes.NotFound
+	case errors.Is(err, allocator.ErrDeviceAlreadyAllocated), errors.Is(err, allocator.ErrCapacityExceeded):
+		code = codes.ResourceExhausted
+	case errors.Is(err, ErrDeviceUnhealthy), errors.Is(err, ErrDraining):
+		code = codes.Unavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,37 @@
+package deviceplugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 包装后的错误类型也能映射到对应的 gRPC 状态码，消息保持不变
+func TestGrpcError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{fmt.Errorf("%w requested for nvidia: [9]", ErrUnknownDevice), codes.NotFound},
+		{fmt.Errorf("%w: GPU 0", allocator.ErrDeviceAlreadyAllocated), codes.ResourceExhausted},
+		{fmt.Errorf("allocation failed: %w", allocator.ErrCapacityExceeded), codes.ResourceExhausted},
+		{fmt.Errorf("%w: GPU 2", ErrDeviceUnhealthy), codes.Unavailable},
+		{errors.New("boom"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			err := grpcError(tt.err)
+			st, ok := status.FromError(err)
+			if !ok {
+				t.Fatalf("grpcError(%v) = %v, not a gRPC status", tt.err, err)
+			}
+			if st.Code() != tt.want || st.Message() != tt.err.Error() {
+				t.Fatalf("grpcError(%v) = %v %q, want %v %q", tt.err, st.Code(), st.Message(), tt.want, tt.err.Error())
+			}
+		})
+	}
+}
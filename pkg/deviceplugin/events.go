@@ -0,0 +1,114 @@
+package deviceplugin
+
+import (
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Version 插件版本，构建时通过 -ldflags "-X .../pkg/deviceplugin.Version=vX.Y.Z" 注入
+var Version = "dev"
+
+const (
+	eventComponent = "micro-device-plugin"
+
+	reasonPluginStarted = "DevicePluginStarted"
+	reasonPluginStopped = "DevicePluginStopped"
+
+	reasonAllocationExpired = "DeviceAllocationExpired"
+
+	reasonDeviceUnhealthy = "DeviceUnhealthy"
+	reasonDeviceRecovered = "DeviceRecovered"
+
+	reasonDevicesBelowExpected = "HealthyDevicesBelowExpected"
+	reasonDevicesRestored      = "HealthyDevicesRestored"
+)
+
+// newEventRecorder 创建写入API Server的事件记录器
+// 通过关联器限流，避免插件反复重启时刷屏
+func newEventRecorder(kubeClient kubernetes.Interface) (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcasterWithCorrelatorOptions(record.CorrelatorOptions{
+		BurstSize: 5,
+		QPS:       1. / 60.,
+	})
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{
+		Interface: kubeClient.CoreV1().Events(""),
+	})
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: eventComponent})
+	return broadcaster, recorder
+}
+
+// lifecycleEventsEnabled 生命周期事件需显式开启 LIFECYCLE_EVENTS=true
+func lifecycleEventsEnabled() bool {
+	return os.Getenv("LIFECYCLE_EVENTS") == "true"
+}
+
+// nodeRef 返回当前节点的对象引用，与kubelet一致使用节点名作为UID
+func (s *DevicePluginServer) nodeRef() *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind: "Node",
+		Name: s.nodeName,
+		UID:  types.UID(s.nodeName),
+	}
+}
+
+// emitStartupEvent 启动成功后在节点上记录一条汇总事件
+func (s *DevicePluginServer) emitStartupEvent() {
+	if !s.lifecycleEvents || s.recorder == nil || s.nodeName == "" {
+		return
+	}
+
+	devices, err := s.manager.DiscoverGPUs()
+	if err != nil {
+		klog.Warningf("Failed to discover devices for startup event: %v", err)
+	}
+	migCount := 0
+	for _, d := range devices {
+		if d.IsMIG() {
+			migCount++
+		}
+	}
+
+	s.recorder.Eventf(s.nodeRef(), corev1.EventTypeNormal, reasonPluginStarted,
+		"%s device plugin %s started, discovered %d devices (%d MIG slices), registered resources %s",
+		s.vendor, Version, len(devices), migCount, strings.Join(s.resourceNames(), ","))
+}
+
+// emitHealthEvent 设备健康状态切换时在节点上记录事件，恢复健康记为Normal
+func (s *DevicePluginServer) emitHealthEvent(id string, state string) {
+	if s.recorder == nil || s.nodeName == "" {
+		return
+	}
+	if state == pluginapi.Unhealthy {
+		s.recorder.Eventf(s.nodeRef(), corev1.EventTypeWarning, reasonDeviceUnhealthy,
+			"%s device %s became unhealthy", s.vendor, s.deviceName(id))
+		return
+	}
+	s.recorder.Eventf(s.nodeRef(), corev1.EventTypeNormal, reasonDeviceRecovered,
+		"%s device %s recovered", s.vendor, s.deviceName(id))
+}
+
+// emitNodeEvent 在节点上记录事件，无法访问API Server时忽略
+func (s *DevicePluginServer) emitNodeEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if s.recorder == nil || s.nodeName == "" {
+		return
+	}
+	s.recorder.Eventf(s.nodeRef(), eventType, reason, messageFmt, args...)
+}
+
+// emitShutdownEvent 正常停止时记录事件
+func (s *DevicePluginServer) emitShutdownEvent() {
+	if !s.lifecycleEvents || s.recorder == nil || s.nodeName == "" {
+		return
+	}
+	s.recorder.Eventf(s.nodeRef(), corev1.EventTypeNormal, reasonPluginStopped,
+		"%s device plugin %s stopped, resources %s", s.vendor, Version, strings.Join(s.resourceNames(), ","))
+}
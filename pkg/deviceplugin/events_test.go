@@ -0,0 +1,122 @@
+package deviceplugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+// drainEvents 取出已记录的事件的类型与原因
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			fields := strings.Fields(event)
+			events = append(events, fields[0]+" "+fields[1])
+		default:
+			return events
+		}
+	}
+}
+
+// 健康设备数低于 EXPECTED_DEVICE_COUNT 时只在切换时记录事件，状态不变的刷新不重复记录
+func TestExpectedDeviceCountEvents(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.nodeName = "node-1"
+	recorder := record.NewFakeRecorder(16)
+	s.recorder = recorder
+	s.expectedDevices = 3
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"all healthy", func() {}, nil},
+		{"device unhealthy", func() { sim.SetHealth("1", false) }, []string{
+			"Warning " + reasonDeviceUnhealthy, "Warning " + reasonDevicesBelowExpected,
+		}},
+		{"still below expected", func() {}, nil},
+		{"another refresh", func() {}, nil},
+		{"device recovered", func() { sim.SetHealth("1", true) }, []string{
+			"Normal " + reasonDeviceRecovered, "Normal " + reasonDevicesRestored,
+		}},
+		{"still healthy", func() {}, nil},
+	}
+	for _, step := range steps {
+		step.change()
+		if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+			t.Fatalf("%s: updateDeviceList() error = %v", step.name, err)
+		}
+		if got := drainEvents(recorder); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: events = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+// 未配置期望值或没有节点名时不记录事件
+func TestExpectedDeviceCountEventsDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     string
+		expected int
+	}{
+		{"no expected count", "node-1", 0},
+		{"no node name", "", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.nodeName = tt.node
+			recorder := record.NewFakeRecorder(16)
+			s.recorder = recorder
+			s.expectedDevices = tt.expected
+			s.updateMu.Lock()
+			s.recordHealthyCount(s.resource, 3)
+			s.updateMu.Unlock()
+			if got := drainEvents(recorder); got != nil {
+				t.Fatalf("events = %v, want none", got)
+			}
+		})
+	}
+}
+
+// 只在健康状态切换时记录事件，首次上报时已不健康的设备不记录
+func TestHealthEvents(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.nodeName = "node-1"
+	recorder := record.NewFakeRecorder(16)
+	s.recorder = recorder
+
+	steps := []struct {
+		name   string
+		change func()
+		want   []string
+	}{
+		{"first report", func() { sim.SetHealth("2", false) }, nil},
+		{"device fails", func() { sim.SetHealth("0", false) }, []string{
+			"Warning " + reasonDeviceUnhealthy + " nvidia device " + s.deviceName("0") + " became unhealthy",
+		}},
+		{"both recover", func() { sim.SetHealth("0", true); sim.SetHealth("2", true) }, []string{
+			"Normal " + reasonDeviceRecovered + " nvidia device " + s.deviceName("0") + " recovered",
+			"Normal " + reasonDeviceRecovered + " nvidia device " + s.deviceName("2") + " recovered",
+		}},
+		{"unchanged", func() {}, nil},
+	}
+	for _, step := range steps {
+		step.change()
+		if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+			t.Fatalf("%s: updateDeviceList() error = %v", step.name, err)
+		}
+		var got []string
+		for len(recorder.Events) > 0 {
+			got = append(got, <-recorder.Events)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: events = %q, want %q", step.name, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package deviceplugin
+
+import (
+	"os"
+	"strings"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/metrics"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// expectedDeviceCount 期望的健康设备数，EXPECTED_DEVICE_COUNT_<VENDOR> 优先于 EXPECTED_DEVICE_COUNT，0表示不检查
+func expectedDeviceCount(vendor string) int {
+	key := "EXPECTED_DEVICE_COUNT_" + strings.ToUpper(vendor)
+	if os.Getenv(key) == "" {
+		key = "EXPECTED_DEVICE_COUNT"
+	}
+	return intFromEnv(key, 0)
+}
+
+// recordHealthyCount 记录资源的健康设备数，汇总后与期望值比较，调用方需持有 updateMu
+// 所有资源都上报过一次后才比较，避免启动时只统计到部分资源而误报
+func (s *DevicePluginServer) recordHealthyCount(resource string, healthy int) {
+	s.healthyCount[resource] = healthy
+	total := 0
+	for _, n := range s.healthyCount {
+		total += n
+	}
+	metrics.HealthyDevices.WithLabelValues(s.vendor).Set(float64(total))
+
+	if s.expectedDevices <= 0 || len(s.healthyCount) < len(s.endpoints) {
+		return
+	}
+	below := total < s.expectedDevices
+	if below == s.belowExpected {
+		return
+	}
+	s.belowExpected = below
+	if below {
+		klog.ErrorS(nil, "Healthy devices below expected count", "vendor", s.vendor,
+			"healthy", total, "expected", s.expectedDevices)
+		s.emitNodeEvent(corev1.EventTypeWarning, reasonDevicesBelowExpected,
+			"%s device plugin has %d healthy devices, expected %d", s.vendor, total, s.expectedDevices)
+		return
+	}
+	klog.InfoS("Healthy devices back to expected count", "vendor", s.vendor,
+		"healthy", total, "expected", s.expectedDevices)
+	s.emitNodeEvent(corev1.EventTypeNormal, reasonDevicesRestored,
+		"%s device plugin has %d healthy devices, expected %d", s.vendor, total, s.expectedDevices)
+}
@@ -0,0 +1,55 @@
+package deviceplugin
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+// 厂商专属的 EXPECTED_DEVICE_COUNT_<VENDOR> 优先于通用设置
+func TestExpectedDeviceCount(t *testing.T) {
+	t.Setenv("EXPECTED_DEVICE_COUNT", "8")
+	t.Setenv("EXPECTED_DEVICE_COUNT_HUAWEI", "4")
+	if got := expectedDeviceCount("huawei"); got != 4 {
+		t.Fatalf("expectedDeviceCount(huawei) = %d, want 4", got)
+	}
+	if got := expectedDeviceCount("nvidia"); got != 8 {
+		t.Fatalf("expectedDeviceCount(nvidia) = %d, want 8", got)
+	}
+}
+
+// 所有资源都上报后才比较，只在低于/恢复期望值的切换时记录事件
+func TestRecordHealthyCount(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.vendor = "expected-test"
+	s.nodeName = "node-1"
+	recorder := record.NewFakeRecorder(10)
+	s.recorder = recorder
+	s.expectedDevices = 4
+	s.endpoints = []*resourceEndpoint{
+		s.newEndpoint("nvidia.com/microgpu", allDevices),
+		s.newEndpoint("nvidia.com/mig-1g.10gb", allDevices),
+	}
+
+	steps := []struct {
+		resource    string
+		healthy     int
+		wantEvents  []string
+		wantHealthy float64
+	}{
+		{"nvidia.com/microgpu", 1, nil, 1}, // 只上报了一个资源，不比较
+		{"nvidia.com/mig-1g.10gb", 2, []string{"Warning " + reasonDevicesBelowExpected}, 3},
+		{"nvidia.com/mig-1g.10gb", 1, nil, 2},
+		{"nvidia.com/microgpu", 3, []string{"Normal " + reasonDevicesRestored}, 4},
+	}
+	for i, step := range steps {
+		s.recordHealthyCount(step.resource, step.healthy)
+		if got := drainEvents(recorder); !reflect.DeepEqual(got, step.wantEvents) {
+			t.Fatalf("step %d: events = %v, want %v", i, got, step.wantEvents)
+		}
+		if got := metricValue(t, `micro_device_plugin_healthy_devices{vendor="expected-test"}`); got != step.wantHealthy {
+			t.Fatalf("step %d: healthy_devices = %v, want %v", i, got, step.wantHealthy)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package deviceplugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// DeviceState 调试接口中的单个设备
+type DeviceState struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"` // DEVICE_NAME_MAP 渲染的友好名称，无匹配规则时与ID相同
+	Vendor   string   `json:"vendor"`
+	Resource string   `json:"resource"`
+	MIG      bool     `json:"mig"`
+	Profile  string   `json:"profile,omitempty"`
+	Health   string   `json:"health"`            // 最近一次上报的状态，尚未上报时为空
+	PodUIDs  []string `json:"podUIDs,omitempty"` // 共享该设备的所有 Pod
+}
+
+// Devices 返回已发现设备及其最近上报的健康状态，按ID排序
+func (s *DevicePluginServer) Devices() []DeviceState {
+	s.ensureDeviceMap()
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	deviceMap := s.deviceSnapshot()
+	devices := make([]DeviceState, 0, len(deviceMap))
+	for id, d := range deviceMap {
+		state := DeviceState{
+			ID:       id,
+			Name:     s.namer.Name(id),
+			Vendor:   s.vendor,
+			Resource: s.resourceNameFor(d),
+			MIG:      d.IsMIG(),
+			Health:   s.lastDeviceState[id],
+			PodUIDs:  s.allocator.GetPodUIDs(id),
+		}
+		if profiled, ok := d.(device.ProfiledDevice); ok {
+			state.Profile = profiled.Profile()
+		}
+		devices = append(devices, state)
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices
+}
+
+// Allocations 返回设备ID到共享该设备的 Pod UID 的映射
+func (s *DevicePluginServer) Allocations() map[string][]string {
+	return s.allocator.GetAllocationMap()
+}
+
+// AllocationEntry 分配报告中单个 Pod 对单个设备的分配，Pod 查询不到时命名空间和名称为空
+type AllocationEntry struct {
+	DeviceID    string    `json:"deviceID"`
+	Vendor      string    `json:"vendor"`
+	PodUID      string    `json:"podUID,omitempty"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Health      string    `json:"health"`
+	AllocatedAt time.Time `json:"allocatedAt"`
+}
+
+// 查询不到的Pod在该时间内不再向API Server查询
+const missingPodTTL = time.Minute
+
+// AllocationReport 返回已分配设备及所属Pod的命名空间/名称和健康状态，按设备ID、Pod UID排序
+// 共享设备的每个 Pod 各占一条
+func (s *DevicePluginServer) AllocationReport() []AllocationEntry {
+	allocations := s.allocator.GetAllocationMap()
+
+	s.updateMu.Lock()
+	health := make(map[string]string, len(allocations))
+	for id := range allocations {
+		health[id] = s.lastDeviceState[id]
+	}
+	s.updateMu.Unlock()
+
+	// 设备释放后不再需要记住查询不到的Pod
+	active := make(map[string]bool, len(allocations))
+	for _, holders := range allocations {
+		for _, podUID := range holders {
+			active[podUID] = true
+		}
+	}
+	s.podMu.Lock()
+	for podUID := range s.missingPods {
+		if !active[podUID] {
+			delete(s.missingPods, podUID)
+		}
+	}
+	s.podMu.Unlock()
+
+	entries := make([]AllocationEntry, 0, len(allocations))
+	for id, holders := range allocations {
+		allocatedAt, _ := s.allocator.GetAllocationTime(id)
+		for _, podUID := range holders {
+			entry := AllocationEntry{
+				DeviceID:    id,
+				Vendor:      s.vendor,
+				PodUID:      podUID,
+				Health:      health[id],
+				AllocatedAt: allocatedAt,
+			}
+			if ref, ok := s.podRef(podUID); ok {
+				entry.Namespace, entry.Name = ref.Namespace, ref.Name
+			}
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].DeviceID != entries[j].DeviceID {
+			return entries[i].DeviceID < entries[j].DeviceID
+		}
+		return entries[i].PodUID < entries[j].PodUID
+	})
+	return entries
+}
+
+// podRef 返回Pod的命名空间/名称，优先使用分配时的缓存，
+// 未缓存时查询API Server，查询不到的Pod在 missingPodTTL 内不再查询
+func (s *DevicePluginServer) podRef(podUID string) (types.NamespacedName, bool) {
+	if podUID == "" {
+		return types.NamespacedName{}, false
+	}
+	now := clock.OrReal(s.clock).Now()
+	s.podMu.RLock()
+	ref, cached := s.podRefs[podUID]
+	missingAt, missing := s.missingPods[podUID]
+	s.podMu.RUnlock()
+	if cached {
+		return ref, true
+	}
+	if s.pods == nil || (missing && now.Sub(missingAt) < missingPodTTL) {
+		return types.NamespacedName{}, false
+	}
+
+	// getPodByUID 找到Pod时会写入缓存
+	pod, err := s.getPodByUID(context.Background(), podUID)
+	if err != nil {
+		klog.V(4).Infof("Failed to look up pod %s for allocation report: %v", podUID, err)
+		return types.NamespacedName{}, false
+	}
+	if pod == nil {
+		s.podMu.Lock()
+		s.missingPods[podUID] = now
+		s.podMu.Unlock()
+		return types.NamespacedName{}, false
+	}
+	return types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, true
+}
+
+// AllocationReportHandler 以JSON返回所有插件的分配报告，只读
+func AllocationReportHandler(servers []*DevicePluginServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries := []AllocationEntry{}
+		for _, srv := range servers {
+			entries = append(entries, srv.AllocationReport()...)
+		}
+		writeJSON(w, entries)
+	})
+}
+
+// DevicesHandler 以JSON返回所有插件的设备，只读
+// 查询参数 device 按规范ID或友好名称筛选单个设备
+func DevicesHandler(servers []*DevicePluginServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("device")
+		devices := []DeviceState{}
+		for _, srv := range servers {
+			// Devices 渲染名称后友好名称才能还原为规范ID
+			all := srv.Devices()
+			if query == "" {
+				devices = append(devices, all...)
+				continue
+			}
+			id, _ := srv.namer.CanonicalID(query)
+			for _, d := range all {
+				if d.ID == id {
+					devices = append(devices, d)
+				}
+			}
+		}
+		writeJSON(w, devices)
+	})
+}
+
+// AllocationsHandler 以JSON返回各厂商的设备到Pod映射，只读
+func AllocationsHandler(servers []*DevicePluginServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allocations := make(map[string]map[string][]string, len(servers))
+		for _, srv := range servers {
+			allocations[srv.vendor] = srv.Allocations()
+		}
+		writeJSON(w, allocations)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("Failed to write JSON response: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package deviceplugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestDevicesHandlerNames(t *testing.T) {
+	t.Setenv("DEVICE_NAME_MAP", `^(\d+)-mig(\d+)$=gpu$1-slice$2`)
+	t.Setenv("SIM_DEVICE_COUNT", "2")
+	t.Setenv("SIM_MIG_PER_GPU", "2")
+	s, _ := newTestServer(t)
+	handler := DevicesHandler([]*DevicePluginServer{s})
+
+	tests := []struct {
+		query     string
+		wantIDs   []string
+		wantNames []string
+	}{
+		{"", []string{"0-mig0", "0-mig1", "1-mig0", "1-mig1"}, []string{"gpu0-slice0", "gpu0-slice1", "gpu1-slice0", "gpu1-slice1"}},
+		{"gpu1-slice0", []string{"1-mig0"}, []string{"gpu1-slice0"}},
+		{"0-mig1", []string{"0-mig1"}, []string{"gpu0-slice1"}},
+		{"gpu9-slice0", []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/devices?device="+tt.query, nil))
+			var devices []DeviceState
+			if err := json.Unmarshal(rec.Body.Bytes(), &devices); err != nil {
+				t.Fatal(err)
+			}
+			ids, names := []string{}, []string{}
+			for _, d := range devices {
+				ids, names = append(ids, d.ID), append(names, d.Name)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) || !reflect.DeepEqual(names, tt.wantNames) {
+				t.Fatalf("devices = %v %v, want %v %v", ids, names, tt.wantIDs, tt.wantNames)
+			}
+		})
+	}
+}
+
+// countingPodGetter 记录按 UID 查询的次数，pods 中不存在的 Pod 视为已删除
+type countingPodGetter struct {
+	pods    map[string]*corev1.Pod
+	lookups int
+}
+
+func (g *countingPodGetter) GetPod(context.Context, string, string) (*corev1.Pod, error) {
+	return nil, nil
+}
+
+func (g *countingPodGetter) GetPodByUID(_ context.Context, uid string) (*corev1.Pod, error) {
+	g.lookups++
+	return g.pods[uid], nil
+}
+
+// 查询不到的Pod在 missingPodTTL 内不再查询，找到后改用缓存，设备释放后清除记录
+func TestAllocationReportMissingPodTTL(t *testing.T) {
+	s, _ := newTestServer(t)
+	fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+	s.SetClock(fakeClock)
+	getter := &countingPodGetter{pods: make(map[string]*corev1.Pod)}
+	s.SetPodGetter(getter)
+	if err := s.allocator.Allocate([]string{"0"}, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name        string
+		step        time.Duration
+		create      bool
+		wantName    string
+		wantLookups int
+	}{
+		{"first report looks the pod up", 0, false, "", 1},
+		{"missing pod is not queried again", 30 * time.Second, false, "", 1},
+		{"pod appears within the TTL", 20 * time.Second, true, "", 1},
+		{"TTL expired", 11 * time.Second, false, "pod-u1", 2},
+		{"found pod is cached", time.Minute, false, "pod-u1", 2},
+	}
+	for _, step := range steps {
+		fakeClock.Step(step.step)
+		if step.create {
+			getter.pods["u1"] = testPod("u1", "", corev1.PodRunning)
+		}
+		report := s.AllocationReport()
+		if len(report) != 1 || report[0].Name != step.wantName || getter.lookups != step.wantLookups {
+			t.Fatalf("%s: report = %+v, lookups = %d, want name %q and %d lookups",
+				step.name, report, getter.lookups, step.wantName, step.wantLookups)
+		}
+	}
+
+	// 释放后清除查询不到的记录
+	if err := s.allocator.Allocate([]string{"1"}, "u2"); err != nil {
+		t.Fatal(err)
+	}
+	s.AllocationReport()
+	s.allocator.ReleasePod("u2")
+	s.AllocationReport()
+	s.podMu.RLock()
+	defer s.podMu.RUnlock()
+	if _, ok := s.missingPods["u2"]; ok {
+		t.Fatal("missing pod u2 still remembered after its devices were released")
+	}
+}
+
+// 分配时未记录的 Pod 通过 PodGetter 查询命名空间/名称，健康状态取最近一次上报的结果
+func TestAllocationReportLooksUpPods(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.SetPodGetter(&countingPodGetter{pods: map[string]*corev1.Pod{"u1": testPod("u1", "", corev1.PodRunning)}})
+	sim.SetHealth("1", false)
+	if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.allocator.Allocate([]string{"0", "1"}, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, entry := range s.AllocationReport() {
+		got = append(got, entry.DeviceID+" "+entry.Namespace+"/"+entry.Name+" "+entry.Health)
+	}
+	want := []string{"0 default/pod-u1 Healthy", "1 default/pod-u1 Unhealthy"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("AllocationReport() = %v, want %v", got, want)
+	}
+}
+
+// /allocations 按厂商返回设备到共享该设备的 Pod 列表
+func TestAllocationsHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.allocator.(*allocator.SimpleAllocator).SetMaxPerID(2)
+	for pod, ids := range map[string][]string{"pod-a": {"0", "1"}, "pod-b": {"0"}} {
+		if err := s.allocator.Allocate(ids, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	AllocationsHandler([]*DevicePluginServer{s}).ServeHTTP(rec, httptest.NewRequest("GET", "/allocations", nil))
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+	var got map[string]map[string][]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string][]string{"nvidia": {"0": {"pod-a", "pod-b"}, "1": {"pod-a"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("allocations = %v, want %v", got, want)
+	}
+}
+
+// /allocation-report 每个 (设备, Pod) 一条，带 Pod 名称与设备健康状态，查询不到的 Pod 不带名称
+func TestAllocationReportHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+	fakeClock := clock.NewFakeClock(time.Unix(1000, 0).UTC())
+	s.SetClock(fakeClock)
+	simple := s.allocator.(*allocator.SimpleAllocator)
+	simple.SetClock(fakeClock)
+	simple.SetMaxPerID(2)
+	s.SetPodGetter(&countingPodGetter{})
+	if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+		t.Fatal(err)
+	}
+	s.rememberPod(testPod("u1", "", corev1.PodRunning))
+	for pod, ids := range map[string][]string{"u1": {"1", "0"}, "u2": {"0"}} {
+		if err := s.allocator.Allocate(ids, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	AllocationReportHandler([]*DevicePluginServer{s}).ServeHTTP(rec, httptest.NewRequest("GET", "/allocation-report", nil))
+	var got []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	at := "1970-01-01T00:16:40Z"
+	want := []map[string]interface{}{
+		{"deviceID": "0", "vendor": "nvidia", "podUID": "u1", "namespace": "default", "name": "pod-u1", "health": "Healthy", "allocatedAt": at},
+		{"deviceID": "0", "vendor": "nvidia", "podUID": "u2", "health": "Healthy", "allocatedAt": at},
+		{"deviceID": "1", "vendor": "nvidia", "podUID": "u1", "namespace": "default", "name": "pod-u1", "health": "Healthy", "allocatedAt": at},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("allocation report = %v, want %v", got, want)
+	}
+
+	// 没有分配时返回空数组而不是 null
+	rec = httptest.NewRecorder()
+	AllocationReportHandler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "/allocation-report", nil))
+	if body := rec.Body.String(); body != "[]\n" {
+		t.Fatalf("empty report = %q, want []", body)
+	}
+}
+
+// /devices 返回设备的资源名、MIG profile、健康状态与占用的 Pod
+func TestDevicesHandlerShape(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "1")
+	t.Setenv("SIM_MIG_PER_GPU", "2")
+	s, _ := newTestServer(t)
+	if err := s.updateDeviceList(discardStream{}, "simulator.com/mig-1g.10gb", allDevices); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.allocator.Allocate([]string{"0-mig1"}, "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	DevicesHandler([]*DevicePluginServer{s}).ServeHTTP(rec, httptest.NewRequest("GET", "/devices", nil))
+	var got []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{"id": "0-mig0", "name": "0-mig0", "vendor": "nvidia", "resource": "simulator.com/mig-1g.10gb", "mig": true,
+			"profile": "1g.10gb", "health": "Healthy"},
+		{"id": "0-mig1", "name": "0-mig1", "vendor": "nvidia", "resource": "simulator.com/mig-1g.10gb", "mig": true,
+			"profile": "1g.10gb", "health": "Healthy", "podUIDs": []interface{}{"u1"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("devices = %v, want %v", got, want)
+	}
+}
+
+// 调试接口汇总所有厂商的插件，查询不改变分配状态
+func TestInspectHandlersMultipleVendors(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "1")
+	nvidia, _ := newTestServer(t)
+	huawei := New("huawei", device.NewSimulatorManager(), false, "", "")
+	if err := huawei.allocator.Allocate([]string{"0"}, "pod-a"); err != nil {
+		t.Fatal(err)
+	}
+	servers := []*DevicePluginServer{nvidia, huawei}
+
+	rec := httptest.NewRecorder()
+	DevicesHandler(servers).ServeHTTP(rec, httptest.NewRequest("GET", "/devices", nil))
+	var devices []DeviceState
+	if err := json.Unmarshal(rec.Body.Bytes(), &devices); err != nil {
+		t.Fatal(err)
+	}
+	var vendors []string
+	for _, d := range devices {
+		vendors = append(vendors, d.Vendor+"/"+d.ID)
+	}
+	if want := []string{"nvidia/0", "huawei/0"}; !reflect.DeepEqual(vendors, want) {
+		t.Fatalf("devices = %v, want %v", vendors, want)
+	}
+
+	rec = httptest.NewRecorder()
+	AllocationsHandler(servers).ServeHTTP(rec, httptest.NewRequest("GET", "/allocations", nil))
+	var allocations map[string]map[string][]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &allocations); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string][]string{"nvidia": {}, "huawei": {"0": {"pod-a"}}}
+	if !reflect.DeepEqual(allocations, want) {
+		t.Fatalf("allocations = %v, want %v", allocations, want)
+	}
+	if got := nvidia.allocator.GetAllocatedDevices(); len(got) > 0 {
+		t.Fatalf("inspecting allocated devices %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package deviceplugin
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newKubeClient 创建 Kubernetes 客户端
+// 设置 KUBECONFIG 时使用该文件（集群外运行），否则使用集群内配置
+func newKubeClient() (kubernetes.Interface, error) {
+	var config *rest.Config
+	var err error
+	if path := os.Getenv("KUBECONFIG"); path != "" {
+		config, err = clientcmd.BuildConfigFromFlags("", path)
+	} else {
+		config, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	return client, nil
+}
+
+// kubernetesEnabled 是否可访问API Server，不可访问时关闭节点事件、标签等依赖集群的功能
+func (s *DevicePluginServer) kubernetesEnabled() bool {
+	return s.kubeClient != nil
+}
@@ -0,0 +1,56 @@
+package deviceplugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: test
+`
+
+// 集群外运行且未设置 KUBECONFIG 时关闭依赖集群的功能，设置后使用该文件
+func TestKubernetesEnabled(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(kubeconfig, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		kubeconfig string
+		want       bool
+	}{
+		{"no cluster config", "", false},
+		{"kubeconfig", kubeconfig, true},
+		{"missing kubeconfig", filepath.Join(t.TempDir(), "missing"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			t.Setenv("KUBECONFIG", tt.kubeconfig)
+			s = New("nvidia", s.manager, false, "", "node-1")
+			t.Cleanup(s.Stop)
+			if got := s.kubernetesEnabled(); got != tt.want {
+				t.Fatalf("kubernetesEnabled() = %v, want %v", got, tt.want)
+			}
+			if got := s.recorder != nil; got != tt.want {
+				t.Fatalf("event recorder created = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package deviceplugin
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// 节点标签默认前缀
+const defaultNodeLabelPrefix = "micro-device-plugin"
+
+// 单次节点patch的超时时间
+const nodePatchTimeout = 10 * time.Second
+
+// nodeLabelPrefix 读取 NODE_LABEL_PREFIX，非法时使用默认前缀
+func nodeLabelPrefix() string {
+	prefix := os.Getenv("NODE_LABEL_PREFIX")
+	if prefix == "" {
+		return defaultNodeLabelPrefix
+	}
+	if errs := validation.IsDNS1123Subdomain(prefix); len(errs) > 0 {
+		klog.Warningf("Invalid NODE_LABEL_PREFIX %q: %s, using %s", prefix, strings.Join(errs, "; "), defaultNodeLabelPrefix)
+		return defaultNodeLabelPrefix
+	}
+	return prefix
+}
+
+// nodeInventory 根据发现结果生成节点标签和注解
+// 标签值不允许逗号，MIG profile 列表以注解发布
+func (s *DevicePluginServer) nodeInventory(devices []device.GPUDevice) (map[string]string, map[string]string) {
+	profiles := make(map[string]bool)
+	migCount := 0
+	for _, d := range devices {
+		if !d.IsMIG() {
+			continue
+		}
+		migCount++
+		if profiled, ok := d.(device.ProfiledDevice); ok && profiled.Profile() != "" {
+			profiles[profiled.Profile()] = true
+		}
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	labels := map[string]string{
+		s.labelPrefix + "/" + s.vendor + ".count":     strconv.Itoa(len(devices)),
+		s.labelPrefix + "/" + s.vendor + ".mig.count": strconv.Itoa(migCount),
+	}
+	annotations := map[string]string{
+		s.labelPrefix + "/" + s.vendor + ".mig.profiles": strings.Join(names, ","),
+	}
+	return labels, annotations
+}
+
+// publishNodeLabels 每轮发现后将设备清单交给后台协程发布到节点，内容未变化时不重复patch
+func (s *DevicePluginServer) publishNodeLabels(devices []device.GPUDevice) {
+	if !s.kubernetesEnabled() || s.nodeName == "" {
+		return
+	}
+	labels, annotations := s.nodeInventory(devices)
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		klog.Errorf("Failed to encode node label patch: %v", err)
+		return
+	}
+	if string(patch) == s.lastLabelPatch {
+		return
+	}
+
+	s.queueNodePatch(nodePatch{
+		key:       "labels",
+		patchType: types.MergePatchType,
+		data:      patch,
+		onSuccess: func() {
+			s.lastLabelPatch = string(patch)
+			klog.InfoS("Published device inventory to node", "vendor", s.vendor, "node", s.nodeName, "labels", labels)
+		},
+		onError: func(err error) {
+			klog.ErrorS(err, "Failed to publish node labels", "vendor", s.vendor, "node", s.nodeName)
+		},
+	})
+}
@@ -0,0 +1,28 @@
+package deviceplugin
+
+import (
+	"os"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// 驱动库在容器内的挂载位置
+const driverLibContainerPath = "/usr/local/nvidia/lib64"
+
+// driverMounts 未使用NVIDIA运行时的容器需要挂载驱动库和nvidia-smi
+// 仅在 NVIDIA_MOUNT_DRIVER=true 时对NVIDIA设备生效，与 nvidia-smi 执行时使用的路径一致
+func driverMounts(vendor string) []*pluginapi.Mount {
+	if vendor != "nvidia" || os.Getenv("NVIDIA_MOUNT_DRIVER") != "true" {
+		return nil
+	}
+
+	libPath := os.Getenv("NVIDIA_DRIVER_LIB_PATH")
+	if libPath == "" {
+		libPath = "/host-lib"
+	}
+	return []*pluginapi.Mount{
+		{HostPath: libPath, ContainerPath: driverLibContainerPath, ReadOnly: true},
+		{HostPath: device.NvidiaSmiPath(), ContainerPath: "/usr/bin/nvidia-smi", ReadOnly: true},
+	}
+}
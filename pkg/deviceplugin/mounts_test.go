@@ -0,0 +1,39 @@
+package deviceplugin
+
+import (
+	"reflect"
+	"testing"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestDriverMounts(t *testing.T) {
+	tests := []struct {
+		name    string
+		vendor  string
+		enabled string
+		libPath string
+		want    []*pluginapi.Mount
+	}{
+		{"disabled by default", "nvidia", "", "", nil},
+		{"default library path", "nvidia", "true", "", []*pluginapi.Mount{
+			{HostPath: "/host-lib", ContainerPath: driverLibContainerPath, ReadOnly: true},
+			{HostPath: "/opt/nvidia/nvidia-smi", ContainerPath: "/usr/bin/nvidia-smi", ReadOnly: true},
+		}},
+		{"custom library path", "nvidia", "true", "/usr/lib64/nvidia", []*pluginapi.Mount{
+			{HostPath: "/usr/lib64/nvidia", ContainerPath: driverLibContainerPath, ReadOnly: true},
+			{HostPath: "/opt/nvidia/nvidia-smi", ContainerPath: "/usr/bin/nvidia-smi", ReadOnly: true},
+		}},
+		{"other vendors", "huawei", "true", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NVIDIA_MOUNT_DRIVER", tt.enabled)
+			t.Setenv("NVIDIA_DRIVER_LIB_PATH", tt.libPath)
+			t.Setenv("NVIDIA_SMI_PATH", "/opt/nvidia/nvidia-smi")
+			if got := driverMounts(tt.vendor); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("driverMounts(%q) = %v, want %v", tt.vendor, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package deviceplugin
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// nodePatch 一次待发布的节点patch，同一 key 只保留最新的一次
+type nodePatch struct {
+	key         string
+	patchType   types.PatchType
+	data        []byte
+	subresource []string
+	onSuccess   func() // patch成功后在 updateMu 下执行，记录已发布的内容
+	onError     func(err error)
+}
+
+// queueNodePatch 将patch交给后台协程发布，不阻塞调用方
+// 刷新设备列表时持有 updateMu，API Server 的延迟不能拖慢 ListAndWatch 与 Allocate
+func (s *DevicePluginServer) queueNodePatch(p nodePatch) {
+	s.patchMu.Lock()
+	s.pendingPatches[p.key] = p
+	s.patchMu.Unlock()
+	select {
+	case s.patchReady <- struct{}{}:
+	default:
+	}
+}
+
+// runNodePatcher 持续发布排队的节点patch，直到 ctx 取消
+func (s *DevicePluginServer) runNodePatcher(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.patchReady:
+			s.applyNodePatches(ctx)
+		}
+	}
+}
+
+// applyNodePatches 发布当前排队的全部patch，失败的patch由下一轮刷新重新排队
+func (s *DevicePluginServer) applyNodePatches(ctx context.Context) {
+	s.patchMu.Lock()
+	pending := s.pendingPatches
+	s.pendingPatches = make(map[string]nodePatch)
+	s.patchMu.Unlock()
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		p := pending[key]
+		patchCtx, cancel := context.WithTimeout(ctx, nodePatchTimeout)
+		_, err := s.kubeClient.CoreV1().Nodes().Patch(patchCtx, s.nodeName, p.patchType, p.data,
+			metav1.PatchOptions{}, p.subresource...)
+		cancel()
+		if err != nil {
+			if p.onError != nil {
+				p.onError(err)
+			} else {
+				klog.ErrorS(err, "Failed to patch node", "vendor", s.vendor, "node", s.nodeName, "patch", key)
+			}
+			continue
+		}
+		if p.onSuccess != nil {
+			s.updateMu.Lock()
+			p.onSuccess()
+			s.updateMu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package deviceplugin
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodGetter 插件查询Pod所需的最小接口，便于替换为不依赖API Server的实现
+// Pod 不存在时两个方法均返回 nil 且不报错
+type PodGetter interface {
+	GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error)
+	GetPodByUID(ctx context.Context, uid string) (*corev1.Pod, error)
+}
+
+// clientPodGetter 基于 clientset 的 PodGetter，按 UID 查询时只列出本节点的 Pod
+type clientPodGetter struct {
+	client   kubernetes.Interface
+	nodeName string
+}
+
+// NewPodGetter 基于 Kubernetes 客户端创建 PodGetter，nodeName 为空时按 UID 查询会列出所有 Pod
+func NewPodGetter(client kubernetes.Interface, nodeName string) PodGetter {
+	return &clientPodGetter{client: client, nodeName: nodeName}
+}
+
+func (g *clientPodGetter) GetPod(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+	pod, err := g.client.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+func (g *clientPodGetter) GetPodByUID(ctx context.Context, uid string) (*corev1.Pod, error) {
+	listOptions := metav1.ListOptions{}
+	if g.nodeName != "" {
+		listOptions.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", g.nodeName).String()
+	}
+	pods, err := g.client.CoreV1().Pods(metav1.NamespaceAll).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		if string(pods.Items[i].UID) == uid {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// SetPodGetter 替换查询Pod的实现，需在 Start 之前调用；传入 nil 关闭Pod查询和资源回收
+func (s *DevicePluginServer) SetPodGetter(pods PodGetter) {
+	s.pods = pods
+}
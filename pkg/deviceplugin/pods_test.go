@@ -0,0 +1,192 @@
+package deviceplugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func testPod(uid, node string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod-" + uid, Namespace: "default", UID: types.UID(uid)},
+		Spec:       corev1.PodSpec{NodeName: node},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestIsPodActive(t *testing.T) {
+	deleting := testPod("deleting", "node-1", corev1.PodRunning)
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Unix(0, 0)}
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.SetPodGetter(NewPodGetter(fake.NewSimpleClientset(
+		testPod("running", "node-1", corev1.PodRunning),
+		testPod("pending", "node-1", corev1.PodPending),
+		testPod("succeeded", "node-1", corev1.PodSucceeded),
+		testPod("failed", "node-1", corev1.PodFailed),
+		testPod("other-node", "node-2", corev1.PodRunning),
+		deleting,
+	), s.nodeName))
+
+	tests := []struct {
+		uid  string
+		want bool
+	}{
+		{"running", true},
+		{"pending", true},
+		{"succeeded", false},
+		{"failed", false},
+		{"other-node", false},
+		{"deleting", false},
+		{"missing", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uid, func(t *testing.T) {
+			// 第二次查询走 UID 缓存
+			for i := 0; i < 2; i++ {
+				if got := s.isPodActive(context.Background(), tt.uid); got != tt.want {
+					t.Fatalf("isPodActive(%q) = %v, want %v", tt.uid, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// 共享设备的某个 Pod 结束后，回收器只释放该 Pod 的分配，重复回收不影响仍在运行的 Pod
+func TestRecycleSharedDevice(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.SetPodGetter(NewPodGetter(fake.NewSimpleClientset(
+		testPod("running", "node-1", corev1.PodRunning),
+		testPod("done", "node-1", corev1.PodSucceeded),
+	), s.nodeName))
+	simple := s.allocator.(*allocator.SimpleAllocator)
+	simple.SetMaxPerID(2)
+	for _, pod := range []string{"running", "done"} {
+		if err := s.allocator.Allocate([]string{"0"}, pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		s.recycle(context.Background())
+		if got := s.allocator.GetPodUIDs("0"); !reflect.DeepEqual(got, []string{"running"}) {
+			t.Fatalf("tick %d: GetPodUIDs(0) = %v, want [running]", i, got)
+		}
+	}
+	// 仍在运行的 Pod 持有一份，只剩一个空位
+	if err := s.allocator.Allocate([]string{"0", "0"}, "new"); err == nil {
+		t.Fatal("Allocate() over-committed a shared device after recycling")
+	}
+}
+
+// 分配记录指向其他节点上运行的 Pod 时（UID 冲突或过期记录），回收器释放该设备
+func TestRecyclePodOnOtherNode(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.nodeName = "node-1"
+	s.SetPodGetter(NewPodGetter(fake.NewSimpleClientset(
+		testPod("local", "node-1", corev1.PodRunning),
+		testPod("remote", "node-2", corev1.PodRunning),
+	), s.nodeName))
+	if err := s.allocator.Allocate([]string{"0"}, "local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.allocator.Allocate([]string{"1"}, "remote"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.recycle(context.Background())
+	want := map[string][]string{"0": {"local"}}
+	if got := s.allocator.GetAllocationMap(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("allocations after recycle = %v, want %v", got, want)
+	}
+}
+
+// 活动 Pod 占用超过 MAX_ALLOCATION_AGE 时只告警一次，开启 FORCE_RELEASE_EXPIRED 后才释放
+func TestRecycleExpiredAllocation(t *testing.T) {
+	tests := []struct {
+		name        string
+		force       bool
+		wantRelease bool
+	}{
+		{"warn only", false, false},
+		{"force release", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			s.nodeName = "node-1"
+			s.SetPodGetter(NewPodGetter(fake.NewSimpleClientset(testPod("running", "node-1", corev1.PodRunning)), s.nodeName))
+			fakeClock := clock.NewFakeClock(time.Unix(0, 0))
+			s.SetClock(fakeClock)
+			s.allocator.(*allocator.SimpleAllocator).SetClock(fakeClock)
+			recorder := record.NewFakeRecorder(10)
+			s.recorder = recorder
+			s.maxAllocationAge = time.Hour
+			s.forceReleaseExpired = tt.force
+			if err := s.allocator.Allocate([]string{"0"}, "running"); err != nil {
+				t.Fatal(err)
+			}
+
+			fakeClock.Step(30 * time.Minute)
+			s.recycle(context.Background())
+			if len(recorder.Events) != 0 {
+				t.Fatalf("event recorded before the allocation expired: %s", <-recorder.Events)
+			}
+			fakeClock.Step(31 * time.Minute)
+			for i := 0; i < 2; i++ {
+				s.recycle(context.Background())
+			}
+			if got := len(recorder.Events); got != 1 {
+				t.Fatalf("recorded %d expiry events, want 1", got)
+			}
+			if released := s.allocator.IsAvailable("0"); released != tt.wantRelease {
+				t.Fatalf("device released = %v, want %v", released, tt.wantRelease)
+			}
+		})
+	}
+}
+
+// 基于 clientset 的 PodGetter：不存在的 Pod 返回 nil 且不报错
+func TestClientPodGetter(t *testing.T) {
+	getter := NewPodGetter(fake.NewSimpleClientset(
+		testPod("local", "node-1", corev1.PodRunning),
+		testPod("remote", "node-2", corev1.PodRunning),
+	), "node-1")
+	ctx := context.Background()
+
+	pod, err := getter.GetPod(ctx, "default", "pod-local")
+	if err != nil || pod == nil || pod.UID != "local" {
+		t.Fatalf("GetPod(pod-local) = %v, %v", pod, err)
+	}
+	if pod, err := getter.GetPod(ctx, "default", "pod-missing"); pod != nil || err != nil {
+		t.Fatalf("GetPod(pod-missing) = %v, %v, want nil, nil", pod, err)
+	}
+
+	tests := []struct {
+		uid   string
+		found bool
+	}{
+		{"local", true},
+		{"missing", false},
+	}
+	for _, tt := range tests {
+		pod, err := getter.GetPodByUID(ctx, tt.uid)
+		if err != nil {
+			t.Fatalf("GetPodByUID(%q) error = %v", tt.uid, err)
+		}
+		if got := pod != nil; got != tt.found {
+			t.Fatalf("GetPodByUID(%q) found = %v, want %v", tt.uid, got, tt.found)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package deviceplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"k8s.io/klog/v2"
+)
+
+// kubelet 设备管理器的检查点文件名，位于插件目录中，记录每个容器分配到的设备
+const kubeletCheckpointFile = "kubelet_internal_checkpoint"
+
+// kubeletCheckpoint kubelet 检查点中插件需要的部分
+type kubeletCheckpoint struct {
+	Data struct {
+		PodDeviceEntries []kubeletPodDevices
+	}
+}
+
+// kubeletPodDevices 单个容器的设备分配记录
+// DeviceIDs 在 1.20 之后按NUMA节点分组（map），更早的版本为列表
+type kubeletPodDevices struct {
+	PodUID        string
+	ContainerName string
+	ResourceName  string
+	DeviceIDs     json.RawMessage
+}
+
+// deviceIDs 兼容两种 DeviceIDs 格式
+func (e kubeletPodDevices) deviceIDs() ([]string, error) {
+	var byNUMA map[string][]string
+	if err := json.Unmarshal(e.DeviceIDs, &byNUMA); err == nil {
+		var ids []string
+		for _, numaIDs := range byNUMA {
+			ids = append(ids, numaIDs...)
+		}
+		return ids, nil
+	}
+	var ids []string
+	if err := json.Unmarshal(e.DeviceIDs, &ids); err != nil {
+		return nil, fmt.Errorf("unrecognized device IDs %s: %v", string(e.DeviceIDs), err)
+	}
+	return ids, nil
+}
+
+// readKubeletCheckpoint 读取 kubelet 检查点，文件不存在时返回空
+func readKubeletCheckpoint(path string) ([]kubeletPodDevices, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubelet checkpoint: %v", err)
+	}
+	var checkpoint kubeletCheckpoint
+	if err := json.Unmarshal(raw, &checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode kubelet checkpoint %s: %v", path, err)
+	}
+	return checkpoint.Data.PodDeviceEntries, nil
+}
+
+// reconcileOnStart 按 kubelet 检查点补全分配状态：插件重启后运行中的Pod仍占用设备，
+// 若分配器中没有记录，资源回收器和后续分配会把这些设备当作空闲。
+// 只恢复本插件资源下仍存在的设备，能查询Pod时跳过已不活跃的Pod
+func (s *DevicePluginServer) reconcileOnStart() {
+	entries, err := readKubeletCheckpoint(filepath.Join(s.pluginPath, kubeletCheckpointFile))
+	if err != nil {
+		klog.Warningf("Skipping allocation reconciliation for %s: %v", s.vendor, err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	devices, err := s.manager.DiscoverGPUs()
+	if err != nil {
+		klog.Warningf("Skipping allocation reconciliation for %s: failed to discover devices: %v", s.vendor, err)
+		return
+	}
+	present := make(map[string]device.GPUDevice, len(devices))
+	for _, d := range devices {
+		present[d.ID()] = d
+	}
+
+	restored := 0
+	for _, entry := range entries {
+		ids, err := entry.deviceIDs()
+		if err != nil {
+			klog.Warningf("Skipping kubelet checkpoint entry for pod %s: %v", entry.PodUID, err)
+			continue
+		}
+		var missing []string
+		for _, id := range ids {
+			// 检查点中还有其他插件的条目，设备ID可能与本插件重名
+			d, ok := present[id]
+			if !ok || !s.ownsResource(entry.ResourceName, d) {
+				continue
+			}
+			if !slices.Contains(s.allocator.GetPodUIDs(id), entry.PodUID) && s.allocator.IsAvailable(id) {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+		if s.pods != nil && !s.isPodActive(context.Background(), entry.PodUID) {
+			continue
+		}
+		if err := s.allocator.Allocate(missing, entry.PodUID); err != nil {
+			klog.Warningf("Failed to restore devices %v of pod %s: %v", missing, entry.PodUID, err)
+			continue
+		}
+		klog.Infof("Restored devices %v of pod %s container %s from kubelet checkpoint",
+			missing, entry.PodUID, entry.ContainerName)
+		restored += len(missing)
+	}
+	if restored > 0 {
+		klog.Infof("Reconciled %d device allocations for %s from kubelet checkpoint", restored, s.vendor)
+	}
+}
+
+// ownsResource 设备是否以该资源名由本插件上报
+func (s *DevicePluginServer) ownsResource(resource string, d device.GPUDevice) bool {
+	if len(s.resources) > 0 {
+		filter, ok := s.resources[resource]
+		return ok && filter(d)
+	}
+	return s.resourceNameFor(d) == resource
+}
@@ -0,0 +1,37 @@
+package deviceplugin
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReconcileOnStart(t *testing.T) {
+	s, _ := newTestServer(t)
+	checkpoint := `{"Data":{"PodDeviceEntries":[
+		{"PodUID":"pod-a","ContainerName":"main","ResourceName":"nvidia.com/microgpu","DeviceIDs":{"0":["0"]}},
+		{"PodUID":"pod-b","ContainerName":"main","ResourceName":"amd.com/microgpu","DeviceIDs":{"0":["1"]}},
+		{"PodUID":"pod-c","ContainerName":"main","ResourceName":"nvidia.com/microgpu","DeviceIDs":["2","missing"]}
+	]}}`
+	if err := os.WriteFile(filepath.Join(s.pluginPath, kubeletCheckpointFile), []byte(checkpoint), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s.reconcileOnStart()
+
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"0", []string{"pod-a"}},
+		{"1", []string{}}, // 其他插件的资源
+		{"2", []string{"pod-c"}},
+		{"missing", []string{}},
+	}
+	for _, tt := range tests {
+		if got := s.allocator.GetPodUIDs(tt.id); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GetPodUIDs(%s) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package deviceplugin
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+// 默认的MIG兜底资源名，profile无法确定的设备归入此资源而不是被丢弃
+const defaultMIGFallbackResource = "nvidia.com/mig-unknown"
+
+// migFallbackResource 读取 MIG_FALLBACK_RESOURCE 配置
+func migFallbackResource() string {
+	if resource := os.Getenv("MIG_FALLBACK_RESOURCE"); resource != "" {
+		return resource
+	}
+	return defaultMIGFallbackResource
+}
+
+// resourceNameFromEnv 读取 RESOURCE_NAME_<VENDOR>，未设置时使用 <vendor>.com/microgpu
+func resourceNameFromEnv(vendor string) string {
+	if resource := os.Getenv("RESOURCE_NAME_" + strings.ToUpper(vendor)); resource != "" {
+		return resource
+	}
+	return vendor + ".com/microgpu"
+}
+
+// validateResourceName 按扩展资源命名规则校验：<DNS子域名>/<名称>，且不能使用 kubernetes.io 域
+func validateResourceName(resource string) error {
+	domain, name, found := strings.Cut(resource, "/")
+	if !found || domain == "" || name == "" {
+		return fmt.Errorf("invalid resource name %q: must be of the form <domain>/<name>", resource)
+	}
+	if errs := validation.IsDNS1123Subdomain(domain); len(errs) > 0 {
+		return fmt.Errorf("invalid resource name %q: domain %s", resource, strings.Join(errs, "; "))
+	}
+	if domain == "kubernetes.io" || strings.HasSuffix(domain, ".kubernetes.io") {
+		return fmt.Errorf("invalid resource name %q: domain kubernetes.io is reserved", resource)
+	}
+	// kubelet 以 requests.<name> 校验配额名称
+	if errs := validation.IsQualifiedName("requests." + resource); len(errs) > 0 {
+		return fmt.Errorf("invalid resource name %q: %s", resource, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// resourceNameFor 返回设备所属的资源名
+// 整卡使用插件资源名，MIG设备按profile划分为 <vendor>.com/mig-<profile>
+func (s *DevicePluginServer) resourceNameFor(d device.GPUDevice) string {
+	if !d.IsMIG() {
+		return s.resource
+	}
+	profile := ""
+	if p, ok := d.(device.ProfiledDevice); ok {
+		profile = p.Profile()
+	}
+	if profile == "" {
+		klog.V(4).Infof("MIG profile of device %s can't be determined, using fallback resource %s",
+			s.deviceName(d.ID()), s.migFallbackResource)
+		return s.migFallbackResource
+	}
+	return d.GetVendor() + ".com/mig-" + profile
+}
+
+// discoverResources 按当前发现的设备划分资源，默认资源名始终注册
+// 启动后新出现的MIG profile需重启插件才会注册
+func (s *DevicePluginServer) discoverResources() map[string]ResourceFilter {
+	resources := map[string]ResourceFilter{s.resource: s.resourceFilter(s.resource)}
+	devices, err := s.manager.DiscoverGPUs()
+	if err != nil {
+		klog.Warningf("Failed to discover devices for resource names, only registering %s: %v", s.resource, err)
+		return resources
+	}
+	for _, d := range devices {
+		resource := s.resourceNameFor(d)
+		if resource == s.migFallbackResource {
+			klog.Warningf("MIG profile of device %s can't be determined, using fallback resource %s",
+				s.deviceName(d.ID()), s.migFallbackResource)
+		}
+		if _, ok := resources[resource]; !ok {
+			resources[resource] = s.resourceFilter(resource)
+		}
+	}
+	return resources
+}
+
+// resourceFilter 返回按 resourceNameFor 匹配资源的过滤器
+func (s *DevicePluginServer) resourceFilter(resource string) ResourceFilter {
+	return func(d device.GPUDevice) bool {
+		return s.resourceNameFor(d) == resource
+	}
+}
+
+// snapshotEndpoints 返回端点列表的副本，Start 追加端点时可安全遍历
+func (s *DevicePluginServer) snapshotEndpoints() []*resourceEndpoint {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	return append([]*resourceEndpoint(nil), s.endpoints...)
+}
+
+// resourceNames 返回已注册的资源名
+func (s *DevicePluginServer) resourceNames() []string {
+	endpoints := s.snapshotEndpoints()
+	names := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		names = append(names, endpoint.resource)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// endpointsFor 返回设备所属资源的端点，设备未知时通知所有端点
+func (s *DevicePluginServer) endpointsFor(id string) []*resourceEndpoint {
+	all := s.snapshotEndpoints()
+	d, ok := s.lookupDevice(id)
+	if !ok {
+		return all
+	}
+	var endpoints []*resourceEndpoint
+	for _, endpoint := range all {
+		if endpoint.filter(d) {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
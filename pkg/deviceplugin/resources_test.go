@@ -0,0 +1,148 @@
+package deviceplugin
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestValidateResourceName(t *testing.T) {
+	tests := []struct {
+		resource string
+		wantErr  bool
+	}{
+		{"nvidia.com/microgpu", false},
+		{"example.com/mig-1g.10gb", false},
+		{"microgpu", true},
+		{"/microgpu", true},
+		{"nvidia.com/", true},
+		{"Nvidia_Com/gpu", true},
+		{"kubernetes.io/gpu", true},
+		{"devices.kubernetes.io/gpu", true},
+		{"nvidia.com/gpu/extra", true},
+		{"nvidia.com/-gpu", true},
+	}
+	for _, tt := range tests {
+		if err := validateResourceName(tt.resource); (err != nil) != tt.wantErr {
+			t.Errorf("validateResourceName(%q) error = %v, wantErr %v", tt.resource, err, tt.wantErr)
+		}
+	}
+}
+
+// migDevice 指定 profile 的设备，profile 为空表示无法解析
+type migDevice struct {
+	id, profile string
+	mig         bool
+}
+
+func (d migDevice) ID() string                    { return d.id }
+func (d migDevice) IsHealthy() bool               { return true }
+func (d migDevice) GetVendor() string             { return "nvidia" }
+func (d migDevice) GetPath() string               { return "/dev/nvidia0" }
+func (d migDevice) IsMIG() bool                   { return d.mig }
+func (d migDevice) PhysicalID() string            { return "0" }
+func (d migDevice) Attributes() map[string]string { return nil }
+func (d migDevice) Profile() string               { return d.profile }
+
+// fixedManager 总是发现同一组设备
+type fixedManager struct {
+	*device.SimulatorManager
+	devices []device.GPUDevice
+}
+
+func (m *fixedManager) DiscoverGPUs() ([]device.GPUDevice, error) { return m.devices, nil }
+
+// profile 无法解析的 MIG 设备归入 MIG_FALLBACK_RESOURCE，整卡使用插件资源名
+func TestDiscoverResourcesFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		want     []string
+	}{
+		{"default fallback", "", []string{"nvidia.com/microgpu", "nvidia.com/mig-1g.10gb", "nvidia.com/mig-unknown"}},
+		{"configured fallback", "example.com/mig-other", []string{"example.com/mig-other", "nvidia.com/microgpu", "nvidia.com/mig-1g.10gb"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MIG_FALLBACK_RESOURCE", tt.fallback)
+			s, sim := newTestServer(t)
+			devices := []device.GPUDevice{
+				migDevice{id: "whole"},
+				migDevice{id: "known", profile: "1g.10gb", mig: true},
+				migDevice{id: "unknown", mig: true},
+			}
+			s.manager = &fixedManager{SimulatorManager: sim, devices: devices}
+
+			resources := s.discoverResources()
+			var names []string
+			for name := range resources {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Fatalf("discoverResources() = %v, want %v", names, tt.want)
+			}
+			// 每个设备只属于一个资源
+			for _, d := range devices {
+				matched := 0
+				for _, filter := range resources {
+					if filter(d) {
+						matched++
+					}
+				}
+				if matched != 1 {
+					t.Fatalf("device %s matches %d resources, want 1", d.ID(), matched)
+				}
+			}
+		})
+	}
+}
+
+// captureStream 记录 ListAndWatch 最近一次上报的设备ID
+type captureStream struct {
+	pluginapi.DevicePlugin_ListAndWatchServer
+	ids []string
+}
+
+func (s *captureStream) Send(resp *pluginapi.ListAndWatchResponse) error {
+	s.ids = nil
+	for _, d := range resp.Devices {
+		s.ids = append(s.ids, d.ID)
+	}
+	sort.Strings(s.ids)
+	return nil
+}
+
+// 整卡与每种MIG profile各自注册资源，每个端点只上报属于自己的设备
+func TestEndpointsReportOwnResource(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.manager = &fixedManager{SimulatorManager: sim, devices: []device.GPUDevice{
+		migDevice{id: "0"},
+		migDevice{id: "1"},
+		migDevice{id: "2-mig0", profile: "1g.10gb", mig: true},
+		migDevice{id: "2-mig1", profile: "1g.10gb", mig: true},
+		migDevice{id: "3-mig0", profile: "3g.40gb", mig: true},
+	}}
+
+	want := map[string][]string{
+		"nvidia.com/microgpu":    {"0", "1"},
+		"nvidia.com/mig-1g.10gb": {"2-mig0", "2-mig1"},
+		"nvidia.com/mig-3g.40gb": {"3-mig0"},
+	}
+	resources := s.discoverResources()
+	if len(resources) != len(want) {
+		t.Fatalf("discoverResources() registered %d resources, want %d", len(resources), len(want))
+	}
+	for resource, filter := range resources {
+		stream := &captureStream{}
+		if err := s.newEndpoint(resource, filter).refresh(stream); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(stream.ids, want[resource]) {
+			t.Errorf("%s reported %v, want %v", resource, stream.ids, want[resource])
+		}
+	}
+}
@@ -5,56 +5,140 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"github.com/benyuereal/micro-device-plugin/pkg/clock"
+	"github.com/benyuereal/micro-device-plugin/pkg/config"
 	"github.com/benyuereal/micro-device-plugin/pkg/device"
-	"google.golang.org/grpc"
+	"github.com/benyuereal/micro-device-plugin/pkg/metrics"
 
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
 const (
-	socketPrefix  = "microui.sock"
-	kubeletSocket = pluginapi.KubeletSocket
-	restartDelay  = 5 * time.Second
+	restartDelay = 5 * time.Second
+	// Allocate 的默认超时，kubelet 自身的调用超时更长，需在其之前返回明确错误
+	defaultAllocateTimeout = 5 * time.Second
 )
 
 type DevicePluginServer struct {
 	vendor          string
-	resource        string
-	socket          string
+	resource        string // 整卡使用的默认资源名
 	stop            chan struct{}
-	healthChan      chan string
 	allocator       allocator.Allocator
 	manager         device.DeviceManager
-	server          *grpc.Server
-	lastDeviceState map[string]string           // 使用字符串记录健康状态
-	deviceMap       map[string]device.GPUDevice // 设备ID到设备对象的映射
+	lastDeviceState map[string]string // 使用字符串记录健康状态，由 updateMu 保护
+
+	// 设备ID到设备对象的映射，刷新时整体替换，发布后不再修改
+	// Allocate 等gRPC调用与 ListAndWatch 并发读写，需通过 lookupDevice/setDeviceMap 访问
+	deviceMu  sync.RWMutex
+	deviceMap map[string]device.GPUDevice
+
 	cdiEnabled      bool
-	cdiPrefix       string                // 添加CDI前缀配置
-	kubeClient      *kubernetes.Clientset // 新增 Kubernetes 客户端
-	nodeName        string                // 新增节点名称
+	cdiPrefix       string               // 添加CDI前缀配置
+	kubeClient      kubernetes.Interface // 新增 Kubernetes 客户端
+	pods            PodGetter            // 查询Pod，为 nil 时关闭Pod查询和资源回收
+	nodeName        string               // 新增节点名称
+	namer           *device.DeviceNamer  // 设备友好名称，仅用于展示
+	broadcaster     record.EventBroadcaster
+	recorder        record.EventRecorder // 节点事件记录器
+	lifecycleEvents bool                 // 是否记录启动/停止事件
+
+	migFallbackResource string             // profile无法确定的MIG设备使用的资源名
+	mounts              []*pluginapi.Mount // 分配时附加的驱动挂载
+	clock               clock.Clock
+
+	maxAllocationAge    time.Duration        // 设备最长占用时间，0表示不限制
+	forceReleaseExpired bool                 // 超时后是否强制释放
+	expiredWarned       map[string]time.Time // 已告警的设备及其分配时间，避免重复告警
+
+	registerMaxAttempts int           // 注册kubelet的最大尝试次数
+	registerMaxBackoff  time.Duration // 注册重试的退避上限
+	preStartValidate    bool          // 容器启动前校验设备仍存在且健康
+	listWatchInterval   time.Duration // ListAndWatch 定时刷新的基准间隔
+	healthDebounce      time.Duration // 合并该时间窗口内的健康变化通知，0表示立即刷新
+	allocateTimeout     time.Duration // 单次 Allocate 的最长耗时，超时回滚并返回 DeadlineExceeded，0表示不限制
+
+	labelPrefix    string // 节点标签/注解前缀
+	socketPrefix   string // socket名前缀，默认 microui.sock
+	pluginPath     string // 插件目录，kubelet.sock 与插件socket均在其中
+	lastLabelPatch string // 上次成功发布的节点patch，用于跳过无变化的更新
+
+	patchMu        sync.Mutex           // 保护 pendingPatches
+	pendingPatches map[string]nodePatch // 待后台协程发布的节点patch
+	patchReady     chan struct{}        // 有新patch排队时通知后台协程
+
+	resources map[string]ResourceFilter // 资源名到设备过滤器的映射，为空时按发现结果划分
+	endpoints []*resourceEndpoint       // 每个资源独立的gRPC端点
+	updateMu  sync.Mutex                // 串行化各资源的设备列表刷新，并保护健康状态、上报记录与端点列表
+	started   atomic.Bool               // Start 是否成功完成
+	draining  atomic.Bool               // 排空中：设备全部以Unhealthy上报，不再接受新分配
+	stopOnce  sync.Once                 // 保证 Stop 可重复调用
+
+	// 插件生命周期的上下文，由 Start 从根上下文派生，Stop 时取消
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// 每个资源上次上报的设备，用于发现设备消失（如驱动崩溃）
+	advertised map[string]map[string]device.GPUDevice
+	// 发现时查询失败的GPU上的设备，其分配不作为孤儿清理，由 updateMu 保护
+	retainedDevices map[string]device.GPUDevice
+
+	expectedDevices int            // 期望的健康设备总数，0表示不检查
+	healthyCount    map[string]int // 各资源最近一次上报的健康设备数
+	belowExpected   bool           // 健康设备数是否低于期望值，仅在切换时告警
+
+	degradedResources     map[string]bool        // 各资源最近一次上报是否存在不健康设备
+	conditionDebounce     time.Duration          // 节点状况需保持该时长才上报
+	conditionPending      bool                   // 待上报的降级状态
+	conditionPendingSince time.Time              // 待上报状态的开始时间
+	conditionReported     corev1.ConditionStatus // 已上报的节点状况，为空表示尚未上报
+
+	podMu   sync.RWMutex
+	podRefs map[string]types.NamespacedName // 分配时缓存的 Pod UID 到命名空间/名称映射
+	// 分配报告中查询不到的 Pod UID 及查询时间，避免反复查询
+	missingPods map[string]time.Time
 }
 
 func New(vendor string, manager device.DeviceManager, cdiEnabled bool, cdiPrefix string, nodeName string) *DevicePluginServer {
-	// 创建 Kubernetes 客户端
-	config, _ := rest.InClusterConfig()
-	kubeClient, _ := kubernetes.NewForConfig(config)
-	return &DevicePluginServer{
+	return NewWithResources(vendor, manager, cdiEnabled, cdiPrefix, nodeName, nil)
+}
+
+// NewWithConfig 按厂商配置创建插件，cfg 中已合并环境变量
+func NewWithConfig(vendor string, manager device.DeviceManager, cdiEnabled bool, cdiPrefix string, nodeName string,
+	cfg config.VendorConfig) *DevicePluginServer {
+	s := New(vendor, manager, cdiEnabled, cdiPrefix, nodeName)
+	if cfg.ResourceName != "" {
+		s.resource = cfg.ResourceName
+	}
+	return s
+}
+
+// NewWithResources 按资源名到过滤器的映射创建插件，每个资源单独注册
+// resources 为空时在启动时按设备划分：整卡使用默认资源名，MIG设备按profile划分
+func NewWithResources(vendor string, manager device.DeviceManager, cdiEnabled bool, cdiPrefix string, nodeName string,
+	resources map[string]ResourceFilter) *DevicePluginServer {
+	// 创建 Kubernetes 客户端，集群外运行且未设置 KUBECONFIG 时不可用
+	kubeClient, err := newKubeClient()
+	if err != nil {
+		klog.Warningf("Kubernetes API unavailable for %s plugin, disabling pod lookup and resource recycling: %v", vendor, err)
+	}
+	s := &DevicePluginServer{
 		vendor:          vendor,
-		resource:        vendor + ".com/microgpu",
-		socket:          path.Join(pluginapi.DevicePluginPath, socketPrefix+"."+vendor),
+		resource:        resourceNameFromEnv(vendor),
 		stop:            make(chan struct{}),
-		healthChan:      make(chan string, 1),
 		manager:         manager,
 		allocator:       allocator.NewSimpleAllocator(),
 		lastDeviceState: make(map[string]string),
@@ -63,45 +147,115 @@ func New(vendor string, manager device.DeviceManager, cdiEnabled bool, cdiPrefix
 		cdiPrefix:       cdiPrefix,
 		kubeClient:      kubeClient,
 		nodeName:        nodeName,
+		namer:           device.NewDeviceNamerFromEnv(),
+		lifecycleEvents: lifecycleEventsEnabled(),
+
+		migFallbackResource: migFallbackResource(),
+		mounts:              driverMounts(vendor),
+		clock:               clock.RealClock{},
+
+		maxAllocationAge:    durationFromEnv("MAX_ALLOCATION_AGE", 0),
+		forceReleaseExpired: os.Getenv("FORCE_RELEASE_EXPIRED") == "true",
+		expiredWarned:       make(map[string]time.Time),
+		registerMaxAttempts: intFromEnv("REGISTER_MAX_ATTEMPTS", 10),
+		registerMaxBackoff:  durationFromEnv("REGISTER_MAX_BACKOFF", 30*time.Second),
+		preStartValidate:    os.Getenv("PRESTART_RESET") == "true",
+		listWatchInterval:   listWatchInterval(),
+		healthDebounce:      durationFromEnv("HEALTH_DEBOUNCE", 2*time.Second),
+		allocateTimeout:     durationFromEnv("ALLOCATE_TIMEOUT", defaultAllocateTimeout),
+		labelPrefix:         nodeLabelPrefix(),
+		socketPrefix:        socketPrefixFromEnv(),
+		pluginPath:          devicePluginPathFromEnv(),
+		podRefs:             make(map[string]types.NamespacedName),
+		missingPods:         make(map[string]time.Time),
+		resources:           resources,
+		advertised:          make(map[string]map[string]device.GPUDevice),
+		expectedDevices:     expectedDeviceCount(vendor),
+		healthyCount:        make(map[string]int),
+		degradedResources:   make(map[string]bool),
+		conditionDebounce:   durationFromEnv("NODE_CONDITION_DEBOUNCE", time.Minute),
+		pendingPatches:      make(map[string]nodePatch),
+		patchReady:          make(chan struct{}, 1),
+	}
+	// 配置 CHECKPOINT_DIR 后分配状态持久化，插件重启后恢复
+	if dir := os.Getenv("CHECKPOINT_DIR"); dir != "" {
+		if simple, ok := s.allocator.(*allocator.SimpleAllocator); ok {
+			simple.SetCheckpointPath(filepath.Join(dir, vendor+"-allocations.json"))
+		}
 	}
+	// ALLOC_POLICY 决定多个设备/切片在物理GPU间集中还是分散，插件默认 pack
+	policy, err := allocator.ParsePolicy(os.Getenv("ALLOC_POLICY"))
+	if err != nil {
+		klog.Warningf("%v, using %s", err, allocator.PolicyPack)
+		policy = allocator.PolicyPack
+	}
+	if simple, ok := s.allocator.(*allocator.SimpleAllocator); ok {
+		simple.SetPolicy(policy)
+	}
+	// ALLOC_MAX_PER_DEVICE 允许同一设备ID被同时分配的次数，默认独占
+	if simple, ok := s.allocator.(*allocator.SimpleAllocator); ok {
+		simple.SetMaxPerID(intFromEnv("ALLOC_MAX_PER_DEVICE", 1))
+	}
+	if cdiEnabled && cdiPrefix == "" {
+		klog.Warningf("CDI is enabled for %s but CDI prefix is empty, CDI devices will not be injected", vendor)
+	}
+	if s.kubernetesEnabled() {
+		s.pods = NewPodGetter(kubeClient, nodeName)
+		s.broadcaster, s.recorder = newEventRecorder(kubeClient)
+	}
+	return s
 }
 
-// ListAndWatch 实现设备插件服务
-func (s *DevicePluginServer) ListAndWatch(_ *pluginapi.Empty, stream pluginapi.DevicePlugin_ListAndWatchServer) error {
-	klog.Infof("Starting ListAndWatch for %s device plugin", s.vendor)
+// Vendor 插件对应的厂商名
+func (s *DevicePluginServer) Vendor() string {
+	return s.vendor
+}
 
-	// 初始设备列表
-	if err := s.updateDeviceList(stream); err != nil {
-		return err
+// Reload 应用可在线修改的配置，资源名等注册相关的配置需重启生效
+func (s *DevicePluginServer) Reload(cfg config.VendorConfig) {
+	if cfg.ResourceName != "" && cfg.ResourceName != s.resource {
+		klog.Warningf("Resource name for %s changed from %s to %s, restart required to take effect",
+			s.vendor, s.resource, cfg.ResourceName)
 	}
+	if reloader, ok := s.manager.(device.Reloader); ok {
+		reloader.Reload(cfg)
+	}
+	klog.Infof("%s device plugin configuration reloaded", s.vendor)
+}
 
-	// 定时更新和健康检查
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
+// SetClock 替换时间来源，用于测试
+func (s *DevicePluginServer) SetClock(c clock.Clock) {
+	s.clock = c
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			klog.V(5).Infof("Periodic device list update for %s", s.vendor)
-			if err := s.updateDeviceList(stream); err != nil {
-				return err
-			}
-		case id := <-s.healthChan:
-			klog.Warningf("Device %s health status changed, updating device list", id)
-			if err := s.updateDeviceList(stream); err != nil {
-				return err
-			}
-		case <-s.stop:
-			klog.Infof("Stopping ListAndWatch for %s device plugin", s.vendor)
-			return nil
-		}
+// deviceName 返回用于日志展示的设备名称，带上规范ID便于对照
+func (s *DevicePluginServer) deviceName(id string) string {
+	if name := s.namer.Name(id); name != id {
+		return fmt.Sprintf("%s(%s)", name, id)
 	}
+	return id
 }
 
-func (s *DevicePluginServer) updateDeviceList(stream pluginapi.DevicePlugin_ListAndWatchServer) error {
+// updateDeviceList 重新发现设备并上报属于指定资源的设备
+func (s *DevicePluginServer) updateDeviceList(stream pluginapi.DevicePlugin_ListAndWatchServer, resource string, filter ResourceFilter) error {
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+
+	start := time.Now()
 	devices, err := s.manager.DiscoverGPUs()
+	metrics.DiscoveryDuration.WithLabelValues(s.vendor).Observe(time.Since(start).Seconds())
 	if err != nil {
-		klog.Errorf("Failed to discover devices: %v", err)
+		klog.ErrorS(err, "Failed to discover devices", "vendor", s.vendor, "resource", resource)
+		// 已上报过设备时（如驱动崩溃）将其全部标记为不健康，而不是让设备悄然消失
+		if prev := s.advertised[resource]; len(prev) > 0 {
+			deviceList := make([]*pluginapi.Device, 0, len(prev))
+			for id, d := range prev {
+				deviceList = append(deviceList, s.vanishedDevice(id, d))
+			}
+			s.recordHealthyCount(resource, 0)
+			s.recordDegraded(resource, len(prev))
+			return stream.Send(&pluginapi.ListAndWatchResponse{Devices: deviceList})
+		}
 		return fmt.Errorf("failed to discover devices: %v", err)
 	}
 	// 新增：清理已消失设备的分配状态
@@ -109,20 +263,44 @@ func (s *DevicePluginServer) updateDeviceList(stream pluginapi.DevicePlugin_List
 	for _, d := range devices {
 		discoveredIDs[d.ID()] = true
 	}
+	// 查询失败的GPU上的设备只是暂时不可见，保留其分配直到该GPU重新被发现
+	s.retainFailedDevices()
+	for id := range s.retainedDevices {
+		discoveredIDs[id] = true
+	}
 	s.allocator.CleanupOrphanedDevices(discoveredIDs)
+	s.syncCapacity(devices)
+	s.publishNodeLabels(devices)
 
 	// 修复：在更新设备列表时重建deviceMap
 	newDeviceMap := make(map[string]device.GPUDevice)
 	for _, d := range devices {
 		newDeviceMap[d.ID()] = d
 	}
-	s.deviceMap = newDeviceMap
-	klog.Infof("Discovered %d new devices, deviceMap %v", len(newDeviceMap), newDeviceMap)
+	s.setDeviceMap(newDeviceMap)
+	klog.InfoS("Discovered devices", "vendor", s.vendor, "count", len(newDeviceMap))
+
+	// 按资源名统计设备，profile无法确定的MIG设备归入兜底资源
+	resourceCount := make(map[string]int)
+	for _, d := range devices {
+		resourceCount[s.resourceNameFor(d)]++
+	}
+	klog.V(4).Infof("Devices per resource for %s: %v", s.vendor, resourceCount)
+
+	// 只上报属于当前资源的设备
+	var filtered []device.GPUDevice
+	for _, d := range devices {
+		if filter(d) {
+			filtered = append(filtered, d)
+		}
+	}
+	devices = filtered
 
 	deviceList := make([]*pluginapi.Device, len(devices))
 	healthStatusCount := map[string]int{
 		pluginapi.Healthy:   0,
 		pluginapi.Unhealthy: 0}
+	degradedCount := 0
 
 	for i, d := range devices {
 		// 更新设备健康状态
@@ -135,259 +313,769 @@ func (s *DevicePluginServer) updateDeviceList(stream pluginapi.DevicePlugin_List
 
 		// 记录状态变化
 		if prevState, exists := s.lastDeviceState[d.ID()]; exists && prevState != state {
-			klog.Infof("Device %s health changed from %s to %s", d.ID(), prevState, state)
+			klog.InfoS("Device health changed", "vendor", s.vendor, "device_id", d.ID(), "device_name", s.namer.Name(d.ID()),
+				"from", prevState, "to", state)
+			s.emitHealthEvent(d.ID(), state)
 		}
 		s.lastDeviceState[d.ID()] = state
 
+		// 降级设备仍以Healthy上报，避免不必要的驱逐
+		if reporter, ok := d.(device.DegradationReporter); ok && healthy {
+			if degradations := reporter.Degradations(); len(degradations) > 0 {
+				degradedCount++
+				klog.InfoS("Device is degraded but still advertised", "vendor", s.vendor, "device_id", d.ID(),
+					"degradations", degradations, "health", state)
+			}
+		}
+
+		klog.V(4).InfoS("Device attributes", "vendor", s.vendor, "device_id", d.ID(), "attributes", d.Attributes())
+
 		deviceList[i] = &pluginapi.Device{
-			ID:     d.ID(),
-			Health: state,
+			ID:       d.ID(),
+			Health:   state,
+			Topology: deviceTopology(d),
+		}
+		// 排空时不再提供设备，已分配的容器和分配记录不受影响
+		if s.draining.Load() {
+			deviceList[i].Health = pluginapi.Unhealthy
+		}
+	}
+
+	// 上次上报而本次消失的设备先以Unhealthy上报一次，下一轮再移除
+	current := make(map[string]device.GPUDevice, len(devices))
+	for _, d := range devices {
+		current[d.ID()] = d
+	}
+	for id, d := range s.advertised[resource] {
+		if _, ok := current[id]; !ok {
+			klog.InfoS("Device disappeared, reporting unhealthy before removal", "vendor", s.vendor, "device_id", id)
+			deviceList = append(deviceList, s.vanishedDevice(id, d))
+			healthStatusCount[pluginapi.Unhealthy]++
 		}
 	}
+	s.advertised[resource] = current
 
-	klog.Infof("Updating device list for %s: %d devices (%d healthy, %d unhealthy)",
-		s.vendor, len(deviceList), healthStatusCount[pluginapi.Healthy], healthStatusCount[pluginapi.Unhealthy])
+	klog.InfoS("Updating device list", "vendor", s.vendor, "resource", resource, "devices", len(deviceList),
+		"healthy", healthStatusCount[pluginapi.Healthy], "unhealthy", healthStatusCount[pluginapi.Unhealthy], "degraded", degradedCount,
+		"draining", s.draining.Load())
+	metrics.Devices.WithLabelValues(s.vendor, resource, "healthy").Set(float64(healthStatusCount[pluginapi.Healthy]))
+	metrics.Devices.WithLabelValues(s.vendor, resource, "unhealthy").Set(float64(healthStatusCount[pluginapi.Unhealthy]))
+	s.recordHealthyCount(resource, healthStatusCount[pluginapi.Healthy])
+	s.recordDegraded(resource, healthStatusCount[pluginapi.Unhealthy])
 
 	return stream.Send(&pluginapi.ListAndWatchResponse{Devices: deviceList})
 }
 
+// Drain 排空插件：之后上报的设备全部为Unhealthy，kubelet 不再分配新设备，
+// 已分配的设备继续保留，重启插件后恢复正常上报
+func (s *DevicePluginServer) Drain() {
+	if s.draining.Swap(true) {
+		return
+	}
+	klog.Infof("Draining %s device plugin, devices will be advertised as unhealthy", s.vendor)
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	for _, endpoint := range s.endpoints {
+		for id := range s.advertised[endpoint.resource] {
+			endpoint.notifyHealth(id)
+		}
+	}
+}
+
+// physicalInUse 判断物理设备上是否有已分配的设备
+func (s *DevicePluginServer) physicalInUse(physicalID string) bool {
+	s.ensureDeviceMap()
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	for _, id := range s.allocator.GetAllocatedDevices() {
+		if d, ok := s.lookupDevice(id); ok && d.PhysicalID() == physicalID {
+			return true
+		}
+	}
+	return false
+}
+
+// retainFailedDevices 记录本轮发现中查询失败的物理GPU上此前已知的设备，调用方需持有 updateMu
+// 设备映射刷新后这些设备不再出现，因此同时沿用上一轮保留的设备，直到其GPU恢复
+func (s *DevicePluginServer) retainFailedDevices() {
+	var failed map[string]bool
+	if reporter, ok := s.manager.(device.PartialDiscoveryReporter); ok {
+		for _, id := range reporter.FailedPhysicalIDs() {
+			if failed == nil {
+				failed = make(map[string]bool)
+			}
+			failed[id] = true
+		}
+	}
+	retained := make(map[string]device.GPUDevice)
+	if len(failed) > 0 {
+		for _, known := range []map[string]device.GPUDevice{s.deviceSnapshot(), s.retainedDevices} {
+			for id, d := range known {
+				if failed[d.PhysicalID()] {
+					retained[id] = d
+				}
+			}
+		}
+		klog.InfoS("Keeping allocations of devices on GPUs that failed discovery", "vendor", s.vendor,
+			"devices", len(retained))
+	}
+	s.retainedDevices = retained
+}
+
+// vanishedDevice 将无法再发现的设备记为不健康，调用方需持有 updateMu
+func (s *DevicePluginServer) vanishedDevice(id string, d device.GPUDevice) *pluginapi.Device {
+	if prevState := s.lastDeviceState[id]; prevState != pluginapi.Unhealthy {
+		klog.InfoS("Device health changed", "vendor", s.vendor, "device_id", id, "device_name", s.namer.Name(id),
+			"from", prevState, "to", pluginapi.Unhealthy)
+		s.emitHealthEvent(id, pluginapi.Unhealthy)
+	}
+	s.lastDeviceState[id] = pluginapi.Unhealthy
+	return &pluginapi.Device{
+		ID:       id,
+		Health:   pluginapi.Unhealthy,
+		Topology: deviceTopology(d),
+	}
+}
+
+// syncCapacity 按发现结果更新每块物理GPU的容量，防止重复上报的切片导致超额分配
+func (s *DevicePluginServer) syncCapacity(devices []device.GPUDevice) {
+	simple, ok := s.allocator.(*allocator.SimpleAllocator)
+	if !ok {
+		return
+	}
+	physicalOf := make(map[string]string, len(devices))
+	// 容量取自设备上报的硬件上限，不能按本次发现的设备数计算，否则重复上报的设备也会被计入容量
+	// 同一GPU上有多种profile时取最大值
+	capacity := make(map[string]int)
+	for _, d := range devices {
+		physicalOf[d.ID()] = d.PhysicalID()
+		if reporter, ok := d.(device.CapacityReporter); ok && reporter.PhysicalCapacity() > capacity[d.PhysicalID()] {
+			capacity[d.PhysicalID()] = reporter.PhysicalCapacity()
+		}
+	}
+	simple.SetPhysicalIDs(physicalOf)
+	simple.SetCapacities(capacity)
+}
+
 // Allocate 设备分配实现 - 生产级MIG支持
 func (s *DevicePluginServer) Allocate(ctx context.Context, req *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
-	klog.Infof("Received Allocate request for %s: %v", s.resource, req.ContainerRequests)
+	klog.InfoS("Received Allocate request", "vendor", s.vendor, "requests", req.ContainerRequests)
 	response := pluginapi.AllocateResponse{}
+	// 排空中的节点即将维护，拒绝新分配让kubelet将Pod调度失败而不是启动在将要下线的设备上
+	if s.draining.Load() {
+		klog.InfoS("Rejecting Allocate request while draining", "vendor", s.vendor)
+		return nil, grpcError(fmt.Errorf("%w, not accepting new allocations for %s", ErrDraining, s.vendor))
+	}
+
+	// 查询API Server较慢时不能让kubelet一直等待，超时后回滚本次已分配的设备
+	if s.allocateTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.allocateTimeout)
+		defer cancel()
+	}
+	// 任一容器分配失败或超时时释放本次请求中已分配的设备，避免前面容器的设备泄漏
+	var allocated []string
+	var podUID string
+	succeeded := false
+	defer func() {
+		if !succeeded && len(allocated) > 0 {
+			klog.InfoS("Rolling back devices allocated by failed request", "vendor", s.vendor, "device_ids", allocated)
+			s.release(allocated, podUID)
+		}
+	}()
+	timedOut := func() error {
+		if ctx.Err() == nil {
+			return nil
+		}
+		return grpcError(fmt.Errorf("allocate for %s did not finish within %v: %w", s.vendor, s.allocateTimeout, ctx.Err()))
+	}
 
 	// 修复：从请求的注解中获取 Pod UID（Kubernetes 标准方式）
 	// 方法1: 尝试从环境变量获取 Pod 信息
 	podName := os.Getenv("POD_NAME")
 	podNamespace := os.Getenv("POD_NAMESPACE")
-	podUID := ""
-	if podName != "" && podNamespace != "" {
-		pod, err := s.kubeClient.CoreV1().Pods(podNamespace).Get(ctx, podName, metav1.GetOptions{})
+	if s.pods != nil && podName != "" && podNamespace != "" {
+		pod, err := s.pods.GetPod(ctx, podNamespace, podName)
 		if err != nil {
 			klog.Warningf("Failed to get pod %s/%s: %v", podNamespace, podName, err)
+		} else if pod == nil {
+			klog.Warningf("Pod %s/%s not found", podNamespace, podName)
 		} else {
 			podUID = string(pod.UID)
-			klog.Infof("Found pod UID via API: %s", podUID)
+			klog.InfoS("Found pod UID via API", "vendor", s.vendor, "pod_uid", podUID)
+			s.rememberPod(pod)
 		}
 	}
+	if err := timedOut(); err != nil {
+		return nil, err
+	}
+
+	s.ensureDeviceMap()
 
 	for _, containerReq := range req.ContainerRequests {
+		if err := timedOut(); err != nil {
+			return nil, err
+		}
 		containerResp := new(pluginapi.ContainerAllocateResponse)
 
+		// kubelet的请求可能引用已不存在的设备（如MIG重新切分后）
+		if unknown := s.unknownDevices(containerReq.DevicesIDs); len(unknown) > 0 {
+			return nil, grpcError(fmt.Errorf("%w requested for %s: %v", ErrUnknownDevice, s.vendor, unknown))
+		}
+
 		// 获取 Pod UI
 		// 尝试分配这些设备
 		// 在分配设备前检查设备是否可用
 		for _, devID := range containerReq.DevicesIDs {
-			if !s.allocator.IsAvailable(devID) {
-				// 如果设备已被分配但Pod不存在，清除错误状态
-				if !s.isPodActive(s.allocator.GetPodUID(devID)) {
-					s.allocator.Deallocate([]string{devID})
-				} else {
-					return nil, fmt.Errorf("device %s is already allocated", devID)
+			if s.allocator.IsAvailable(devID) {
+				continue
+			}
+			// 如果设备已被分配但Pod不存在，释放该Pod的分配
+			for _, holder := range s.allocator.GetPodUIDs(devID) {
+				active := s.isPodActive(ctx, holder)
+				// 查询超时不代表Pod已不存在，不能释放其设备
+				if err := timedOut(); err != nil {
+					return nil, err
+				}
+				if !active {
+					s.releasePod(holder)
 				}
 			}
+			if !s.allocator.IsAvailable(devID) {
+				return nil, grpcError(fmt.Errorf("%w: %s", allocator.ErrDeviceAlreadyAllocated, s.deviceName(devID)))
+			}
 		}
 
 		if err := s.allocator.Allocate(containerReq.DevicesIDs, podUID); err != nil {
-			klog.Errorf("Allocation failed for devices %v: %v", containerReq.DevicesIDs, err)
-			return nil, fmt.Errorf("allocation failed: %v", err)
+			klog.ErrorS(err, "Allocation failed", "vendor", s.vendor, "device_ids", containerReq.DevicesIDs, "pod_uid", podUID)
+			return nil, grpcError(fmt.Errorf("allocation failed: %w", err))
 		}
+		allocated = append(allocated, containerReq.DevicesIDs...)
+		metrics.Allocations.WithLabelValues(s.vendor).Add(float64(len(containerReq.DevicesIDs)))
 
 		// ================= 核心环境变量设置 =================
 		envs := make(map[string]string)
 
 		// 关键修改：使用物理索引而非设备ID
-		envs["NVIDIA_VISIBLE_DEVICES"] = strings.Join(containerReq.DevicesIDs, ",")
+		envs["NVIDIA_VISIBLE_DEVICES"] = strings.Join(s.visibleDevices(containerReq.DevicesIDs), ",")
 		envs["NVIDIA_DRIVER_CAPABILITIES"] = "compute,utility,video,graphics"
 		envs["NVIDIA_DISABLE_REQUIRE"] = "1"
 		envs["NVIDIA_REQUIRE_MIG"] = "1"
+		// 时间片副本的显存配额，供容器内的显存限制库读取
+		for k, v := range s.memoryLimitEnvs(containerReq.DevicesIDs) {
+			envs[k] = v
+		}
+		for k, v := range s.rdmaEnvs(containerReq.DevicesIDs) {
+			envs[k] = v
+		}
 
 		containerResp.Envs = envs
 
 		// 打印环境变量用于调试
 		for k, v := range containerResp.Envs {
-			klog.Infof("Setting env: %s=%s", k, v)
+			klog.V(4).InfoS("Setting env", "vendor", s.vendor, "name", k, "value", v)
 		}
 
-		// 添加 CDI 设备注入
+		// 挂载设备节点，非NVIDIA运行时的场景依赖这些节点
+		containerResp.Devices = s.deviceSpecs(containerReq.DevicesIDs)
+		containerResp.Mounts = s.mounts
+
+		// 添加 CDI 设备注入，前缀为空时仅使用环境变量
 		if s.cdiEnabled {
-			cdiDevices := make([]string, len(containerReq.DevicesIDs))
-			for i, id := range containerReq.DevicesIDs {
-				cdiDevices[i] = fmt.Sprintf("%s/%s=%s", s.cdiPrefix, s.vendor, id)
-			}
-			containerResp.CDIDevices = []*pluginapi.CDIDevice{
-				{
-					Name: strings.Join(cdiDevices, ","),
-				},
+			if s.cdiPrefix == "" {
+				klog.Warningf("CDI is enabled but CDI prefix is empty, falling back to env-based injection")
+			} else {
+				containerResp.CDIDevices = s.cdiDevices(containerReq.DevicesIDs)
 			}
 		}
 
 		response.ContainerResponses = append(response.ContainerResponses, containerResp)
 	}
+	if err := timedOut(); err != nil {
+		return nil, err
+	}
+	succeeded = true
 
-	klog.Infof("Allocation successful for %s, req :%v, resp: %v", s.resource, req.ContainerRequests,
-		response.ContainerResponses)
+	klog.InfoS("Allocation successful", "vendor", s.vendor, "pod_uid", podUID, "requests", req.ContainerRequests,
+		"responses", response.ContainerResponses)
 	return &response, nil
 }
 
-func (s *DevicePluginServer) isMIGDevice(id string) bool {
-	devices, _ := s.manager.DiscoverGPUs()
+// visibleDevices 将设备ID转换为容器运行时识别的标识（MIG设备为MIG UUID），去重并保持顺序
+func (s *DevicePluginServer) visibleDevices(ids []string) []string {
+	visible := make([]string, 0, len(ids))
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		value := id
+		if provider, ok := s.deviceSnapshot()[id].(device.VisibleDeviceProvider); ok {
+			value = provider.VisibleDeviceID()
+		}
+		if !seen[value] {
+			seen[value] = true
+			visible = append(visible, value)
+		}
+	}
+	return visible
+}
+
+// memoryLimitEnvs 按设备的显存配额生成 CUDA_DEVICE_MEMORY_LIMIT_<序号>=<MB>m
+// 序号与 NVIDIA_VISIBLE_DEVICES 中的顺序一致，同一GPU上多个副本的配额相加；
+// 任一设备未声明配额时该GPU不设置限制
+func (s *DevicePluginServer) memoryLimitEnvs(ids []string) map[string]string {
+	limits := make(map[string]uint64)
+	unlimited := make(map[string]bool)
+	for _, id := range ids {
+		d, ok := s.lookupDevice(id)
+		if !ok {
+			continue
+		}
+		value := id
+		if provider, ok := d.(device.VisibleDeviceProvider); ok {
+			value = provider.VisibleDeviceID()
+		}
+		limit, _ := strconv.ParseUint(d.Attributes()[device.AttrMemoryLimit], 10, 64)
+		if limit == 0 {
+			unlimited[value] = true
+		}
+		limits[value] += limit
+	}
+	envs := make(map[string]string)
+	for i, value := range s.visibleDevices(ids) {
+		if limit := limits[value]; limit > 0 && !unlimited[value] {
+			envs[fmt.Sprintf("CUDA_DEVICE_MEMORY_LIMIT_%d", i)] = fmt.Sprintf("%dm", limit)
+		}
+	}
+	return envs
+}
+
+// ensureDeviceMap 设备映射尚未建立（ListAndWatch 未运行）时重新发现设备
+// 映射已建立时不获取 updateMu，Allocate 不会被正在进行的设备列表刷新阻塞
+func (s *DevicePluginServer) ensureDeviceMap() {
+	if len(s.deviceSnapshot()) > 0 {
+		return
+	}
+	s.updateMu.Lock()
+	defer s.updateMu.Unlock()
+	if len(s.deviceSnapshot()) > 0 {
+		return
+	}
+	devices, err := s.manager.DiscoverGPUs()
+	if err != nil {
+		klog.ErrorS(err, "Failed to discover devices for allocation", "vendor", s.vendor)
+		return
+	}
+	deviceMap := make(map[string]device.GPUDevice, len(devices))
 	for _, d := range devices {
-		if d.ID() == id && d.IsMIG() {
-			return true
+		deviceMap[d.ID()] = d
+	}
+	s.setDeviceMap(deviceMap)
+}
+
+// setDeviceMap 发布新的设备映射，发布后调用方不得再修改该映射
+func (s *DevicePluginServer) setDeviceMap(deviceMap map[string]device.GPUDevice) {
+	s.deviceMu.Lock()
+	defer s.deviceMu.Unlock()
+	s.deviceMap = deviceMap
+}
+
+// deviceSnapshot 返回当前设备映射，只读
+func (s *DevicePluginServer) deviceSnapshot() map[string]device.GPUDevice {
+	s.deviceMu.RLock()
+	defer s.deviceMu.RUnlock()
+	return s.deviceMap
+}
+
+// lookupDevice 按ID查找已发现的设备
+func (s *DevicePluginServer) lookupDevice(id string) (device.GPUDevice, bool) {
+	d, ok := s.deviceSnapshot()[id]
+	return d, ok
+}
+
+// unknownDevices 返回不在设备映射中的设备ID
+func (s *DevicePluginServer) unknownDevices(ids []string) []string {
+	var unknown []string
+	for _, id := range ids {
+		if _, ok := s.lookupDevice(id); !ok {
+			unknown = append(unknown, id)
 		}
 	}
-	return false
+	return unknown
+}
+
+// lookupDevices 按ID查找设备，返回找到的设备和未知的设备ID
+func (s *DevicePluginServer) lookupDevices(ids []string) ([]device.GPUDevice, []string) {
+	devices := make([]device.GPUDevice, 0, len(ids))
+	var unknown []string
+	for _, id := range ids {
+		if d, ok := s.lookupDevice(id); ok {
+			devices = append(devices, d)
+		} else {
+			unknown = append(unknown, id)
+		}
+	}
+	return devices, unknown
+}
+
+// topologyGroup 返回设备的拓扑分组（NUMA节点/物理GPU）
+func (s *DevicePluginServer) topologyGroup(d device.GPUDevice) string {
+	numaNode := -1
+	if numaAware, ok := d.(device.NUMAAwareDevice); ok {
+		numaNode = numaAware.NUMANode()
+	}
+	return fmt.Sprintf("%d/%s", numaNode, d.PhysicalID())
+}
+
+// deviceTopology 返回设备的NUMA拓扑，供kubelet拓扑管理器对齐CPU/内存
+func deviceTopology(d device.GPUDevice) *pluginapi.TopologyInfo {
+	numaAware, ok := d.(device.NUMAAwareDevice)
+	if !ok || numaAware.NUMANode() < 0 {
+		return nil
+	}
+	return &pluginapi.TopologyInfo{
+		Nodes: []*pluginapi.NUMANode{{ID: int64(numaAware.NUMANode())}},
+	}
+}
+
+// deviceSpecs 返回设备节点及其控制设备的挂载信息，相同路径只挂载一次
+func (s *DevicePluginServer) deviceSpecs(ids []string) []*pluginapi.DeviceSpec {
+	var specs []*pluginapi.DeviceSpec
+	seen := make(map[string]bool)
+	addPath := func(path string) {
+		if path == "" || seen[path] {
+			return
+		}
+		seen[path] = true
+		specs = append(specs, &pluginapi.DeviceSpec{
+			HostPath:      path,
+			ContainerPath: path,
+			Permissions:   "rw",
+		})
+	}
+
+	for _, id := range ids {
+		d, ok := s.lookupDevice(id)
+		if !ok {
+			klog.Warningf("Device %s not found in device map, skipping device node mount", s.deviceName(id))
+			continue
+		}
+		addPath(d.GetPath())
+		if provider, ok := d.(device.ControlDeviceProvider); ok {
+			for _, path := range provider.ControlPaths() {
+				addPath(path)
+			}
+		}
+		// GPUDirect RDMA：一并挂载拓扑最近的RDMA网卡
+		if provider, ok := d.(device.RDMADeviceProvider); ok {
+			_, paths := provider.RDMADevice()
+			for _, path := range paths {
+				addPath(path)
+			}
+		}
+	}
+	return specs
+}
+
+// rdmaEnvs 设备关联了RDMA网卡时，让NCCL只使用这些网卡并启用GDRCopy
+func (s *DevicePluginServer) rdmaEnvs(ids []string) map[string]string {
+	var nics []string
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		provider, ok := s.deviceSnapshot()[id].(device.RDMADeviceProvider)
+		if !ok {
+			continue
+		}
+		if name, _ := provider.RDMADevice(); name != "" && !seen[name] {
+			seen[name] = true
+			nics = append(nics, name)
+		}
+	}
+	if len(nics) == 0 {
+		return nil
+	}
+	return map[string]string{
+		"NCCL_IB_HCA":    strings.Join(nics, ","),
+		"NVIDIA_GDRCOPY": "enabled",
+	}
+}
+
+// cdiDevices 为每个设备生成完全限定的CDI设备名
+// 前缀已是 "vendor/class" 形式时直接使用，否则按 "<prefix>/<vendor>" 组合
+func (s *DevicePluginServer) cdiDevices(ids []string) []*pluginapi.CDIDevice {
+	kind := s.cdiPrefix
+	if !strings.Contains(kind, "/") {
+		kind = kind + "/" + s.vendor
+	}
+
+	devices := make([]*pluginapi.CDIDevice, len(ids))
+	for i, id := range ids {
+		devices[i] = &pluginapi.CDIDevice{Name: kind + "=" + id}
+	}
+	return devices
+}
+
+func (s *DevicePluginServer) isMIGDevice(id string) bool {
+	d, ok := s.manager.GetDevice(id)
+	return ok && d.IsMIG()
 }
 
 // GetDevicePluginOptions 插件选项
 func (s *DevicePluginServer) GetDevicePluginOptions(ctx context.Context, empty *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
 	return &pluginapi.DevicePluginOptions{
-		PreStartRequired: false,
+		PreStartRequired:                s.preStartValidate,
+		GetPreferredAllocationAvailable: true,
 	}, nil
 }
 
-// PreStartContainer 容器启动前预处理（可选）
+// PreStartContainer 开启 PRESTART_RESET 时校验设备仍存在且健康，否则拒绝启动容器
+// MIG设备在分配后可能因重新配置而被销毁，此时容器拿到的设备已不可用
+// 被占用的GPU无法执行 nvidia-smi --gpu-reset，因此只做校验不做重置
 func (s *DevicePluginServer) PreStartContainer(ctx context.Context, req *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
+	if !s.preStartValidate {
+		return &pluginapi.PreStartContainerResponse{}, nil
+	}
+	if err := s.validateDevices(req.DevicesIDs); err != nil {
+		klog.ErrorS(err, "Pre-start validation failed", "vendor", s.vendor, "devices", req.DevicesIDs)
+		return nil, grpcError(err)
+	}
 	return &pluginapi.PreStartContainerResponse{}, nil
 }
 
+// validateDevices 重新发现设备，确认每个设备仍存在且健康
+func (s *DevicePluginServer) validateDevices(ids []string) error {
+	devices, err := s.manager.DiscoverGPUs()
+	if err != nil {
+		return fmt.Errorf("failed to discover devices: %v", err)
+	}
+	present := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		present[d.ID()] = true
+	}
+	for _, id := range ids {
+		if !present[id] {
+			return fmt.Errorf("%w: %s no longer exists", ErrUnknownDevice, s.deviceName(id))
+		}
+		if !s.manager.CheckHealth(id) {
+			return fmt.Errorf("%w: %s", ErrDeviceUnhealthy, s.deviceName(id))
+		}
+	}
+	return nil
+}
+
 // GetPreferredAllocation 分配偏好（可选）
 func (s *DevicePluginServer) GetPreferredAllocation(ctx context.Context, req *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	return &pluginapi.PreferredAllocationResponse{}, nil
+	response := &pluginapi.PreferredAllocationResponse{}
+
+	for _, containerReq := range req.ContainerRequests {
+		size := int(containerReq.AllocationSize)
+
+		required, unknown := s.lookupDevices(containerReq.MustIncludeDeviceIDs)
+		if len(unknown) > 0 {
+			return nil, grpcError(fmt.Errorf("%w required for %s: %v", ErrUnknownDevice, s.vendor, unknown))
+		}
+		// 已消失的可用设备不参与挑选
+		available, _ := s.lookupDevices(containerReq.AvailableDeviceIDs)
+
+		// 必须包含的设备原样保留，其余按物理GPU/NUMA由分配策略补足；
+		// 设备不足时返回部分结果，由kubelet自行补齐
+		preferred, err := s.allocator.Preferred(available, required, size, s.topologyGroup)
+		if err != nil {
+			klog.Warningf("Preferred allocation for %s can only satisfy %d of %d devices: %v", s.vendor, len(preferred), size, err)
+		}
+
+		response.ContainerResponses = append(response.ContainerResponses, &pluginapi.ContainerPreferredAllocationResponse{
+			DeviceIDs: preferred,
+		})
+	}
+
+	return response, nil
 }
 
 // *********** 服务管理方法 ***********
 
 // Start 启动设备插件服务
-func (s *DevicePluginServer) Start(ctx context.Context) error {
+func (s *DevicePluginServer) Start(ctx context.Context) (err error) {
 	klog.Infof("Starting %s device plugin", s.vendor)
 
+	// 派生插件自身的上下文：根上下文取消时停止插件，Stop 时结束插件的全部后台任务
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	go func() {
+		<-s.ctx.Done()
+		s.Stop()
+	}()
+	// 启动失败的插件不会被调用方停止，取消上下文以结束回收器并关闭已启动的端点
+	defer func() {
+		if err != nil {
+			s.cancel()
+		}
+	}()
+
 	// 启动资源回收器（每 30 秒运行一次）
-	go s.ResourceRecycler(ctx, 30*time.Second) // 共享主流程上下文
+	go s.ResourceRecycler(s.ctx, 30*time.Second)
+	// 节点标签与状况在后台发布，不占用 updateMu
+	go s.runNodePatcher(s.ctx)
+	// 先恢复分配状态并按kubelet检查点补全，重新切分MIG时据此避开使用中的GPU
+	s.restoreAllocations()
+	s.reconcileOnStart()
+
 	// 如果是NVIDIA设备，配置MIG
 	if nvidiaManager, ok := s.manager.(*device.NVIDIAManager); ok {
+		nvidiaManager.SetInUseChecker(s.physicalInUse)
 		nvidiaManager.ConfigureMIG()
 	}
 
-	// 确保插件目录存在
-	if err := os.MkdirAll(pluginapi.DevicePluginPath, 0755); err != nil {
+	// 确保插件目录存在且可写，只读挂载时尽早给出明确的错误
+	if err := os.MkdirAll(s.pluginPath, 0755); err != nil {
 		klog.Errorf("Failed to create device plugin directory: %v", err)
-		return fmt.Errorf("failed to create device plugin directory: %v", err)
+		return fmt.Errorf("failed to create device plugin directory %s: %v", s.pluginPath, err)
 	}
-
-	// 清理现有的socket文件
-	if err := syscall.Unlink(s.socket); err != nil && !os.IsNotExist(err) {
-		klog.Errorf("Failed to unlink socket: %v", err)
-		return fmt.Errorf("failed to unlink socket: %v", err)
+	if err := checkDirWritable(s.pluginPath); err != nil {
+		return err
 	}
 
-	// 创建监听
-	lis, err := net.Listen("unix", s.socket)
-	if err != nil {
-		klog.Errorf("Failed to listen on socket: %v", err)
-		return fmt.Errorf("failed to listen on socket: %v", err)
+	resources := s.resources
+	if len(resources) == 0 {
+		resources = s.discoverResources()
 	}
-
-	// 创建gRPC服务
-	s.server = grpc.NewServer()
-	pluginapi.RegisterDevicePluginServer(s.server, s)
-
-	// 启动gRPC服务
-	go func() {
-		klog.Infof("Starting %s device plugin server at: %s", s.vendor, s.socket)
-		if err := s.server.Serve(lis); err != nil {
-			klog.Fatalf("Device plugin server failed: %v", err)
+	for resource := range resources {
+		if err := validateResourceName(resource); err != nil {
+			return err
+		}
+		if err := validateSocketPath(s.socketFor(resource)); err != nil {
+			return err
 		}
-	}()
-
-	// 等待服务器启动
-	connCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	if err := waitForSocket(connCtx, s.socket); err != nil {
-		klog.Errorf("Failed to start gRPC server: %v", err)
-		return fmt.Errorf("failed to start gRPC server: %v", err)
 	}
-
-	// 注册到kubelet
-	if err := s.registerWithKubelet(); err != nil {
-		klog.Errorf("Failed to register with kubelet: %v", err)
-		return fmt.Errorf("failed to register with kubelet: %v", err)
+	for resource, filter := range resources {
+		endpoint := s.newEndpoint(resource, filter)
+		if err := endpoint.serve(); err != nil {
+			return err
+		}
+		// 已注册的端点可能正在 ListAndWatch 中读取端点数，需与设备列表刷新互斥
+		s.updateMu.Lock()
+		s.endpoints = append(s.endpoints, endpoint)
+		s.updateMu.Unlock()
 	}
 
-	klog.Infof("%s device plugin started and registered with resource name %s", s.vendor, s.resource)
+	klog.Infof("%s device plugin started and registered with resource names %v", s.vendor, s.resourceNames())
+	s.started.Store(true)
+	s.emitStartupEvent()
 
+	// kubelet重启后重新注册
+	go s.watchKubelet(s.ctx)
 	return nil
 }
 
-// Stop 停止设备插件
-func (s *DevicePluginServer) Stop() {
-	klog.Infof("Stopping %s device plugin", s.vendor)
-	close(s.stop)
-	if s.server != nil {
-		s.server.Stop()
+// Ready 插件已启动且所有资源均已注册到kubelet
+func (s *DevicePluginServer) Ready() bool {
+	if !s.started.Load() {
+		return false
+	}
+	for _, endpoint := range s.snapshotEndpoints() {
+		if !endpoint.registered.Load() {
+			return false
+		}
 	}
+	return true
 }
 
-// HealthCheck 后台健康检查
-func (s *DevicePluginServer) HealthCheck(ctx context.Context, interval time.Duration) {
-	klog.Infof("Starting health check for %s plugin with interval %v", s.vendor, interval)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// Stop 停止设备插件，可重复调用
+func (s *DevicePluginServer) Stop() {
+	s.stopOnce.Do(func() {
+		klog.Infof("Stopping %s device plugin", s.vendor)
+		s.started.Store(false)
+		if s.cancel != nil {
+			s.cancel()
+		}
+		close(s.stop)
+		for _, endpoint := range s.snapshotEndpoints() {
+			endpoint.shutdown()
+		}
+		s.emitShutdownEvent()
+		if s.broadcaster != nil {
+			s.broadcaster.Shutdown()
+		}
+	})
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			devices, err := s.manager.DiscoverGPUs()
-			if err != nil {
-				klog.Errorf("Failed to discover devices during health check: %v", err)
-				continue
+// release 释放 Pod 在这些设备上的分配并记录指标
+func (s *DevicePluginServer) release(ids []string, podUID string) {
+	s.allocator.Deallocate(ids, podUID)
+	metrics.Deallocations.WithLabelValues(s.vendor).Add(float64(len(ids)))
+}
+
+// releasePod 释放 Pod 持有的全部设备并记录指标
+func (s *DevicePluginServer) releasePod(podUID string) []string {
+	released := s.allocator.ReleasePod(podUID)
+	metrics.Deallocations.WithLabelValues(s.vendor).Add(float64(len(released)))
+	return released
+}
+
+// allocatedPods 返回持有设备分配的 Pod UID，按UID排序
+func (s *DevicePluginServer) allocatedPods() []string {
+	seen := make(map[string]bool)
+	var pods []string
+	for _, holders := range s.allocator.GetAllocationMap() {
+		for _, podUID := range holders {
+			if !seen[podUID] {
+				seen[podUID] = true
+				pods = append(pods, podUID)
 			}
+		}
+	}
+	sort.Strings(pods)
+	return pods
+}
+
+// restoreAllocations 从检查点恢复分配状态，并释放所属Pod已不存在的设备
+func (s *DevicePluginServer) restoreAllocations() {
+	if err := s.allocator.Restore(); err != nil {
+		klog.Errorf("Failed to restore allocations for %s: %v", s.vendor, err)
+		return
+	}
+	// 无法访问API Server时保留恢复的状态
+	if s.pods == nil {
+		return
+	}
+	for _, podUID := range s.allocatedPods() {
+		pod, err := s.getPodByUID(context.Background(), podUID)
+		if err != nil {
+			klog.Warningf("Failed to check pod %s for restored devices %v: %v", podUID, s.allocator.GetDevicesByPod(podUID), err)
+			continue
+		}
+		if pod == nil || !s.isPodActive(context.Background(), podUID) {
+			released := s.releasePod(podUID)
+			klog.Infof("Releasing restored devices %v: pod %s is no longer active", released, podUID)
+		}
+	}
+}
 
-			for _, d := range devices {
-				currentHealth := d.IsHealthy()
-				actualHealth := s.manager.CheckHealth(d.ID())
+// HealthCheck 后台健康检查，将管理器上报的状态变化转发给 ListAndWatch
+func (s *DevicePluginServer) HealthCheck(ctx context.Context) {
+	klog.Infof("Starting health check for %s plugin", s.vendor)
+	// 插件停止时同样结束管理器的健康监听
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changed := make(chan string)
+	go s.manager.WatchHealth(ctx, changed)
 
-				if currentHealth != actualHealth {
-					klog.Warningf("Device %s health status changed from %v to %v", d.ID(), currentHealth, actualHealth)
-					s.healthChan <- d.ID()
-				}
+	for {
+		select {
+		case id := <-changed:
+			klog.Warningf("Device %s health status changed", s.deviceName(id))
+			for _, endpoint := range s.endpointsFor(id) {
+				endpoint.notifyHealth(id)
 			}
 		case <-ctx.Done():
 			klog.Infof("Stopping health check for %s plugin", s.vendor)
 			return
+		case <-s.stop:
+			klog.Infof("Stopping health check for %s plugin", s.vendor)
+			return
 		}
 	}
 }
 
 // *********** 辅助方法 ***********
 
-func (s *DevicePluginServer) registerWithKubelet() error {
-	klog.Infof("Registering with kubelet at %s", kubeletSocket)
-
-	conn, err := grpc.Dial(kubeletSocket, grpc.WithInsecure(),
-		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
-			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
-		}),
-	)
-
-	if err != nil {
-		return fmt.Errorf("failed to connect to kubelet: %v", err)
-	}
-	defer conn.Close()
-
-	client := pluginapi.NewRegistrationClient(conn)
-	req := &pluginapi.RegisterRequest{
-		Version:      pluginapi.Version,
-		Endpoint:     path.Base(s.socket),
-		ResourceName: s.resource,
-	}
-
-	_, err = client.Register(context.Background(), req)
-	return err
-}
-
 func waitForSocket(ctx context.Context, socket string) error {
 	klog.V(4).Infof("Waiting for socket %s to be ready", socket)
 
@@ -408,6 +1096,10 @@ func waitForSocket(ctx context.Context, socket string) error {
 
 // 新增方法：资源回收器
 func (s *DevicePluginServer) ResourceRecycler(ctx context.Context, interval time.Duration) {
+	if s.pods == nil {
+		klog.Infof("Kubernetes API unavailable, resource recycler disabled for %s plugin", s.vendor)
+		return
+	}
 	klog.Infof("Starting resource recycler for %s plugin", s.vendor)
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -415,53 +1107,139 @@ func (s *DevicePluginServer) ResourceRecycler(ctx context.Context, interval time
 	for {
 		select {
 		case <-ticker.C:
+			s.recycle(ctx)
+		case <-ctx.Done():
+			klog.Infof("Stopping resource recycler for %s plugin", s.vendor)
+			return
+		}
+	}
+}
 
-			allocatedMap := s.allocator.GetAllocationMap() // 获取设备到 Pod 的映射
-			if len(allocatedMap) == 0 {
-				continue
-			}
+// recycle 释放非活动 Pod 持有的设备，共享设备只释放该 Pod 的分配；
+// 活动 Pod 占用超时的设备按 FORCE_RELEASE_EXPIRED 处理
+func (s *DevicePluginServer) recycle(ctx context.Context) {
+	allocatedMap := s.allocator.GetAllocationMap() // 获取设备到 Pod 的映射
+	if len(allocatedMap) == 0 {
+		return
+	}
 
-			// 检查已分配设备对应的 Pod
-			var toRelease []string
-			for deviceID, podUID := range allocatedMap {
-				if podUID == "" {
-					toRelease = append(toRelease, deviceID) // 无主设备直接释放
-					continue
-				}
+	released := 0
+	inactive := make(map[string]bool)
+	for _, podUID := range s.allocatedPods() {
+		// 无主设备直接释放；只有非活动状态（终止/完成）的 Pod 才释放
+		if podUID != "" && s.isPodActive(ctx, podUID) {
+			continue
+		}
+		inactive[podUID] = true
+		ids := s.releasePod(podUID)
+		released += len(ids)
+		klog.Infof("Released devices %v (pod %q is inactive)", ids, podUID)
+	}
 
-				// 检查 Pod 状态：只有非活动状态（终止/完成）才释放
-				if !s.isPodActive(podUID) {
-					toRelease = append(toRelease, deviceID)
-					klog.Infof("Marking device %s for release (pod %s is inactive)", deviceID, podUID)
-				}
+	// Pod 仍活跃但占用时间过长，可能是泄漏的设备
+	for deviceID, holders := range allocatedMap {
+		for _, podUID := range holders {
+			if !inactive[podUID] && s.checkAllocationAge(deviceID, podUID) {
+				s.release([]string{deviceID}, podUID)
+				released++
 			}
+		}
+	}
+	if released > 0 {
+		klog.Infof("Released %d orphaned device allocations for %s", released, s.vendor)
+	}
+}
 
-			// 释放资源
-			if len(toRelease) > 0 {
-				s.allocator.Deallocate(toRelease)
-				klog.Infof("Released %d orphaned devices, deivce %v", len(toRelease), toRelease)
-			}
+// checkAllocationAge 检查设备占用时间是否超过上限，超限时告警
+// 返回 true 表示应强制释放（需开启 FORCE_RELEASE_EXPIRED）
+func (s *DevicePluginServer) checkAllocationAge(deviceID, podUID string) bool {
+	if s.maxAllocationAge <= 0 {
+		return false
+	}
+	allocatedAt, ok := s.allocator.GetAllocationTime(deviceID)
+	if !ok {
+		return false
+	}
+	age := clock.OrReal(s.clock).Since(allocatedAt)
+	if age <= s.maxAllocationAge {
+		return false
+	}
 
-		case <-ctx.Done():
-			klog.Infof("Stopping resource recycler for %s plugin", s.vendor)
-			return
+	// 同一次分配只告警一次
+	if warnedAt, warned := s.expiredWarned[deviceID]; !warned || !warnedAt.Equal(allocatedAt) {
+		s.expiredWarned[deviceID] = allocatedAt
+		klog.Warningf("Device %s held by pod %s for %v, exceeding max allocation age %v",
+			s.deviceName(deviceID), podUID, age.Round(time.Second), s.maxAllocationAge)
+		if s.recorder != nil && s.nodeName != "" {
+			s.recorder.Eventf(s.nodeRef(), corev1.EventTypeWarning, reasonAllocationExpired,
+				"Device %s held by pod %s for %v, exceeding max allocation age %v",
+				s.deviceName(deviceID), podUID, age.Round(time.Second), s.maxAllocationAge)
 		}
 	}
+
+	if s.forceReleaseExpired {
+		delete(s.expiredWarned, deviceID)
+		klog.Warningf("Force releasing device %s held by pod %s", s.deviceName(deviceID), podUID)
+		return true
+	}
+	return false
+}
+
+// durationFromEnv 解析 time.Duration 格式的环境变量，无效时使用默认值
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		klog.Warningf("Invalid %s %q, using default %v", key, value, def)
+		return def
+	}
+	return d
+}
+
+// intFromEnv 解析正整数环境变量，无效时使用默认值
+func intFromEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		klog.Warningf("Invalid %s %q, using default %d", key, value, def)
+		return def
+	}
+	return n
 }
 
 // isPodActive 检查 Pod 是否处于活动状态（非终止/完成）
-func (s *DevicePluginServer) isPodActive(podUID string) bool {
+func (s *DevicePluginServer) isPodActive(ctx context.Context, podUID string) bool {
 	if podUID == "" {
 		return false
 	}
-	pod, err := s.kubeClient.CoreV1().Pods("").Get(context.Background(), "", metav1.GetOptions{})
+	// 无法查询Pod状态时以kubelet的分配请求为准
+	if s.pods == nil {
+		return false
+	}
+	pod, err := s.getPodByUID(ctx, podUID)
 	if err != nil {
 		klog.Warningf("Failed to get pod with UID %s: %v", podUID, err)
 		return false // 默认按非活动处理
 	}
+	if pod == nil {
+		klog.V(4).Infof("Pod with UID %s no longer exists", podUID)
+		return false
+	}
 	if pod.DeletionTimestamp != nil {
 		return false // 正在终止，视为非活动
 	}
+	// UID 冲突或过期记录可能指向其他节点的Pod，这类Pod不会使用本节点的设备
+	if s.nodeName != "" && pod.Spec.NodeName != "" && pod.Spec.NodeName != s.nodeName {
+		klog.Warningf("Pod %s/%s (%s) is scheduled to node %s, not %s, treating as inactive",
+			pod.Namespace, pod.Name, podUID, pod.Spec.NodeName, s.nodeName)
+		return false
+	}
 
 	// 活动状态：Running 或 Pending
 	if pod.Status.Phase == corev1.PodRunning || pod.Status.Phase == corev1.PodPending {
@@ -470,3 +1248,44 @@ func (s *DevicePluginServer) isPodActive(podUID string) bool {
 	// 非活动状态：Succeeded（完成）、Failed（失败）或正在删除（DeletionTimestamp 非空）
 	return false
 }
+
+// rememberPod 缓存 Pod UID 到命名空间/名称的映射，供后续按 UID 查询
+func (s *DevicePluginServer) rememberPod(pod *corev1.Pod) {
+	s.podMu.Lock()
+	defer s.podMu.Unlock()
+	s.podRefs[string(pod.UID)] = types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}
+}
+
+func (s *DevicePluginServer) forgetPod(podUID string) {
+	s.podMu.Lock()
+	defer s.podMu.Unlock()
+	delete(s.podRefs, podUID)
+}
+
+// getPodByUID 按 UID 查找 Pod，Pod 不存在时返回 nil
+// 优先使用分配时缓存的名称直接查询，否则列出本节点的 Pod 进行匹配
+func (s *DevicePluginServer) getPodByUID(ctx context.Context, podUID string) (*corev1.Pod, error) {
+	s.podMu.RLock()
+	ref, cached := s.podRefs[podUID]
+	s.podMu.RUnlock()
+
+	if cached {
+		pod, err := s.pods.GetPod(ctx, ref.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		// Pod 已删除，或同名 Pod 被重建后 UID 不同，原 Pod 已不存在
+		if pod == nil || string(pod.UID) != podUID {
+			s.forgetPod(podUID)
+			return nil, nil
+		}
+		return pod, nil
+	}
+
+	pod, err := s.pods.GetPodByUID(ctx, podUID)
+	if err != nil || pod == nil {
+		return nil, err
+	}
+	s.rememberPod(pod)
+	return pod, nil
+}
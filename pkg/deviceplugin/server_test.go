@@ -0,0 +1,392 @@
+package deviceplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benyuereal/micro-device-plugin/pkg/allocator"
+	"github.com/benyuereal/micro-device-plugin/pkg/device"
+	"github.com/benyuereal/micro-device-plugin/pkg/metrics"
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// newTestServer 使用模拟管理器创建插件，socket 放在临时目录，不访问集群
+func newTestServer(t *testing.T) (*DevicePluginServer, *device.SimulatorManager) {
+	t.Helper()
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("DEVICE_PLUGIN_PATH", t.TempDir())
+	t.Setenv("SIM_FAIL_RATE", "0")
+	manager := device.NewSimulatorManager()
+	return New("nvidia", manager, false, "", ""), manager
+}
+
+func allDevices(device.GPUDevice) bool { return true }
+
+// fakeKubelet 在插件目录中提供kubelet注册服务，前 failures 次注册返回错误
+type fakeKubelet struct {
+	pluginapi.UnimplementedRegistrationServer
+	server   *grpc.Server
+	mu       sync.Mutex
+	failures int
+	requests chan *pluginapi.RegisterRequest
+}
+
+func startFakeKubelet(t *testing.T, dir string, failures int) *fakeKubelet {
+	t.Helper()
+	lis, err := net.Listen("unix", filepath.Join(dir, filepath.Base(pluginapi.KubeletSocket)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &fakeKubelet{server: grpc.NewServer(), failures: failures, requests: make(chan *pluginapi.RegisterRequest, 16)}
+	pluginapi.RegisterRegistrationServer(k.server, k)
+	go k.server.Serve(lis)
+	t.Cleanup(k.server.Stop)
+	return k
+}
+
+func (k *fakeKubelet) Register(_ context.Context, req *pluginapi.RegisterRequest) (*pluginapi.Empty, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.failures > 0 {
+		k.failures--
+		return nil, errors.New("kubelet is not ready")
+	}
+	k.requests <- req
+	return &pluginapi.Empty{}, nil
+}
+
+// waitRegistration 等待下一次成功的注册请求
+func (k *fakeKubelet) waitRegistration(t *testing.T, timeout time.Duration) *pluginapi.RegisterRequest {
+	t.Helper()
+	select {
+	case req := <-k.requests:
+		return req
+	case <-time.After(timeout):
+		t.Fatal("plugin did not register with kubelet")
+		return nil
+	}
+}
+
+// New 按厂商与环境变量填充资源名、插件目录、分配器和socket
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantResource string
+		wantSocket   string
+	}{
+		{"defaults", nil, "nvidia.com/microgpu", "microui.sock.nvidia"},
+		{"overridden by env", map[string]string{
+			"RESOURCE_NAME_NVIDIA": "example.com/gpu",
+			"SOCKET_PREFIX":        "custom.sock",
+		}, "example.com/gpu", "custom.sock.nvidia"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			s, manager := newTestServer(t)
+			if s.vendor != "nvidia" || s.manager != device.DeviceManager(manager) {
+				t.Fatalf("vendor = %q, manager = %v", s.vendor, s.manager)
+			}
+			if s.resource != tt.wantResource {
+				t.Fatalf("resource = %q, want %q", s.resource, tt.wantResource)
+			}
+			if want := os.Getenv("DEVICE_PLUGIN_PATH"); s.pluginPath != want {
+				t.Fatalf("pluginPath = %q, want %q", s.pluginPath, want)
+			}
+			if _, ok := s.allocator.(*allocator.SimpleAllocator); !ok {
+				t.Fatalf("allocator = %T, want *allocator.SimpleAllocator", s.allocator)
+			}
+			if got, want := s.socketFor(s.resource), filepath.Join(s.pluginPath, tt.wantSocket); got != want {
+				t.Fatalf("socketFor(%s) = %q, want %q", s.resource, got, want)
+			}
+			if s.kubernetesEnabled() {
+				t.Fatal("kubernetes client enabled outside a cluster")
+			}
+		})
+	}
+}
+
+// 端点追加与各读取方并发执行，需配合 -race 运行
+func TestEndpointsConcurrentAccess(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.started.Store(true)
+
+	readers := []struct {
+		name string
+		read func()
+	}{
+		{"Ready", func() { s.Ready() }},
+		{"resourceNames", func() { s.resourceNames() }},
+		{"endpointsFor", func() { s.endpointsFor("0") }},
+		{"snapshotEndpoints", func() { s.snapshotEndpoints() }},
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			endpoint := s.newEndpoint(fmt.Sprintf("nvidia.com/gpu-%d", i), allDevices)
+			s.updateMu.Lock()
+			s.endpoints = append(s.endpoints, endpoint)
+			s.updateMu.Unlock()
+		}
+	}()
+	for _, r := range readers {
+		wg.Add(1)
+		go func(read func()) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				read()
+			}
+		}(r.read)
+	}
+	wg.Wait()
+
+	if got := len(s.resourceNames()); got != 100 {
+		t.Fatalf("resourceNames() returned %d resources, want 100", got)
+	}
+	s.Stop()
+}
+
+// 设备映射的刷新与查找并发执行，需配合 -race 运行
+func TestDeviceMapConcurrentAccess(t *testing.T) {
+	s, manager := newTestServer(t)
+	devices, err := manager.DiscoverGPUs()
+	if err != nil {
+		t.Fatalf("DiscoverGPUs() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			deviceMap := make(map[string]device.GPUDevice, len(devices))
+			for _, d := range devices {
+				deviceMap[d.ID()] = d
+			}
+			s.setDeviceMap(deviceMap)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			s.lookupDevice("0")
+			s.unknownDevices([]string{"0", "missing"})
+			s.ensureDeviceMap()
+		}
+	}()
+	wg.Wait()
+
+	if _, ok := s.lookupDevice("0"); !ok {
+		t.Fatalf("lookupDevice(0) not found after concurrent updates")
+	}
+}
+
+// Stop 可重复调用
+func TestStopTwice(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.endpoints = append(s.endpoints, s.newEndpoint("nvidia.com/gpu", allDevices))
+	s.Stop()
+	s.Stop()
+	if s.Ready() {
+		t.Fatalf("Ready() = true after Stop")
+	}
+}
+
+// 启动失败时结束已启动的后台任务
+func TestStartFailureCancelsContext(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.resources = map[string]ResourceFilter{"invalid": allDevices}
+	if err := s.Start(context.Background()); err == nil {
+		t.Fatalf("Start() with invalid resource name succeeded")
+	}
+	select {
+	case <-s.ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("plugin context not cancelled after Start failed")
+	}
+}
+
+// partialManager 模拟部分GPU查询失败：failed 中的GPU上的设备不出现在发现结果中
+type partialManager struct {
+	*device.SimulatorManager
+	failed []string
+	gone   map[string]bool // 真正消失的设备
+}
+
+func (m *partialManager) DiscoverGPUs() ([]device.GPUDevice, error) {
+	all, err := m.SimulatorManager.DiscoverGPUs()
+	var devices []device.GPUDevice
+	for _, d := range all {
+		if !m.gone[d.ID()] && !slices.Contains(m.failed, d.PhysicalID()) {
+			devices = append(devices, d)
+		}
+	}
+	return devices, err
+}
+
+func (m *partialManager) FailedPhysicalIDs() []string { return m.failed }
+
+// discardStream 丢弃 ListAndWatch 上报的设备列表
+type discardStream struct {
+	pluginapi.DevicePlugin_ListAndWatchServer
+}
+
+func (discardStream) Send(*pluginapi.ListAndWatchResponse) error { return nil }
+
+// 查询失败的GPU上的分配不作为孤儿清理，设备真正消失后才清理
+func TestOrphanCleanupSkipsFailedGPUs(t *testing.T) {
+	s, sim := newTestServer(t)
+	manager := &partialManager{SimulatorManager: sim, gone: make(map[string]bool)}
+	s.manager = manager
+	if err := s.allocator.Allocate([]string{"1"}, "pod-a"); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name      string
+		failed    []string
+		gone      []string
+		wantAlloc bool
+	}{
+		{"all GPUs discovered", nil, nil, true},
+		{"GPU query failed", []string{"1"}, nil, true},
+		{"still failing", []string{"1"}, nil, true},
+		{"another GPU failed", []string{"2"}, []string{"1"}, false},
+	}
+	for _, step := range steps {
+		manager.failed = step.failed
+		for _, id := range step.gone {
+			manager.gone[id] = true
+		}
+		if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+			t.Fatalf("%s: updateDeviceList() error = %v", step.name, err)
+		}
+		allocated := slices.Contains(s.allocator.GetAllocatedDevices(), "1")
+		if allocated != step.wantAlloc {
+			t.Fatalf("%s: device 1 allocated = %v, want %v", step.name, allocated, step.wantAlloc)
+		}
+		_, mapped := s.allocator.GetAllocationMap()["1"]
+		if byPod := s.allocator.GetDevicesByPod("pod-a"); mapped != step.wantAlloc || (len(byPod) > 0) != step.wantAlloc {
+			t.Fatalf("%s: device 1 mapped = %v, pod-a devices = %v, want mapped %v", step.name, mapped, byPod, step.wantAlloc)
+		}
+	}
+}
+
+// brokenManager err 非空时发现失败，模拟驱动崩溃
+type brokenManager struct {
+	*partialManager
+	err error
+}
+
+func (m *brokenManager) DiscoverGPUs() ([]device.GPUDevice, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.partialManager.DiscoverGPUs()
+}
+
+// 消失的设备先以 Unhealthy 上报一次再移除，发现整体失败时已上报的设备全部标记为不健康
+func TestVanishedDevicesReportedUnhealthy(t *testing.T) {
+	s, sim := newTestServer(t)
+	manager := &brokenManager{partialManager: &partialManager{SimulatorManager: sim, gone: make(map[string]bool)}}
+	s.manager = manager
+	H, U := pluginapi.Healthy, pluginapi.Unhealthy
+
+	steps := []struct {
+		name   string
+		change func()
+		want   map[string]string
+	}{
+		{"all present", func() {}, map[string]string{"0": H, "1": H, "2": H}},
+		{"device vanishes", func() { manager.gone["2"] = true }, map[string]string{"0": H, "1": H, "2": U}},
+		{"device removed", func() {}, map[string]string{"0": H, "1": H}},
+		{"driver crash", func() { manager.err = errors.New("nvidia-smi failed") }, map[string]string{"0": U, "1": U}},
+		{"driver recovers", func() { manager.err = nil }, map[string]string{"0": H, "1": H}},
+	}
+	for _, step := range steps {
+		step.change()
+		stream := newChanStream(context.Background())
+		if err := s.updateDeviceList(stream, s.resource, allDevices); err != nil {
+			t.Fatalf("%s: updateDeviceList() error = %v", step.name, err)
+		}
+		if got := stream.next(t, time.Second); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("%s: reported %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+// 从未上报过设备时发现失败直接返回错误
+func TestDiscoveryFailureBeforeFirstReport(t *testing.T) {
+	s, sim := newTestServer(t)
+	s.manager = &brokenManager{partialManager: &partialManager{SimulatorManager: sim}, err: errors.New("nvidia-smi failed")}
+	if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err == nil {
+		t.Fatal("updateDeviceList() succeeded although discovery failed")
+	}
+}
+
+// metricValue 从 /metrics 输出中读取指定序列的值，不存在时返回0
+func metricValue(t *testing.T, series string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// 刷新设备列表后更新各健康状态的设备数，分配设备时计数
+func TestDeviceMetrics(t *testing.T) {
+	t.Setenv("SIM_DEVICE_COUNT", "4")
+	t.Setenv("SIM_UNHEALTHY_IDS", "3")
+	s, _ := newTestServer(t)
+	s.vendor = "metrics-test"
+	if err := s.updateDeviceList(discardStream{}, s.resource, allDevices); err != nil {
+		t.Fatal(err)
+	}
+	devices := `micro_device_plugin_devices{health="%s",resource="` + s.resource + `",vendor="metrics-test"}`
+	if got := metricValue(t, fmt.Sprintf(devices, "healthy")); got != 3 {
+		t.Errorf("healthy devices = %v, want 3", got)
+	}
+	if got := metricValue(t, fmt.Sprintf(devices, "unhealthy")); got != 1 {
+		t.Errorf("unhealthy devices = %v, want 1", got)
+	}
+
+	// 计数器在同一进程内累加（如 -count=N），只比较本次分配的增量
+	allocations := `micro_device_plugin_allocations_total{vendor="metrics-test"}`
+	before := metricValue(t, allocations)
+	req := &pluginapi.AllocateRequest{ContainerRequests: []*pluginapi.ContainerAllocateRequest{{DevicesIDs: []string{"0", "1"}}}}
+	if _, err := s.Allocate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if got := metricValue(t, allocations) - before; got != 2 {
+		t.Errorf("allocations_total increased by %v, want 2", got)
+	}
+}
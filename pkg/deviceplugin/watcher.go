@@ -0,0 +1,71 @@
+package deviceplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
+)
+
+// watchKubelet 监听插件目录，kubelet重建 kubelet.sock 或删除本插件socket时重新启动服务并注册
+func (s *DevicePluginServer) watchKubelet(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		klog.Errorf("Failed to create watcher for %s, kubelet restarts will not be detected: %v", s.pluginPath, err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(s.pluginPath); err != nil {
+		klog.Errorf("Failed to watch %s, kubelet restarts will not be detected: %v", s.pluginPath, err)
+		return
+	}
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			for _, endpoint := range s.endpointsToRestart(event) {
+				endpoint.restart()
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			klog.Errorf("Watcher error for %s: %v", s.pluginPath, err)
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// endpointsToRestart 返回需要重启的端点
+// kubelet重建 kubelet.sock 时全部重启，端点socket被删除时只重启该端点
+func (s *DevicePluginServer) endpointsToRestart(event fsnotify.Event) []*resourceEndpoint {
+	endpoints := s.snapshotEndpoints()
+	if filepath.Clean(event.Name) == filepath.Clean(s.kubeletSocket()) && event.Has(fsnotify.Create) {
+		klog.Infof("Kubelet socket %s recreated, restarting %s device plugin", s.kubeletSocket(), s.vendor)
+		return endpoints
+	}
+	if !event.Has(fsnotify.Remove) {
+		return nil
+	}
+	for _, endpoint := range endpoints {
+		if filepath.Clean(event.Name) != filepath.Clean(endpoint.socket) {
+			continue
+		}
+		// 重启时自身清理旧socket也会触发删除事件，新socket已存在时忽略
+		if _, err := os.Stat(endpoint.socket); err == nil {
+			return nil
+		}
+		klog.Infof("Socket %s removed, restarting %s device plugin", endpoint.socket, endpoint.resource)
+		return []*resourceEndpoint{endpoint}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package deviceplugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestEndpointsToRestart(t *testing.T) {
+	s, _ := newTestServer(t)
+	gpu := s.newEndpoint(s.resource, allDevices)
+	mig := s.newEndpoint("nvidia.com/mig-1g.10gb", allDevices)
+	s.endpoints = []*resourceEndpoint{gpu, mig}
+	if err := os.WriteFile(mig.socket, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		event fsnotify.Event
+		want  []*resourceEndpoint
+	}{
+		{"kubelet socket recreated", fsnotify.Event{Name: s.kubeletSocket(), Op: fsnotify.Create}, []*resourceEndpoint{gpu, mig}},
+		{"kubelet socket written", fsnotify.Event{Name: s.kubeletSocket(), Op: fsnotify.Write}, nil},
+		{"endpoint socket removed", fsnotify.Event{Name: gpu.socket, Op: fsnotify.Remove}, []*resourceEndpoint{gpu}},
+		{"endpoint socket already recreated", fsnotify.Event{Name: mig.socket, Op: fsnotify.Remove}, nil},
+		{"unrelated file removed", fsnotify.Event{Name: filepath.Join(s.pluginPath, "other.sock"), Op: fsnotify.Remove}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.endpointsToRestart(tt.event)
+			if len(got) != len(tt.want) {
+				t.Fatalf("endpointsToRestart() restarted %d endpoints, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("endpointsToRestart()[%d] = %s, want %s", i, got[i].resource, tt.want[i].resource)
+				}
+			}
+		})
+	}
+}
+
+// kubelet 重启并重建 kubelet.sock 后插件重新注册
+func TestWatchKubeletReregisters(t *testing.T) {
+	s, _ := newTestServer(t)
+	kubelet := startFakeKubelet(t, s.pluginPath, 0)
+	endpoint := s.newEndpoint(s.resource, allDevices)
+	s.endpoints = []*resourceEndpoint{endpoint}
+	t.Cleanup(s.Stop)
+	if err := endpoint.serve(); err != nil {
+		t.Fatal(err)
+	}
+	kubelet.waitRegistration(t, 5*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.watchKubelet(ctx)
+
+	// 监听建立前的重建事件会丢失，多尝试几次
+	for attempt := 0; ; attempt++ {
+		kubelet.server.Stop()
+		kubelet = startFakeKubelet(t, s.pluginPath, 0)
+		select {
+		case req := <-kubelet.requests:
+			if req.ResourceName != s.resource {
+				t.Fatalf("re-registered resource %q, want %q", req.ResourceName, s.resource)
+			}
+			return
+		case <-time.After(time.Second):
+			if attempt == 2 {
+				t.Fatal("plugin did not re-register after the kubelet socket was recreated")
+			}
+		}
+	}
+}
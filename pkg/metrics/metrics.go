@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "micro_device_plugin"
+
+// Registry 插件自身的指标注册表，避免与依赖库注册到默认注册表的指标混在一起
+var Registry = prometheus.NewRegistry()
+
+var (
+	// Devices 各资源的设备数量，health 为 healthy 或 unhealthy
+	Devices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "devices",
+		Help:      "Number of devices advertised to kubelet by health state.",
+	}, []string{"vendor", "resource", "health"})
+
+	// HealthyDevices 各厂商所有资源的健康设备总数，用于与期望设备数对比
+	HealthyDevices = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "healthy_devices",
+		Help:      "Number of healthy devices across all resources of a vendor.",
+	}, []string{"vendor"})
+
+	// Allocations 分配的设备数量
+	Allocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "allocations_total",
+		Help:      "Total number of devices allocated to containers.",
+	}, []string{"vendor"})
+
+	// Deallocations 释放的设备数量
+	Deallocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deallocations_total",
+		Help:      "Total number of devices released by the plugin.",
+	}, []string{"vendor"})
+
+	// DiscoveryDuration 设备发现耗时
+	DiscoveryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "discovery_duration_seconds",
+		Help:      "Duration of device discovery.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	}, []string{"vendor"})
+
+	// NvidiaSmiFailures nvidia-smi 执行失败次数
+	NvidiaSmiFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "nvidia_smi_failures_total",
+		Help:      "Total number of failed nvidia-smi invocations.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Devices,
+		HealthyDevices,
+		Allocations,
+		Deallocations,
+		DiscoveryDuration,
+		NvidiaSmiFailures,
+	)
+}
+
+// Handler 返回 /metrics 处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}